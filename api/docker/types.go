@@ -0,0 +1,205 @@
+// Package docker holds the types of the subset of the Docker Engine API the
+// daemon serves next to its own, for the docker CLI and client libraries to
+// drive it. Field names follow the Docker API.
+package docker
+
+import (
+	"time"
+
+	"github.com/exfly/container/image"
+)
+
+// APIVersion is the Docker API version we speak, MinAPIVersion the oldest
+// clients may ask for.
+const (
+	APIVersion    = "1.41"
+	MinAPIVersion = "1.24"
+)
+
+type VersionResponse struct {
+	Version       string
+	APIVersion    string `json:"ApiVersion"`
+	MinAPIVersion string `json:"MinAPIVersion"`
+	GoVersion     string
+	Os            string
+	Arch          string
+	KernelVersion string
+}
+
+type ImageSummary struct {
+	ID          string `json:"Id"`
+	ParentID    string `json:"ParentId"`
+	RepoTags    []string
+	RepoDigests []string
+	Created     int64
+	Size        int64
+	SharedSize  int64
+	VirtualSize int64
+	Labels      map[string]string
+	Containers  int64
+}
+
+// JSONMessage is a progress message of an image pull.
+type JSONMessage struct {
+	Status       string     `json:"status,omitempty"`
+	ID           string     `json:"id,omitempty"`
+	Error        *JSONError `json:"errorDetail,omitempty"`
+	ErrorMessage string     `json:"error,omitempty"`
+}
+
+type JSONError struct {
+	Message string `json:"message"`
+}
+
+// Config is the portable configuration of a container.
+type Config struct {
+	Hostname     string
+	User         string
+	Env          []string
+	Cmd          []string
+	Entrypoint   []string
+	Image        string
+	WorkingDir   string
+	Labels       map[string]string
+	StopSignal   string              `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	Volumes      map[string]struct{}
+	Healthcheck  *image.HealthConfig `json:",omitempty"`
+	Tty          bool
+	OpenStdin    bool
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+}
+
+// HostConfig is the host dependent configuration of a container.
+type HostConfig struct {
+	Binds          []string
+	NetworkMode    string
+	AutoRemove     bool
+	Privileged     bool
+	CapAdd         []string
+	CapDrop        []string
+	SecurityOpt    []string
+	ReadonlyRootfs bool
+	ExtraHosts     []string
+	Sysctls        map[string]string
+	PidMode        string
+	IpcMode        string
+	UTSMode        string
+	Ulimits        []Ulimit
+	Devices        []DeviceMapping
+	Mounts         []Mount
+}
+
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+type DeviceMapping struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+type Mount struct {
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+type ContainerCreateRequest struct {
+	Config
+	HostConfig *HostConfig
+}
+
+type ContainerCreateResponse struct {
+	ID       string `json:"Id"`
+	Warnings []string
+}
+
+type ContainerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	ExitCode   int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Health     *Health `json:",omitempty"`
+}
+
+type Health struct {
+	Status        string
+	FailingStreak int
+	Log           []HealthLog
+}
+
+type HealthLog struct {
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	Output   string
+}
+
+type MountPoint struct {
+	Type        string
+	Name        string `json:",omitempty"`
+	Source      string
+	Destination string
+	RW          bool
+}
+
+type NetworkSettings struct {
+	Networks map[string]struct{}
+}
+
+type ContainerJSON struct {
+	ID              string `json:"Id"`
+	Created         time.Time
+	Path            string
+	Args            []string
+	State           *ContainerState
+	Image           string
+	Name            string
+	RestartCount    int
+	Driver          string
+	Platform        string
+	HostConfig      *HostConfig
+	Config          *Config
+	Mounts          []MountPoint
+	NetworkSettings *NetworkSettings
+}
+
+type ContainerSummary struct {
+	ID         string `json:"Id"`
+	Names      []string
+	Image      string
+	ImageID    string
+	Command    string
+	Created    int64
+	State      string
+	Status     string
+	Ports      []struct{}
+	Labels     map[string]string
+	Mounts     []MountPoint
+	HostConfig struct {
+		NetworkMode string
+	}
+}
+
+type WaitResponse struct {
+	StatusCode int
+	Error      *WaitError
+}
+
+type WaitError struct {
+	Message string
+}
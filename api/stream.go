@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Streams of a multiplexed stream. It is a sequence of frames, each an 8
+// byte header, the stream and 3 zero bytes then the big endian payload
+// size, followed by the payload, as in the docker API.
+const (
+	Stdin byte = iota
+	Stdout
+	Stderr
+	// Systemerr carries an error message, it ends the stream.
+	Systemerr
+	// Exit carries the WaitResponse of an exec, it ends the stream.
+	Exit
+)
+
+const frameHeaderLen = 8
+
+// Muxer writes frames to an underlying writer, it is safe for concurrent
+// use.
+type Muxer struct {
+	mu sync.Mutex
+	w  io.Writer
+	// Flush is called after each frame when set.
+	Flush func()
+}
+
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{w: w}
+}
+
+// WriteFrame writes p as a frame of stream.
+func (m *Muxer) WriteFrame(stream byte, p []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	header := make([]byte, frameHeaderLen)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+	if _, err := m.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := m.w.Write(p); err != nil {
+		return err
+	}
+	if m.Flush != nil {
+		m.Flush()
+	}
+	return nil
+}
+
+// Stream returns a writer writing frames of stream.
+func (m *Muxer) Stream(stream byte) io.Writer {
+	return streamWriter{m: m, stream: stream}
+}
+
+type streamWriter struct {
+	m      *Muxer
+	stream byte
+}
+
+func (s streamWriter) Write(p []byte) (int, error) {
+	if err := s.m.WriteFrame(s.stream, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Demux copies the frames read from r to stdout and stderr until EOF or an
+// Exit or Systemerr frame. It returns the WaitResponse of an Exit frame, or
+// nil.
+func Demux(r io.Reader, stdout, stderr io.Writer) (*WaitResponse, error) {
+	header := make([]byte, frameHeaderLen)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, errors.Wrap(err, "read stream")
+		}
+		payload := io.LimitReader(r, int64(binary.BigEndian.Uint32(header[4:])))
+		switch header[0] {
+		case Stdout:
+			if _, err := io.Copy(stdout, payload); err != nil {
+				return nil, err
+			}
+		case Stderr:
+			if _, err := io.Copy(stderr, payload); err != nil {
+				return nil, err
+			}
+		case Systemerr:
+			msg, err := ioutil.ReadAll(payload)
+			if err != nil {
+				return nil, err
+			}
+			return nil, errors.New(string(msg))
+		case Exit:
+			var ret WaitResponse
+			if err := json.NewDecoder(payload).Decode(&ret); err != nil {
+				return nil, errors.Wrap(err, "read exit status")
+			}
+			return &ret, nil
+		default:
+			return nil, errors.Errorf("unknown stream %d", header[0])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemux(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	fmt.Fprint(m.Stream(Stdout), "out\n")
+	fmt.Fprint(m.Stream(Stderr), "err\n")
+	exit, err := json.Marshal(WaitResponse{ExitCode: 3})
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFrame(Exit, exit))
+
+	var stdout, stderr bytes.Buffer
+	ret, err := Demux(&buf, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, 3, ret.ExitCode)
+	assert.Equal(t, "out\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+
+	buf.Reset()
+	require.NoError(t, NewMuxer(&buf).WriteFrame(Systemerr, []byte("boom")))
+	_, err = Demux(&buf, &stdout, &stderr)
+	assert.EqualError(t, err, "boom")
+
+	buf.Reset()
+	ret, err = Demux(&buf, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Nil(t, ret)
+}
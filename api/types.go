@@ -0,0 +1,64 @@
+// Package api holds the types of the HTTP/JSON API the daemon serves on its
+// unix socket, under /v1.
+package api
+
+import (
+	"github.com/exfly/container/image"
+	"github.com/exfly/container/pod"
+)
+
+// Version is the path prefix of the API.
+const Version = "v1"
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+type VersionResponse struct {
+	APIVersion string `json:"api_version"`
+}
+
+type PullRequest struct {
+	Image string `json:"image"`
+}
+
+type ImageInspect struct {
+	*image.Image
+	Config image.ImageMetadataDetails `json:"config"`
+}
+
+type CreateResponse struct {
+	ID string `json:"id"`
+}
+
+type WaitResponse struct {
+	ExitCode int `json:"exit_code"`
+}
+
+type ExecRequest struct {
+	Args    []string `json:"args"`
+	Env     []string `json:"env,omitempty"`
+	CapAdd  []string `json:"cap_add,omitempty"`
+	CapDrop []string `json:"cap_drop,omitempty"`
+}
+
+type PodCreateRequest struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PodSummary is a pod with its status and how many containers it has.
+type PodSummary struct {
+	*pod.Pod
+	Status     string `json:"status"`
+	Containers int    `json:"containers"`
+}
+
+type VolumeCreateRequest struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type VolumePruneResponse struct {
+	VolumesDeleted []string `json:"volumes_deleted"`
+}
@@ -0,0 +1,357 @@
+// Package client talks to the daemon API over its unix socket.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/image"
+	"github.com/exfly/container/pod"
+	"github.com/exfly/container/volume"
+
+	"github.com/pkg/errors"
+)
+
+// Error is an error response of the daemon.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// IsNotFound reports whether err is a not found response.
+func IsNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a conflict response, like for something
+// that already exists.
+func IsConflict(err error) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.StatusCode == http.StatusConflict
+}
+
+func NewClient(socket string) *Client {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return &Client{
+		socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{DialContext: dial},
+		},
+	}
+}
+
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Request, error) {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(content)
+	}
+	u := "http://containerd/" + api.Version + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req.WithContext(ctx), nil
+}
+
+// do sends a request with in as JSON body and decodes the response into
+// out, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "decode response")
+}
+
+// send sends a request and returns the response if it is a success.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, query, in)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to the daemon at %s, is it running?", c.socket)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+func responseError(resp *http.Response) error {
+	var e api.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Message == "" {
+		e.Message = resp.Status
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: e.Message}
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+}
+
+func (c *Client) PullImage(ctx context.Context, ref string) (*image.Image, error) {
+	var ret image.Image
+	err := c.do(ctx, http.MethodPost, "/images", nil, api.PullRequest{Image: ref}, &ret)
+	return &ret, err
+}
+
+func (c *Client) ListImages(ctx context.Context) ([]*image.Image, error) {
+	var ret []*image.Image
+	err := c.do(ctx, http.MethodGet, "/images", nil, nil, &ret)
+	return ret, err
+}
+
+func (c *Client) InspectImage(ctx context.Context, ref string) (*api.ImageInspect, error) {
+	var ret api.ImageInspect
+	err := c.do(ctx, http.MethodGet, "/images/"+url.PathEscape(ref), nil, nil, &ret)
+	return &ret, err
+}
+
+func (c *Client) RemoveImage(ctx context.Context, ref string) error {
+	return c.do(ctx, http.MethodDelete, "/images/"+url.PathEscape(ref), nil, nil, nil)
+}
+
+// ListContainers returns the running containers, all of them with all.
+func (c *Client) ListContainers(ctx context.Context, all bool) ([]*container.Container, error) {
+	var ret []*container.Container
+	err := c.do(ctx, http.MethodGet, "/containers", boolQuery("all", all), nil, &ret)
+	return ret, err
+}
+
+// CreateContainer creates a container from cfg and returns its id.
+func (c *Client) CreateContainer(ctx context.Context, cfg *container.Container) (string, error) {
+	var ret api.CreateResponse
+	err := c.do(ctx, http.MethodPost, "/containers", nil, cfg, &ret)
+	return ret.ID, err
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (*container.Container, error) {
+	var ret container.Container
+	err := c.do(ctx, http.MethodGet, containerPath(id), nil, nil, &ret)
+	return &ret, err
+}
+
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, containerPath(id)+"/start", nil, nil, nil)
+}
+
+func (c *Client) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	return c.do(ctx, http.MethodPost, containerPath(id)+"/stop", url.Values{"t": {timeout.String()}}, nil, nil)
+}
+
+func (c *Client) KillContainer(ctx context.Context, id, signal string) error {
+	var query url.Values
+	if signal != "" {
+		query = url.Values{"signal": {signal}}
+	}
+	return c.do(ctx, http.MethodPost, containerPath(id)+"/kill", query, nil, nil)
+}
+
+func (c *Client) RemoveContainer(ctx context.Context, id string, force bool) error {
+	return c.do(ctx, http.MethodDelete, containerPath(id), boolQuery("force", force), nil, nil)
+}
+
+func (c *Client) PauseContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, containerPath(id)+"/pause", nil, nil, nil)
+}
+
+func (c *Client) UnpauseContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, containerPath(id)+"/unpause", nil, nil, nil)
+}
+
+// WaitContainer waits for a container to exit and returns its exit code.
+func (c *Client) WaitContainer(ctx context.Context, id string) (int, error) {
+	var ret api.WaitResponse
+	err := c.do(ctx, http.MethodPost, containerPath(id)+"/wait", nil, nil, &ret)
+	return ret.ExitCode, err
+}
+
+// ContainerLogs copies the logs of a container to stdout and stderr, with
+// follow until it exits.
+func (c *Client) ContainerLogs(ctx context.Context, id string, follow bool, stdout, stderr io.Writer) error {
+	resp, err := c.send(ctx, http.MethodGet, containerPath(id)+"/logs", boolQuery("follow", follow), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = api.Demux(resp.Body, stdout, stderr)
+	return err
+}
+
+// Exec runs a process in a running container, with stdin, stdout and stderr
+// as its standard streams, and returns its exit code.
+func (c *Client) Exec(ctx context.Context, id string, req api.ExecRequest, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	return c.stream(ctx, containerPath(id)+"/exec", req, stdin, stdout, stderr)
+}
+
+// AttachContainer starts a container with stdin as its standard input,
+// copies its output to stdout and stderr and returns its exit code.
+func (c *Client) AttachContainer(ctx context.Context, id string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	return c.stream(ctx, containerPath(id)+"/attach", nil, stdin, stdout, stderr)
+}
+
+// stream posts in to path upgraded to a raw stream: stdin is sent raw, and
+// the multiplexed output that comes back, ending with an exit status, is
+// copied to stdout and stderr.
+func (c *Client) stream(ctx context.Context, path string, in interface{}, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	httpReq, err := c.newRequest(ctx, http.MethodPost, path, nil, in)
+	if err != nil {
+		return -1, err
+	}
+	httpReq.Header.Set("Connection", "Upgrade")
+	httpReq.Header.Set("Upgrade", "tcp")
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return -1, errors.Wrapf(err, "cannot connect to the daemon at %s, is it running?", c.socket)
+	}
+	defer conn.Close()
+	if err := httpReq.Write(conn); err != nil {
+		return -1, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, httpReq)
+	if err != nil {
+		return -1, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		return -1, responseError(resp)
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(conn, stdin)
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			}
+		}()
+	} else if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+	status, err := api.Demux(br, stdout, stderr)
+	if err != nil {
+		return -1, err
+	}
+	if status == nil {
+		return -1, errors.New("connection closed without exit status")
+	}
+	return status.ExitCode, nil
+}
+
+// ListPods returns all pods.
+func (c *Client) ListPods(ctx context.Context) ([]*api.PodSummary, error) {
+	var ret []*api.PodSummary
+	err := c.do(ctx, http.MethodGet, "/pods", nil, nil, &ret)
+	return ret, err
+}
+
+func (c *Client) CreatePod(ctx context.Context, name string, labels map[string]string) (*pod.Pod, error) {
+	var ret pod.Pod
+	err := c.do(ctx, http.MethodPost, "/pods", nil, api.PodCreateRequest{Name: name, Labels: labels}, &ret)
+	return &ret, err
+}
+
+// StartPod starts a pod with its members.
+func (c *Client) StartPod(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, podPath(name)+"/start", nil, nil, nil)
+}
+
+func (c *Client) StopPod(ctx context.Context, name string, timeout time.Duration) error {
+	return c.do(ctx, http.MethodPost, podPath(name)+"/stop", url.Values{"t": {timeout.String()}}, nil, nil)
+}
+
+// RemovePod removes a pod with its members.
+func (c *Client) RemovePod(ctx context.Context, name string, force bool) error {
+	return c.do(ctx, http.MethodDelete, podPath(name), boolQuery("force", force), nil, nil)
+}
+
+// ListVolumes returns all volumes.
+func (c *Client) ListVolumes(ctx context.Context) ([]*volume.Volume, error) {
+	var ret []*volume.Volume
+	err := c.do(ctx, http.MethodGet, "/volumes", nil, nil, &ret)
+	return ret, err
+}
+
+// CreateVolume creates a volume, named randomly if name is empty.
+func (c *Client) CreateVolume(ctx context.Context, name string, labels map[string]string) (*volume.Volume, error) {
+	var ret volume.Volume
+	err := c.do(ctx, http.MethodPost, "/volumes", nil, api.VolumeCreateRequest{Name: name, Labels: labels}, &ret)
+	return &ret, err
+}
+
+func (c *Client) InspectVolume(ctx context.Context, name string) (*volume.Volume, error) {
+	var ret volume.Volume
+	err := c.do(ctx, http.MethodGet, volumePath(name), nil, nil, &ret)
+	return &ret, err
+}
+
+// RemoveVolume removes a volume no container mounts.
+func (c *Client) RemoveVolume(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, volumePath(name), nil, nil, nil)
+}
+
+// PruneVolumes removes the volumes no container mounts and returns their
+// names.
+func (c *Client) PruneVolumes(ctx context.Context) ([]string, error) {
+	var ret api.VolumePruneResponse
+	err := c.do(ctx, http.MethodPost, "/volumes/prune", nil, nil, &ret)
+	return ret.VolumesDeleted, err
+}
+
+func containerPath(id string) string {
+	return "/containers/" + url.PathEscape(id)
+}
+
+func podPath(name string) string {
+	return "/pods/" + url.PathEscape(name)
+}
+
+func volumePath(name string) string {
+	return "/volumes/" + url.PathEscape(name)
+}
+
+func boolQuery(key string, value bool) url.Values {
+	if !value {
+		return nil
+	}
+	return url.Values{key: {"1"}}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+
+	"github.com/exfly/container/compose"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+const defaultStackFile = "stack.yaml"
+
+// projectFlags are the options shared by up and down.
+type projectFlags struct {
+	file string
+	name string
+}
+
+func (pf *projectFlags) register(fs *flag.FlagSet) {
+	fs.StringVarP(&pf.file, "file", "f", defaultStackFile, "Stack file")
+	fs.StringVarP(&pf.name, "project-name", "p", "", "Project name (default: directory of the stack file)")
+}
+
+func (pf *projectFlags) load() (*compose.Project, error) {
+	return compose.Load(pf.file, pf.name)
+}
+
+func upCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("up", flag.ContinueOnError)
+	pf := projectFlags{}
+	pf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("up takes no arguments")
+	}
+	p, err := pf.load()
+	if err != nil {
+		return err
+	}
+	return ops.composeSrv.Up(ctx, p)
+}
+
+func downCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("down", flag.ContinueOnError)
+	pf := projectFlags{}
+	pf.register(fs)
+	volumes := fs.BoolP("volumes", "v", false, "Remove the named volumes declared in the stack file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("down takes no arguments")
+	}
+	p, err := pf.load()
+	if err != nil {
+		return err
+	}
+	return ops.composeSrv.Down(ctx, p, *volumes)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/client"
+	"github.com/exfly/container/container"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// createContainer creates a container from the image and run flags, pulling
+// the image if needed.
+func createContainer(ctx context.Context, rawImg string, args []string, rf runFlags, ops opts) (string, error) {
+	pulledImg, err := ops.client.PullImage(ctx, rawImg)
+	if err != nil {
+		return "", err
+	}
+	containerInstance := container.NewContainer(pulledImg, nil)
+	if err = rf.apply(containerInstance); err != nil {
+		return "", err
+	}
+	if len(args) != 0 {
+		containerInstance.Cmd = args
+	}
+	// The daemon joins the container to its pod.
+	containerInstance.Pod = rf.pod
+	return ops.client.CreateContainer(ctx, containerInstance)
+}
+
+func createCmd(ctx context.Context, args []string, ops opts) error {
+	rf := runFlags{}
+	fs := newRunFlagSet(&rf, "create")
+	bundle := fs.StringP("bundle", "b", "", "Create the container named by the argument from the OCI bundle at this path")
+	pidFile := fs.String("pid-file", "", "Write the pid of a bundle container's process to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *bundle != "" {
+		if fs.NArg() != 1 {
+			return errors.New("create --bundle requires exactly one container ID")
+		}
+		if err := createBundle(ctx, fs.Arg(0), *bundle, *pidFile, ops); err != nil {
+			return err
+		}
+		fmt.Println(fs.Arg(0))
+		return nil
+	}
+	if fs.NArg() == 0 {
+		return errors.New("create requires an image")
+	}
+	id, err := createContainer(ctx, fs.Arg(0), fs.Args()[1:], rf, ops)
+	if err != nil {
+		return err
+	}
+	fmt.Println(id)
+	return nil
+}
+
+// runCmd creates and starts a container. In the foreground it attaches the
+// standard streams to it, passes SIGINT and SIGTERM on and returns its exit
+// code.
+func runCmd(ctx context.Context, args []string, ops opts) (int, error) {
+	rf := runFlags{}
+	fs := newRunFlagSet(&rf, "run")
+	detach := fs.BoolP("detach", "d", false, "Run container in background and print container ID")
+	if err := fs.Parse(args); err != nil {
+		return -1, err
+	}
+	if fs.NArg() == 0 {
+		return -1, errors.New("run requires an image")
+	}
+	// In the foreground we remove the container ourselves, after we got
+	// its output and exit code.
+	autoRemove := rf.rm
+	rf.rm = rf.rm && *detach
+	id, err := createContainer(ctx, fs.Arg(0), fs.Args()[1:], rf, ops)
+	if err != nil {
+		return -1, err
+	}
+	if *detach {
+		if err := ops.client.StartContainer(ctx, id); err != nil {
+			return -1, err
+		}
+		fmt.Println(id)
+		return 0, nil
+	}
+	if autoRemove {
+		defer func() {
+			if err := ops.client.RemoveContainer(context.Background(), id, true); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+	stopProxy := proxySignals(ctx, id, ops.client)
+	defer stopProxy()
+	return ops.client.AttachContainer(ctx, id, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// proxySignals passes SIGINT and SIGTERM on to the container until the
+// returned function is called.
+func proxySignals(ctx context.Context, id string, cli *client.Client) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if err := cli.KillContainer(ctx, id, fmt.Sprint(int(sig.(syscall.Signal)))); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func startCmd(ctx context.Context, ids []string, ops opts) error {
+	if len(ids) == 0 {
+		return errors.New("start requires at least one container")
+	}
+	for _, id := range ids {
+		if err := ops.client.StartContainer(ctx, id); err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func stopCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	timeout := fs.DurationP("time", "t", container.DefaultStopTimeout, "Time to wait for the container to stop before killing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("stop requires at least one container")
+	}
+	for _, id := range fs.Args() {
+		if err := ops.client.StopContainer(ctx, id, *timeout); err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func killCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("kill", flag.ContinueOnError)
+	sig := fs.StringP("signal", "s", "KILL", "Signal to send to the container")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("kill requires at least one container")
+	}
+	ids := fs.Args()
+	// runc style: kill <container> [signal].
+	if len(ids) == 2 && !fs.Changed("signal") {
+		if c, err := ops.client.InspectContainer(ctx, ids[0]); err == nil && c.Bundle != "" {
+			*sig, ids = ids[1], ids[:1]
+		}
+	}
+	for _, id := range ids {
+		if err := ops.client.KillContainer(ctx, id, *sig); err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
+
+// pauseCmd freezes containers, or thaws them with unpause.
+func pauseCmd(ctx context.Context, name string, args []string, ops opts) error {
+	if len(args) == 0 {
+		return errors.Errorf("%s requires at least one container", name)
+	}
+	for _, id := range args {
+		var err error
+		if name == "pause" {
+			err = ops.client.PauseContainer(ctx, id)
+		} else {
+			err = ops.client.UnpauseContainer(ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func rmCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	force := fs.BoolP("force", "f", false, "Kill a running container before removing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("rm requires at least one container")
+	}
+	for _, id := range fs.Args() {
+		if err := ops.client.RemoveContainer(ctx, id, *force); err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func psCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("ps", flag.ContinueOnError)
+	all := fs.BoolP("all", "a", false, "Show all containers (default shows just running)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	containers, err := ops.client.ListContainers(ctx, *all)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER ID\tIMAGE\tCOMMAND\tSTATUS\tPID")
+	for _, c := range containers {
+		status := c.State.DisplayStatus()
+		if status == container.StatusExited {
+			status = fmt.Sprintf("exited (%d)", c.State.ExitCode)
+		} else if c.State.Health != nil {
+			status += " (" + c.State.Health.Status + ")"
+		}
+		pid := "-"
+		if c.State.IsRunning() {
+			pid = fmt.Sprint(c.State.Pid)
+		}
+		img := c.Bundle
+		if c.Image != nil {
+			img = c.Image.ID()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%q\t%s\t%s\n", *c.ContainerID, img, strings.Join(c.Args, " "), status, pid)
+	}
+	return w.Flush()
+}
+
+// inspectCmd prints containers, or images if there is no such container, as
+// JSON.
+func inspectCmd(ctx context.Context, names []string, ops opts) error {
+	if len(names) == 0 {
+		return errors.New("inspect requires at least one container or image")
+	}
+	var ret []interface{}
+	for _, name := range names {
+		c, err := ops.client.InspectContainer(ctx, name)
+		if err == nil {
+			ret = append(ret, c)
+			continue
+		}
+		if !client.IsNotFound(err) {
+			return err
+		}
+		img, err := ops.client.InspectImage(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "no such container or image %s", name)
+		}
+		ret = append(ret, img)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ret)
+}
+
+func logsCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.BoolP("follow", "f", false, "Follow log output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("logs requires a container")
+	}
+	return ops.client.ContainerLogs(ctx, fs.Arg(0), *follow, os.Stdout, os.Stderr)
+}
+
+func waitCmd(ctx context.Context, ids []string, ops opts) error {
+	if len(ids) == 0 {
+		return errors.New("wait requires at least one container")
+	}
+	for _, id := range ids {
+		code, err := ops.client.WaitContainer(ctx, id)
+		if err != nil {
+			return err
+		}
+		fmt.Println(code)
+	}
+	return nil
+}
+
+func execCmd(ctx context.Context, args []string, ops opts) (int, error) {
+	ef := execFlags{}
+	fs := newExecFlagSet(&ef)
+	if err := fs.Parse(args); err != nil {
+		return -1, err
+	}
+	if fs.NArg() < 2 {
+		return -1, errors.New("exec requires a container id and a command")
+	}
+	env, err := ef.environ()
+	if err != nil {
+		return -1, err
+	}
+	return ops.client.Exec(ctx, fs.Arg(0), api.ExecRequest{
+		Args:    fs.Args()[1:],
+		Env:     env,
+		CapAdd:  ef.capAdd,
+		CapDrop: ef.capDrop,
+	}, os.Stdin, os.Stdout, os.Stderr)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/exfly/container/daemon"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+)
+
+// daemonCmd serves the API until SIGINT or SIGTERM. Running containers
+// outlive it.
+func daemonCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	socket := fs.String("socket", ops.configHome.SocketPath(), "Unix socket to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("got %v, shutting down", sig)
+		cancel()
+	}()
+
+	if err := ops.containerSrv.Reconcile(); err != nil {
+		return err
+	}
+	ln, err := daemon.Listen(*socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+	log.Infof("listening on %s", *socket)
+	return daemon.NewServer(ctx, ops.imgSrv, ops.containerSrv, ops.podSrv, ops.volSrv).Serve(ln)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"time"
+
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/image"
+	pkgenv "github.com/exfly/container/pkg/env"
+
+	flag "github.com/spf13/pflag"
+)
+
+// envFlags are the environment options shared by run and exec.
+type envFlags struct {
+	env      []string
+	envFiles []string
+}
+
+func (ef *envFlags) register(fs *flag.FlagSet) {
+	fs.StringArrayVarP(&ef.env, "env", "e", nil, "Set environment variables (KEY=VAL, or KEY to inherit from the host)")
+	fs.StringArrayVar(&ef.envFiles, "env-file", nil, "Read in a file of environment variables")
+}
+
+// environ returns the variables from --env-file followed by -e, so -e wins.
+func (ef *envFlags) environ() ([]string, error) {
+	var ret []string
+	for _, path := range ef.envFiles {
+		vars, err := pkgenv.ParseEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, vars...)
+	}
+	for _, e := range ef.env {
+		kv, err := pkgenv.Normalize(e)
+		if err != nil {
+			return nil, err
+		}
+		if kv != "" {
+			ret = append(ret, kv)
+		}
+	}
+	return ret, nil
+}
+
+// capFlags are the capability options shared by run and exec.
+type capFlags struct {
+	capAdd  []string
+	capDrop []string
+}
+
+func (cf *capFlags) register(fs *flag.FlagSet) {
+	fs.StringArrayVar(&cf.capAdd, "cap-add", nil, "Add Linux capabilities (or ALL)")
+	fs.StringArrayVar(&cf.capDrop, "cap-drop", nil, "Drop Linux capabilities (or ALL)")
+}
+
+// runFlags are the options accepted by the run subcommand.
+type runFlags struct {
+	fs *flag.FlagSet
+	envFlags
+	capFlags
+
+	entrypoint string
+	workdir    string
+	user       string
+
+	volumes           []string
+	devices           []string
+	mounts            []string
+	rootfsPropagation string
+	noPivot           bool
+	readOnly          bool
+	securityOpts      []string
+	ulimits           []string
+	sysctls           []string
+	userns            string
+	uidMaps           []string
+	gidMaps           []string
+	network           string
+	networkHelper     string
+	pid               string
+	ipc               string
+	uts               string
+	timeOffsets       []string
+	pod               string
+	extraHosts        []string
+	rm                bool
+
+	healthCmd         string
+	healthInterval    time.Duration
+	healthRetries     int
+	healthTimeout     time.Duration
+	healthStartPeriod time.Duration
+}
+
+// newRunFlagSet returns the flags of run, and of create, which is name.
+func newRunFlagSet(rf *runFlags, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	// Everything after the image belongs to the container command.
+	fs.SetInterspersed(false)
+	rf.fs = fs
+
+	rf.envFlags.register(fs)
+	rf.capFlags.register(fs)
+	fs.BoolVar(&rf.rm, "rm", false, "Automatically remove the container when it exits")
+	fs.StringVar(&rf.entrypoint, "entrypoint", "", "Overwrite the default ENTRYPOINT of the image")
+	fs.StringVarP(&rf.workdir, "workdir", "w", "", "Working directory inside the container")
+	fs.StringVarP(&rf.user, "user", "u", "", "Username or UID (format: <name|uid>[:<group|gid>])")
+	fs.StringArrayVarP(&rf.volumes, "volume", "v", nil, "Bind mount a volume (host-path|name:container-path[:ro])")
+	fs.StringArrayVar(&rf.mounts, "mount", nil, "Attach a filesystem mount (type=bind|volume|tmpfs,source=...,target=...[,readonly])")
+	fs.BoolVar(&rf.readOnly, "read-only", false, "Mount the container's root filesystem as read only")
+	fs.StringArrayVar(&rf.devices, "device", nil, "Add a host device to the container (host[:container][:rwm])")
+	fs.StringVar(&rf.rootfsPropagation, "rootfs-propagation", "", "Mount propagation of the container mount tree (default rprivate)")
+	fs.BoolVar(&rf.noPivot, "no-pivot", false, "Use chroot instead of pivot_root, for rootfs on ramfs")
+	fs.StringArrayVar(&rf.securityOpts, "security-opt", nil, "Security options (seccomp=unconfined|<profile.json>, no-new-privileges)")
+	fs.StringArrayVar(&rf.ulimits, "ulimit", nil, "Ulimit options (name=soft[:hard])")
+	fs.StringArrayVar(&rf.sysctls, "sysctl", nil, "Namespaced kernel parameters (key=value)")
+	fs.StringVar(&rf.userns, "userns", "", "User namespace to use (host, auto or auto:<user> for the ranges in /etc/subuid)")
+	fs.StringArrayVar(&rf.uidMaps, "uidmap", nil, "UID map for the user namespace (container:host:size)")
+	fs.StringArrayVar(&rf.gidMaps, "gidmap", nil, "GID map for the user namespace (container:host:size)")
+	fs.StringVar(&rf.network, "network", "", "Network mode: host, none or ns:<path> (default host, none when rootless)")
+	fs.StringVar(&rf.networkHelper, "network-helper", "", "Userspace network helper to run for the container, {pid} is replaced by its pid (e.g. \"slirp4netns --configure {pid} tap0\")")
+	fs.StringVar(&rf.pid, "pid", "", "PID namespace to use (host, container:<id> or ns:<path>)")
+	fs.StringVar(&rf.ipc, "ipc", "", "IPC namespace to use (host, container:<id> or ns:<path>)")
+	fs.StringVar(&rf.uts, "uts", "", "UTS namespace to use (host, container:<id> or ns:<path>)")
+	fs.StringVar(&rf.pod, "pod", "", "Run the container in a pod, started if needed")
+	fs.StringArrayVar(&rf.extraHosts, "add-host", nil, "Add a custom host-to-IP mapping (host:ip)")
+	fs.StringArrayVar(&rf.timeOffsets, "time-offset", nil, "Offset a clock of the container time namespace (monotonic|boottime=duration)")
+	fs.StringVar(&rf.healthCmd, "health-cmd", "", "Command to run to check health")
+	fs.DurationVar(&rf.healthInterval, "health-interval", 0, "Time between running the check (default 30s)")
+	fs.IntVar(&rf.healthRetries, "health-retries", 0, "Consecutive failures needed to report unhealthy (default 3)")
+	fs.DurationVar(&rf.healthTimeout, "health-timeout", 0, "Maximum time to allow one check to run (default 30s)")
+	fs.DurationVar(&rf.healthStartPeriod, "health-start-period", 0, "Start period for the container to initialize before failures count")
+	return fs
+}
+
+// healthConfig returns the healthcheck overrides given on the command line,
+// or nil if none were set.
+func (rf *runFlags) healthConfig() *image.HealthConfig {
+	if rf.healthCmd == "" && rf.healthInterval == 0 && rf.healthTimeout == 0 &&
+		rf.healthStartPeriod == 0 && rf.healthRetries == 0 {
+		return nil
+	}
+	hc := &image.HealthConfig{
+		Interval:    rf.healthInterval,
+		Timeout:     rf.healthTimeout,
+		StartPeriod: rf.healthStartPeriod,
+		Retries:     rf.healthRetries,
+	}
+	if rf.healthCmd != "" {
+		hc.Test = []string{"CMD-SHELL", rf.healthCmd}
+	}
+	return hc
+}
+
+func (rf *runFlags) apply(c *container.Container) error {
+	env, err := rf.environ()
+	if err != nil {
+		return err
+	}
+	c.Env = env
+	if rf.fs.Changed("entrypoint") {
+		// An explicit empty --entrypoint clears the image entrypoint.
+		c.Entrypoint = []string{}
+		if rf.entrypoint != "" {
+			c.Entrypoint = []string{rf.entrypoint}
+		}
+	}
+	c.CapAdd = rf.capAdd
+	c.CapDrop = rf.capDrop
+	c.WorkingDir = rf.workdir
+	c.User = rf.user
+	c.RootfsPropagation = rf.rootfsPropagation
+	c.NoPivotRoot = rf.noPivot
+	c.ReadonlyRootfs = rf.readOnly
+	c.SecurityOpt = rf.securityOpts
+	c.Userns = rf.userns
+	c.Network = rf.network
+	c.NetworkHelper = rf.networkHelper
+	c.PidMode = rf.pid
+	c.IpcMode = rf.ipc
+	c.UtsMode = rf.uts
+	for _, spec := range rf.timeOffsets {
+		clock, d, err := container.ParseTimeOffset(spec)
+		if err != nil {
+			return err
+		}
+		if c.TimeOffsets == nil {
+			c.TimeOffsets = map[string]time.Duration{}
+		}
+		c.TimeOffsets[clock] = d
+	}
+	for _, spec := range rf.extraHosts {
+		h, err := container.ParseExtraHost(spec)
+		if err != nil {
+			return err
+		}
+		c.ExtraHosts = append(c.ExtraHosts, h)
+	}
+	for _, spec := range rf.uidMaps {
+		m, err := container.ParseIDMap(spec)
+		if err != nil {
+			return err
+		}
+		c.UIDMappings = append(c.UIDMappings, m)
+	}
+	for _, spec := range rf.gidMaps {
+		m, err := container.ParseIDMap(spec)
+		if err != nil {
+			return err
+		}
+		c.GIDMappings = append(c.GIDMappings, m)
+	}
+	for _, spec := range rf.ulimits {
+		u, err := container.ParseUlimit(spec)
+		if err != nil {
+			return err
+		}
+		c.Ulimits = append(c.Ulimits, u)
+	}
+	for _, spec := range rf.sysctls {
+		key, value, err := container.ParseSysctl(spec)
+		if err != nil {
+			return err
+		}
+		if c.Sysctls == nil {
+			c.Sysctls = map[string]string{}
+		}
+		c.Sysctls[key] = value
+	}
+	for _, spec := range rf.volumes {
+		m, err := container.ParseVolumeSpec(spec)
+		if err != nil {
+			return err
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+	for _, spec := range rf.devices {
+		d, err := container.ParseDeviceSpec(spec)
+		if err != nil {
+			return err
+		}
+		c.Devices = append(c.Devices, d)
+	}
+	for _, spec := range rf.mounts {
+		m, err := container.ParseMountSpec(spec)
+		if err != nil {
+			return err
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+	c.Healthcheck = rf.healthConfig()
+	c.AutoRemove = rf.rm
+	return nil
+}
+
+// execFlags are the options accepted by the exec subcommand.
+type execFlags struct {
+	envFlags
+	capFlags
+}
+
+func newExecFlagSet(ef *execFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	fs.SetInterspersed(false)
+	ef.envFlags.register(fs)
+	ef.capFlags.register(fs)
+	return fs
+}
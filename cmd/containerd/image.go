@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+func imagesCmd(ctx context.Context, ops opts) error {
+	images, err := ops.client.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tTAG\tIMAGE ID")
+	for _, img := range images {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", img.Img, img.Tag, img.ShaHex)
+	}
+	return w.Flush()
+}
+
+func pullCmd(ctx context.Context, refs []string, ops opts) error {
+	if len(refs) == 0 {
+		return errors.New("pull requires at least one image")
+	}
+	for _, ref := range refs {
+		img, err := ops.client.PullImage(ctx, ref)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", img.ID(), img.ShaHex)
+	}
+	return nil
+}
+
+func rmiCmd(ctx context.Context, refs []string, ops opts) error {
+	if len(refs) == 0 {
+		return errors.New("rmi requires at least one image")
+	}
+	for _, ref := range refs {
+		if err := ops.client.RemoveImage(ctx, ref); err != nil {
+			return err
+		}
+		fmt.Println("Untagged: " + ref)
+	}
+	return nil
+}
@@ -7,15 +7,26 @@ import (
 	"regexp"
 	"runtime"
 
+	"github.com/exfly/container/client"
+	"github.com/exfly/container/compose"
 	"github.com/exfly/container/config"
 	"github.com/exfly/container/container"
 	"github.com/exfly/container/image"
+	"github.com/exfly/container/pod"
+	"github.com/exfly/container/volume"
 
-	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
 )
 
+func init() {
+	// child-mode starts the container process from the main thread, the
+	// only one whose time namespace offsets can be set.
+	if len(os.Args) > 1 && os.Args[1] == "child-mode" {
+		runtime.LockOSThread()
+	}
+}
+
 func main() {
 	log.SetReportCaller(true)
 	log.SetLevel(log.TraceLevel)
@@ -28,11 +39,12 @@ func main() {
 		},
 	})
 
-	/* We chroot and write to privileged directories. We need to be root */
-	if os.Geteuid() != 0 {
-		log.Fatal("You need root privileges to run this program.")
+	// Without root we run rootless: state lives under $XDG_DATA_HOME and
+	// containers get a user namespace mapping us to root.
+	if config.IsRootless() {
+		log.Info("running rootless")
 	}
-	configHome := config.NewHome("/home/vagrant/containerd")
+	configHome := config.NewHome(config.DefaultHomePath())
 	configHome.InitDirs()
 	imageConfig := image.NewImageConfig(configHome)
 	// init bridge
@@ -41,69 +53,119 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	volSrv := volume.NewVolumeService(configHome)
 	containerSrv := container.NewContainerService(
 		configHome,
 		imageConfig,
 		imgSrv,
+		volSrv,
 	)
+	podSrv := pod.NewPodService(configHome, containerSrv)
+	cli := client.NewClient(configHome.SocketPath())
+	composeSrv := compose.NewComposeService(cli)
 	ctx := context.TODO()
 	ops := opts{
 		configHome:   configHome,
 		imgConf:      imageConfig,
 		imgSrv:       imgSrv,
+		volSrv:       volSrv,
 		containerSrv: containerSrv,
+		podSrv:       podSrv,
+		composeSrv:   composeSrv,
+		client:       cli,
 	}
 	switch os.Args[1] {
+	case "daemon":
+		err = daemonCmd(ctx, os.Args[2:], ops)
+	case "cri":
+		err = criCmd(ctx, os.Args[2:], ops)
 	case "run":
-		fs := flag.FlagSet{}
-		fs.ParseErrorsWhitelist.UnknownFlags = true
-
-		if err := fs.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Error parsing: ", err)
+		code, err := runCmd(ctx, os.Args[2:], ops)
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		img := fs.Args()[0]
-		if err := runCmd(ctx, img, fs.Args()[1:], ops); err != nil {
-			panic(err)
+		os.Exit(code)
+	case "exec":
+		code, err := execCmd(ctx, os.Args[2:], ops)
+		if err != nil {
+			log.Fatal(err)
 		}
+		os.Exit(code)
+	case "create":
+		err = createCmd(ctx, os.Args[2:], ops)
+	case "start":
+		err = startCmd(ctx, os.Args[2:], ops)
+	case "stop":
+		err = stopCmd(ctx, os.Args[2:], ops)
+	case "kill":
+		err = killCmd(ctx, os.Args[2:], ops)
+	case "pause", "unpause":
+		err = pauseCmd(ctx, os.Args[1], os.Args[2:], ops)
+	case "rm":
+		err = rmCmd(ctx, os.Args[2:], ops)
+	case "spec":
+		err = specCmd(ctx, os.Args[2:], ops)
+	case "state":
+		err = stateCmd(os.Args[2:], ops)
+	case "delete":
+		err = deleteCmd(os.Args[2:], ops)
+	case "ps":
+		err = psCmd(ctx, os.Args[2:], ops)
+	case "inspect":
+		err = inspectCmd(ctx, os.Args[2:], ops)
+	case "logs":
+		err = logsCmd(ctx, os.Args[2:], ops)
+	case "wait":
+		err = waitCmd(ctx, os.Args[2:], ops)
 	case "images":
+		err = imagesCmd(ctx, ops)
+	case "pull":
+		err = pullCmd(ctx, os.Args[2:], ops)
+	case "rmi":
+		err = rmiCmd(ctx, os.Args[2:], ops)
+	case "volume":
+		err = volumeCmd(ctx, os.Args[2:], ops)
+	case "pod":
+		err = podCmd(ctx, os.Args[2:], ops)
+	case "up":
+		err = upCmd(ctx, os.Args[2:], ops)
+	case "down":
+		err = downCmd(ctx, os.Args[2:], ops)
+	case pod.InfraCommand:
+		err = pod.RunInfra(os.Args[2])
 	case "child-mode":
+		log.SetOutput(container.ChildModeLog())
 		log.Info("child-mode")
 		fs := flag.FlagSet{}
+		fs.SetInterspersed(false)
 		if err := fs.Parse(os.Args[2:]); err != nil {
 			fmt.Println("Error parsing: ", err)
 		}
 		containerID := fs.Args()[0]
 		if err := runChildMode(ctx, containerID, fs.Args()[1:], ops); err != nil {
+			if exitErr, ok := err.(*container.ExitError); ok {
+				os.Exit(exitErr.Code)
+			}
 			panic(err)
 		}
 	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 type opts struct {
 	configHome   *config.Home
 	imgConf      *image.ImageConfig
 	imgSrv       *image.ImageService
+	volSrv       *volume.VolumeService
 	containerSrv *container.ContainerService
+	podSrv       *pod.PodService
+	composeSrv   *compose.ComposeService
+	// client talks to the daemon, which runs the containers.
+	client *client.Client
 }
 
 func runChildMode(ctx context.Context, containerID string, args []string, ops opts) error {
 	return ops.containerSrv.RunByID(ctx, containerID, args)
 }
-
-func runCmd(ctx context.Context, rawImg string, args []string, ops opts) error {
-	img, err := image.NewImage(rawImg)
-	if err != nil {
-		return err
-	}
-	pulledImg, err := ops.imgSrv.GetOrPull(ctx, img)
-	if err != nil {
-		return err
-	}
-	log.Infof("imges: %v", pulledImg)
-	containerInstance := container.NewContainer(pulledImg, nil)
-	if err = ops.containerSrv.Run(ctx, containerInstance, args); err != nil {
-		return errors.Wrap(err, "run container error")
-	}
-	return nil
-}
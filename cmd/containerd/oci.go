@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/exfly/container/container"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// OCI bundle containers are run by the CLI itself, like runc does: nobody
+// waits for their process, state finds out whether it still runs.
+
+// createBundle creates container id from the OCI bundle at dir, and writes
+// the pid of its process to pidFile if set.
+func createBundle(ctx context.Context, id, dir, pidFile string, ops opts) error {
+	c, err := container.LoadBundle(dir, id)
+	if err != nil {
+		return err
+	}
+	if err := ops.containerSrv.CreateFromBundle(ctx, c); err != nil {
+		return err
+	}
+	if pidFile != "" {
+		if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(c.State.Pid)), 0644); err != nil {
+			return errors.Wrap(err, "write pid file")
+		}
+	}
+	return nil
+}
+
+// specCmd writes the OCI bundle a container from an image and run flags
+// would run as: the image flattened into rootfs and its config.json.
+func specCmd(ctx context.Context, args []string, ops opts) error {
+	rf := runFlags{}
+	fs := newRunFlagSet(&rf, "spec")
+	dir := fs.StringP("bundle", "b", ".", "Directory to write the bundle to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("spec requires an image")
+	}
+	img, err := ops.client.PullImage(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	c := container.NewContainer(img, nil)
+	if err := rf.apply(c); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		c.Cmd = fs.Args()[1:]
+	}
+	if rf.pod != "" {
+		if err := ops.podSrv.Join(c, rf.pod); err != nil {
+			return err
+		}
+	}
+	return ops.containerSrv.WriteBundle(c, *dir)
+}
+
+// stateCmd prints the OCI state of a container.
+func stateCmd(args []string, ops opts) error {
+	if len(args) != 1 {
+		return errors.New("state requires exactly one container")
+	}
+	state, err := ops.containerSrv.OCIState(args[0])
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state)
+}
+
+// deleteCmd removes containers created from a bundle.
+func deleteCmd(args []string, ops opts) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	force := fs.BoolP("force", "f", false, "Kill a running container before deleting it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("delete requires at least one container")
+	}
+	for _, id := range fs.Args() {
+		if err := ops.containerSrv.Delete(id, *force); err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
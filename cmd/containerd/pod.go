@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/pod"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+func podCmd(ctx context.Context, args []string, ops opts) error {
+	if len(args) == 0 {
+		return errors.New("usage: pod create|ls|start|stop|rm")
+	}
+	switch args[0] {
+	case "create":
+		return podCreateCmd(ctx, args[1:], ops)
+	case "ls":
+		return podListCmd(ctx, ops)
+	case "start":
+		return podStartCmd(ctx, args[1:], ops)
+	case "stop":
+		return podStopCmd(ctx, args[1:], ops)
+	case "rm":
+		return podRemoveCmd(ctx, args[1:], ops)
+	default:
+		return errors.Errorf("unknown pod command %q", args[0])
+	}
+}
+
+func podCreateCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("pod create", flag.ContinueOnError)
+	labels := fs.StringArray("label", nil, "Set metadata for a pod (key=value)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("pod create requires a name")
+	}
+	labelMap := map[string]string{}
+	for _, l := range *labels {
+		kv := strings.SplitN(l, "=", 2)
+		labelMap[kv[0]] = ""
+		if len(kv) == 2 {
+			labelMap[kv[0]] = kv[1]
+		}
+	}
+	p, err := ops.client.CreatePod(ctx, fs.Arg(0), labelMap)
+	if err != nil {
+		return err
+	}
+	fmt.Println(p.Name)
+	return nil
+}
+
+func podListCmd(ctx context.Context, ops opts) error {
+	pods, err := ops.client.ListPods(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tINFRA PID\tCONTAINERS\tCREATED")
+	for _, p := range pods {
+		pid := "-"
+		if p.Status == pod.StatusRunning {
+			pid = fmt.Sprint(p.Infra.Pid)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", p.Name, p.Status, pid, p.Containers, p.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func podStartCmd(ctx context.Context, names []string, ops opts) error {
+	if len(names) == 0 {
+		return errors.New("pod start requires at least one name")
+	}
+	for _, name := range names {
+		if err := ops.client.StartPod(ctx, name); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func podStopCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("pod stop", flag.ContinueOnError)
+	timeout := fs.DurationP("time", "t", container.DefaultStopTimeout, "Time to wait for members to stop before killing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("pod stop requires at least one name")
+	}
+	for _, name := range fs.Args() {
+		if err := ops.client.StopPod(ctx, name, *timeout); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func podRemoveCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("pod rm", flag.ContinueOnError)
+	force := fs.BoolP("force", "f", false, "Stop a running pod and its members before removing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("pod rm requires at least one name")
+	}
+	for _, name := range fs.Args() {
+		if err := ops.client.RemovePod(ctx, name, *force); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
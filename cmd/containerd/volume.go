@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/exfly/container/volume"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+func volumeCmd(ctx context.Context, args []string, ops opts) error {
+	if len(args) == 0 {
+		return errors.New("usage: volume create|ls|inspect|rm|prune")
+	}
+	switch args[0] {
+	case "create":
+		return volumeCreateCmd(ctx, args[1:], ops)
+	case "ls":
+		return volumeListCmd(ctx, ops)
+	case "inspect":
+		return volumeInspectCmd(ctx, args[1:], ops)
+	case "rm":
+		return volumeRemoveCmd(ctx, args[1:], ops)
+	case "prune":
+		return volumePruneCmd(ctx, ops)
+	default:
+		return errors.Errorf("unknown volume command %q", args[0])
+	}
+}
+
+func volumeCreateCmd(ctx context.Context, args []string, ops opts) error {
+	fs := flag.NewFlagSet("volume create", flag.ContinueOnError)
+	labels := fs.StringArray("label", nil, "Set metadata for a volume (key=value)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var name string
+	if fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	labelMap := map[string]string{}
+	for _, l := range *labels {
+		kv := strings.SplitN(l, "=", 2)
+		labelMap[kv[0]] = ""
+		if len(kv) == 2 {
+			labelMap[kv[0]] = kv[1]
+		}
+	}
+	vol, err := ops.client.CreateVolume(ctx, name, labelMap)
+	if err != nil {
+		return err
+	}
+	fmt.Println(vol.Name)
+	return nil
+}
+
+func volumeListCmd(ctx context.Context, ops opts) error {
+	vols, err := ops.client.ListVolumes(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "DRIVER\tVOLUME NAME")
+	for _, vol := range vols {
+		fmt.Fprintf(w, "%s\t%s\n", vol.Driver, vol.Name)
+	}
+	return w.Flush()
+}
+
+func volumeInspectCmd(ctx context.Context, names []string, ops opts) error {
+	if len(names) == 0 {
+		return errors.New("volume inspect requires at least one name")
+	}
+	var vols []*volume.Volume
+	for _, name := range names {
+		vol, err := ops.client.InspectVolume(ctx, name)
+		if err != nil {
+			return err
+		}
+		vols = append(vols, vol)
+	}
+	content, err := json.MarshalIndent(vols, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+func volumeRemoveCmd(ctx context.Context, names []string, ops opts) error {
+	if len(names) == 0 {
+		return errors.New("volume rm requires at least one name")
+	}
+	for _, name := range names {
+		if err := ops.client.RemoveVolume(ctx, name); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func volumePruneCmd(ctx context.Context, ops opts) error {
+	removed, err := ops.client.PruneVolumes(ctx)
+	for _, name := range removed {
+		fmt.Println(name)
+	}
+	return err
+}
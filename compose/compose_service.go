@@ -0,0 +1,513 @@
+package compose
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/exfly/container/client"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/image"
+	pkgenv "github.com/exfly/container/pkg/env"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels set on the containers, networks and volumes of a project.
+const (
+	ProjectLabel = "com.docker.compose.project"
+	ServiceLabel = "com.docker.compose.service"
+)
+
+// dependencyPollInterval is how often up checks the state of the services
+// others depend on.
+const dependencyPollInterval = 200 * time.Millisecond
+
+// errStopped is returned when up is stopped while waiting to start services.
+var errStopped = errors.New("stopped")
+
+func NewComposeService(cli *client.Client) *ComposeService {
+	return &ComposeService{
+		cli: cli,
+	}
+}
+
+// ComposeService runs the services of a stack file through the daemon.
+// Networks are pods named <project>_<network>, whose members reach each
+// other by service name.
+type ComposeService struct {
+	cli *client.Client
+}
+
+// running is a service container started by up.
+type running struct {
+	svc       *Service
+	container *container.Container
+	// done is closed once the container has exited and been cleaned up,
+	// err is then its result.
+	done chan struct{}
+	err  error
+}
+
+// Up creates the networks and volumes of p and runs its services in
+// dependency order. It returns once all of them have exited, stopping them
+// on SIGINT or SIGTERM.
+func (s *ComposeService) Up(ctx context.Context, p *Project) error {
+	order, err := p.Order()
+	if err != nil {
+		return err
+	}
+	if err := s.createVolumes(ctx, p); err != nil {
+		return err
+	}
+	if err := s.createNetworks(ctx, p); err != nil {
+		return err
+	}
+	images := map[string]*image.Image{}
+	for _, svc := range order {
+		img, err := s.cli.PullImage(ctx, svc.Image)
+		if err != nil {
+			return errors.Wrapf(err, "pull image of service %s", svc.Name)
+		}
+		images[svc.Name] = img
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stopping := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(stopping) }) }
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Infof("got %v, stopping project %s", sig, p.Name)
+			stop()
+		case <-stopping:
+		}
+	}()
+
+	var (
+		started []*running
+		proxies []*portProxy
+		upErr   error
+	)
+	byName := map[string]*running{}
+	for _, svc := range order {
+		if err := s.waitForDependencies(ctx, svc, byName, stopping); err != nil {
+			if err != errStopped {
+				upErr = err
+			}
+			break
+		}
+		r, err := s.startService(ctx, p, svc, images[svc.Name])
+		if err != nil {
+			upErr = errors.Wrapf(err, "start service %s", svc.Name)
+			break
+		}
+		started = append(started, r)
+		byName[svc.Name] = r
+		ps, err := s.publishPorts(r)
+		proxies = append(proxies, ps...)
+		if err != nil {
+			upErr = errors.Wrapf(err, "publish ports of service %s", svc.Name)
+			break
+		}
+	}
+	if upErr != nil {
+		stop()
+	}
+	// Up is over once every service has exited on its own too.
+	go func() {
+		for _, r := range started {
+			<-r.done
+		}
+		stop()
+	}()
+	<-stopping
+	s.stopServices(ctx, started)
+	for _, proxy := range proxies {
+		proxy.Close()
+	}
+	for _, r := range started {
+		<-r.done
+		if r.err != nil {
+			log.WithError(r.err).Warnf("service %s", r.svc.Name)
+		}
+	}
+	return upErr
+}
+
+// Down stops the containers of p and removes its networks, and its
+// volumes with removeVolumes.
+func (s *ComposeService) Down(ctx context.Context, p *Project, removeVolumes bool) error {
+	order, err := p.Order()
+	if err != nil {
+		return err
+	}
+	containers, err := s.projectContainers(ctx, p)
+	if err != nil {
+		return err
+	}
+	// Dependents first.
+	for i := len(order) - 1; i >= 0; i-- {
+		for _, c := range containers {
+			if c.Labels[ServiceLabel] != order[i].Name {
+				continue
+			}
+			err := s.cli.StopContainer(ctx, *c.ContainerID, container.DefaultStopTimeout)
+			if err != nil && !isGone(err) {
+				return err
+			}
+		}
+	}
+	// Up removes the containers once they exited, unless it is gone too.
+	for _, c := range containers {
+		err := s.cli.RemoveContainer(ctx, *c.ContainerID, true)
+		if err != nil && !client.IsNotFound(err) {
+			return err
+		}
+	}
+	for _, network := range p.networks() {
+		err := s.cli.RemovePod(ctx, p.networkName(network), true)
+		if err != nil && !client.IsNotFound(err) {
+			return err
+		}
+	}
+	if !removeVolumes {
+		return nil
+	}
+	for _, name := range sortedVolumes(p) {
+		err := s.cli.RemoveVolume(ctx, p.volumeName(name))
+		if err != nil && !client.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ComposeService) createVolumes(ctx context.Context, p *Project) error {
+	for _, name := range sortedVolumes(p) {
+		fullName := p.volumeName(name)
+		if _, err := s.cli.InspectVolume(ctx, fullName); err == nil {
+			continue
+		} else if !client.IsNotFound(err) {
+			return err
+		}
+		var labels Labels
+		if v := p.Volumes[name]; v != nil {
+			labels = v.Labels
+		}
+		if _, err := s.cli.CreateVolume(ctx, fullName, p.labels(labels)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ComposeService) createNetworks(ctx context.Context, p *Project) error {
+	for _, network := range p.networks() {
+		var labels Labels
+		if n := p.Networks[network]; n != nil {
+			labels = n.Labels
+		}
+		_, err := s.cli.CreatePod(ctx, p.networkName(network), p.labels(labels))
+		if err != nil && !client.IsConflict(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForDependencies waits until the services svc depends on meet their
+// condition.
+func (s *ComposeService) waitForDependencies(ctx context.Context, svc *Service, byName map[string]*running, stopping <-chan struct{}) error {
+	for _, name := range sortedKeys(svc.DependsOn) {
+		cond := svc.DependsOn[name]
+		dep := byName[name]
+		for {
+			ok, err := s.conditionMet(ctx, dep, cond)
+			if err != nil {
+				return errors.Wrapf(err, "service %s depends on %s", svc.Name, name)
+			}
+			if ok {
+				break
+			}
+			select {
+			case <-stopping:
+				return errStopped
+			case <-time.After(dependencyPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ComposeService) conditionMet(ctx context.Context, dep *running, cond string) (bool, error) {
+	select {
+	case <-dep.done:
+		if dep.err != nil {
+			return false, dep.err
+		}
+		if cond == ConditionHealthy {
+			return false, errors.New("exited")
+		}
+		return true, nil
+	default:
+	}
+	if cond == ConditionCompleted {
+		return false, nil
+	}
+	c, err := s.cli.InspectContainer(ctx, *dep.container.ContainerID)
+	if err != nil {
+		// Already gone.
+		return false, nil
+	}
+	if !c.State.IsRunning() {
+		return false, nil
+	}
+	if cond == ConditionStarted {
+		return true, nil
+	}
+	if c.State.Health == nil {
+		if c.Healthcheck == nil {
+			return false, errors.New("no healthcheck")
+		}
+		return false, nil
+	}
+	switch c.State.Health.Status {
+	case container.HealthHealthy:
+		return true, nil
+	case container.HealthUnhealthy:
+		return false, errors.New("unhealthy")
+	}
+	return false, nil
+}
+
+// startService starts the container of svc, which is removed once it has
+// exited.
+func (s *ComposeService) startService(ctx context.Context, p *Project, svc *Service, img *image.Image) (*running, error) {
+	c, err := s.newContainer(p, svc, img)
+	if err != nil {
+		return nil, err
+	}
+	if network := svc.network(); network != "" {
+		c.Pod = p.networkName(network)
+	}
+	id, err := s.cli.CreateContainer(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	// The daemon has joined it to its network.
+	if c, err = s.cli.InspectContainer(ctx, id); err != nil {
+		return nil, err
+	}
+	log.Infof("starting service %s, container %s", svc.Name, id)
+	if err := s.cli.StartContainer(ctx, id); err != nil {
+		if err := s.cli.RemoveContainer(context.Background(), id, true); err != nil {
+			log.WithError(err).Warnf("remove container %s", id)
+		}
+		return nil, err
+	}
+	r := &running{svc: svc, container: c, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		code, err := s.cli.WaitContainer(ctx, id)
+		switch {
+		case err != nil:
+			r.err = err
+		case code != 0:
+			r.err = errors.Errorf("exit status %d", code)
+		}
+		if err := s.cli.RemoveContainer(context.Background(), id, true); err != nil && !client.IsNotFound(err) {
+			log.WithError(err).Warnf("remove container %s", id)
+		}
+	}()
+	return r, nil
+}
+
+func (s *ComposeService) newContainer(p *Project, svc *Service, img *image.Image) (*container.Container, error) {
+	c := container.NewContainer(img, nil)
+	if svc.Entrypoint != nil {
+		c.Entrypoint = svc.Entrypoint
+	}
+	c.Cmd = svc.Command
+	for _, e := range svc.Environment {
+		kv, err := pkgenv.Normalize(e)
+		if err != nil {
+			return nil, err
+		}
+		if kv != "" {
+			c.Env = append(c.Env, kv)
+		}
+	}
+	c.WorkingDir = svc.WorkingDir
+	c.User = svc.User
+	c.Labels = map[string]string{}
+	for k, v := range svc.Labels {
+		c.Labels[k] = v
+	}
+	c.Labels[ProjectLabel] = p.Name
+	c.Labels[ServiceLabel] = svc.Name
+	for _, spec := range svc.Volumes {
+		m, err := container.ParseVolumeSpec(p.resolveVolumeSpec(spec))
+		if err != nil {
+			return nil, errors.Wrapf(err, "volume %q", spec)
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+	hc, err := svc.healthConfig()
+	if err != nil {
+		return nil, err
+	}
+	c.Healthcheck = hc
+	switch svc.NetworkMode {
+	case NetworkModeHost:
+		c.Network = container.NetworkHost
+	case NetworkModeNone:
+		c.Network = container.NetworkNone
+	default:
+		// Members of a network share its namespace, services are at
+		// localhost.
+		for _, other := range p.ServiceNames() {
+			if other != svc.Name && p.Services[other].network() == svc.network() {
+				c.ExtraHosts = append(c.ExtraHosts, other+":127.0.0.1")
+			}
+		}
+	}
+	return c, nil
+}
+
+// publishPorts forwards the published ports of r from the host into its
+// network namespace.
+func (s *ComposeService) publishPorts(r *running) ([]*portProxy, error) {
+	if len(r.svc.Ports) == 0 {
+		return nil, nil
+	}
+	if r.svc.NetworkMode == NetworkModeHost {
+		log.Warnf("service %s uses the host network, ignoring its ports", r.svc.Name)
+		return nil, nil
+	}
+	nsPath := r.container.NetworkNamespacePath()
+	var ret []*portProxy
+	for _, spec := range r.svc.Ports {
+		port, err := ParsePort(spec)
+		if err != nil {
+			return ret, err
+		}
+		proxy, err := startPortProxy(port, nsPath)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, proxy)
+	}
+	return ret, nil
+}
+
+// stopServices stops the running services, dependents first.
+func (s *ComposeService) stopServices(ctx context.Context, started []*running) {
+	for i := len(started) - 1; i >= 0; i-- {
+		r := started[i]
+		select {
+		case <-r.done:
+			continue
+		default:
+		}
+		log.Infof("stopping service %s", r.svc.Name)
+		if err := s.stopContainer(ctx, r); err != nil {
+			log.WithError(err).Warnf("stop service %s", r.svc.Name)
+		}
+	}
+}
+
+// stopContainer stops the container of r unless it has exited already.
+func (s *ComposeService) stopContainer(ctx context.Context, r *running) error {
+	err := s.cli.StopContainer(ctx, *r.container.ContainerID, container.DefaultStopTimeout)
+	if err != nil && !isGone(err) {
+		return err
+	}
+	return nil
+}
+
+// isGone reports whether err is from a container that has exited or been
+// removed.
+func isGone(err error) bool {
+	return client.IsNotFound(err) || client.IsConflict(err)
+}
+
+func (s *ComposeService) projectContainers(ctx context.Context, p *Project) ([]*container.Container, error) {
+	containers, err := s.cli.ListContainers(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*container.Container
+	for _, c := range containers {
+		if c.Labels[ProjectLabel] == p.Name {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// networks returns the networks the services of p use.
+func (p *Project) networks() []string {
+	seen := map[string]bool{}
+	var ret []string
+	for _, name := range p.ServiceNames() {
+		network := p.Services[name].network()
+		if network != "" && !seen[network] {
+			seen[network] = true
+			ret = append(ret, network)
+		}
+	}
+	return ret
+}
+
+func (p *Project) networkName(network string) string {
+	return p.Name + "_" + network
+}
+
+func (p *Project) volumeName(name string) string {
+	return p.Name + "_" + name
+}
+
+func (p *Project) labels(extra Labels) map[string]string {
+	ret := map[string]string{}
+	for k, v := range extra {
+		ret[k] = v
+	}
+	ret[ProjectLabel] = p.Name
+	return ret
+}
+
+// resolveVolumeSpec makes relative host paths absolute and prefixes volume
+// names with the project name.
+func (p *Project) resolveVolumeSpec(spec string) string {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) == 1 {
+		return spec
+	}
+	switch {
+	case strings.HasPrefix(parts[0], "."):
+		parts[0] = filepath.Join(p.Dir, parts[0])
+	case !isPath(parts[0]):
+		parts[0] = p.volumeName(parts[0])
+	}
+	return parts[0] + ":" + parts[1]
+}
+
+func sortedVolumes(p *Project) []string {
+	var ret []string
+	for name := range p.Volumes {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,84 @@
+package compose
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/exfly/container/container"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const proxyDialTimeout = 5 * time.Second
+
+// portProxy publishes a port of a service: it accepts connections on the
+// host and relays them to the port inside the network namespace of the
+// service.
+type portProxy struct {
+	ln     net.Listener
+	nsPath string
+	target string
+	wg     sync.WaitGroup
+}
+
+func startPortProxy(port Port, nsPath string) (*portProxy, error) {
+	if nsPath == "" {
+		return nil, errors.New("no network namespace to publish ports into")
+	}
+	addr := net.JoinHostPort(port.HostIP, strconv.Itoa(port.HostPort))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listen on %s", addr)
+	}
+	p := &portProxy{
+		ln:     ln,
+		nsPath: nsPath,
+		target: net.JoinHostPort("127.0.0.1", strconv.Itoa(port.ContainerPort)),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+func (p *portProxy) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.relay(conn)
+	}
+}
+
+func (p *portProxy) relay(conn net.Conn) {
+	defer conn.Close()
+	backend, err := container.DialInNamespace(p.nsPath, "tcp", p.target, proxyDialTimeout)
+	if err != nil {
+		log.WithError(err).Warnf("proxy %s to %s", p.ln.Addr(), p.target)
+		return
+	}
+	defer backend.Close()
+	done := make(chan struct{}, 2)
+	copyHalf := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go copyHalf(backend, conn)
+	go copyHalf(conn, backend)
+	<-done
+	<-done
+}
+
+// Close stops accepting connections.
+func (p *portProxy) Close() {
+	p.ln.Close()
+	p.wg.Wait()
+}
@@ -0,0 +1,524 @@
+package compose
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exfly/container/image"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultNetwork is the network of services that don't list any.
+	DefaultNetwork = "default"
+
+	NetworkModeHost = "host"
+	NetworkModeNone = "none"
+
+	ConditionStarted   = "service_started"
+	ConditionHealthy   = "service_healthy"
+	ConditionCompleted = "service_completed_successfully"
+)
+
+var invalidProjectChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// Project is a parsed stack file.
+type Project struct {
+	// Name prefixes the networks and volumes of the project, by default
+	// the name of the directory of the stack file.
+	Name string `yaml:"-"`
+	// Dir is the directory of the stack file, relative bind mounts are
+	// relative to it.
+	Dir      string              `yaml:"-"`
+	Services map[string]*Service `yaml:"services"`
+	Networks map[string]*Network `yaml:"networks"`
+	Volumes  map[string]*Volume  `yaml:"volumes"`
+}
+
+type Service struct {
+	Name        string       `yaml:"-"`
+	Image       string       `yaml:"image"`
+	Command     Command      `yaml:"command"`
+	Entrypoint  Command      `yaml:"entrypoint"`
+	Environment Environment  `yaml:"environment"`
+	WorkingDir  string       `yaml:"working_dir"`
+	User        string       `yaml:"user"`
+	Volumes     []string     `yaml:"volumes"`
+	Ports       []string     `yaml:"ports"`
+	Networks    NameList     `yaml:"networks"`
+	NetworkMode string       `yaml:"network_mode"`
+	DependsOn   DependsOn    `yaml:"depends_on"`
+	Healthcheck *Healthcheck `yaml:"healthcheck"`
+	Labels      Labels       `yaml:"labels"`
+}
+
+type Network struct {
+	Labels Labels `yaml:"labels"`
+}
+
+type Volume struct {
+	Labels Labels `yaml:"labels"`
+}
+
+type Healthcheck struct {
+	Test        Command `yaml:"test"`
+	Interval    string  `yaml:"interval"`
+	Timeout     string  `yaml:"timeout"`
+	StartPeriod string  `yaml:"start_period"`
+	Retries     int     `yaml:"retries"`
+	Disable     bool    `yaml:"disable"`
+}
+
+// Command is a command given as a string, split like a shell would, or a
+// list.
+type Command []string
+
+func (c *Command) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		args, err := splitCommand(value.Value)
+		if err != nil {
+			return err
+		}
+		*c = args
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// Environment is a list of KEY=VAL or a map. Variables without a value
+// are taken from the environment of up.
+type Environment []string
+
+func (e *Environment) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		*e = list
+		return nil
+	}
+	m := map[string]*string{}
+	if err := value.Decode(&m); err != nil {
+		return err
+	}
+	ret := make([]string, 0, len(m))
+	for k, v := range m {
+		if v == nil {
+			ret = append(ret, k)
+			continue
+		}
+		ret = append(ret, k+"="+*v)
+	}
+	sort.Strings(ret)
+	*e = ret
+	return nil
+}
+
+// Labels is a map or a list of key=value.
+type Labels map[string]string
+
+func (l *Labels) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		ret := Labels{}
+		for _, kv := range list {
+			parts := strings.SplitN(kv, "=", 2)
+			ret[parts[0]] = ""
+			if len(parts) == 2 {
+				ret[parts[0]] = parts[1]
+			}
+		}
+		*l = ret
+		return nil
+	}
+	m := map[string]string{}
+	if err := value.Decode(&m); err != nil {
+		return err
+	}
+	*l = m
+	return nil
+}
+
+// NameList is a list of names, or a map keyed by them.
+type NameList []string
+
+func (n *NameList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		*n = list
+		return nil
+	}
+	m := map[string]yaml.Node{}
+	if err := value.Decode(&m); err != nil {
+		return err
+	}
+	*n = sortedKeys(m)
+	return nil
+}
+
+// DependsOn maps the services a service depends on to the condition they
+// must meet before it starts. The list form means service_started.
+type DependsOn map[string]string
+
+func (d *DependsOn) UnmarshalYAML(value *yaml.Node) error {
+	ret := DependsOn{}
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		for _, name := range list {
+			ret[name] = ConditionStarted
+		}
+		*d = ret
+		return nil
+	}
+	m := map[string]struct {
+		Condition string `yaml:"condition"`
+	}{}
+	if err := value.Decode(&m); err != nil {
+		return err
+	}
+	for name, dep := range m {
+		if dep.Condition == "" {
+			dep.Condition = ConditionStarted
+		}
+		ret[name] = dep.Condition
+	}
+	*d = ret
+	return nil
+}
+
+// Port is a published TCP port.
+type Port struct {
+	HostIP        string
+	HostPort      int
+	ContainerPort int
+}
+
+// ParsePort parses [[ip:]host-port:]container-port[/tcp].
+func ParsePort(spec string) (Port, error) {
+	var p Port
+	s := spec
+	if i := strings.LastIndex(s, "/"); i != -1 {
+		if s[i+1:] != "tcp" {
+			return p, errors.Errorf("unsupported protocol in port %q, only tcp is", spec)
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ":")
+	var hostPort, containerPort string
+	switch len(parts) {
+	case 1:
+		hostPort, containerPort = parts[0], parts[0]
+	case 2:
+		hostPort, containerPort = parts[0], parts[1]
+	case 3:
+		p.HostIP, hostPort, containerPort = parts[0], parts[1], parts[2]
+	default:
+		return p, errors.Errorf("invalid port %q", spec)
+	}
+	var err error
+	if p.HostPort, err = parsePortNumber(hostPort); err != nil {
+		return p, errors.Wrapf(err, "invalid port %q", spec)
+	}
+	if p.ContainerPort, err = parsePortNumber(containerPort); err != nil {
+		return p, errors.Wrapf(err, "invalid port %q", spec)
+	}
+	return p, nil
+}
+
+func parsePortNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 || n > 65535 {
+		return 0, errors.Errorf("port number %q out of range", s)
+	}
+	return n, nil
+}
+
+// Load reads the stack file at path. An empty name defaults to the name of
+// its directory.
+func Load(path, name string) (*Project, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	p.Dir = filepath.Dir(abs)
+	if name == "" {
+		name = filepath.Base(p.Dir)
+	}
+	p.Name = invalidProjectChars.ReplaceAllString(strings.ToLower(name), "")
+	if p.Name == "" {
+		return nil, errors.Errorf("invalid project name %q", name)
+	}
+	return p, nil
+}
+
+// Parse parses and validates the content of a stack file.
+func Parse(content []byte) (*Project, error) {
+	var p Project
+	if err := yaml.Unmarshal(content, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Services) == 0 {
+		return nil, errors.New("no services defined")
+	}
+	for name, svc := range p.Services {
+		if svc == nil {
+			return nil, errors.Errorf("service %s has no image", name)
+		}
+		svc.Name = name
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Project) validate() error {
+	for _, name := range p.ServiceNames() {
+		svc := p.Services[name]
+		if svc.Image == "" {
+			return errors.Errorf("service %s has no image", name)
+		}
+		if _, err := image.NewImage(svc.Image); err != nil {
+			return errors.Wrapf(err, "service %s", name)
+		}
+		for dep, cond := range svc.DependsOn {
+			if _, ok := p.Services[dep]; !ok {
+				return errors.Errorf("service %s depends on undefined service %s", name, dep)
+			}
+			switch cond {
+			case ConditionStarted, ConditionHealthy, ConditionCompleted:
+			default:
+				return errors.Errorf("service %s: unsupported condition %q", name, cond)
+			}
+		}
+		switch svc.NetworkMode {
+		case "":
+			if len(svc.Networks) > 1 {
+				return errors.Errorf("service %s: only one network per service is supported", name)
+			}
+			for _, n := range svc.Networks {
+				if _, ok := p.Networks[n]; !ok && n != DefaultNetwork {
+					return errors.Errorf("service %s refers to undefined network %s", name, n)
+				}
+			}
+		case NetworkModeHost, NetworkModeNone:
+			if len(svc.Networks) != 0 {
+				return errors.Errorf("service %s: network_mode conflicts with networks", name)
+			}
+			if svc.NetworkMode == NetworkModeNone && len(svc.Ports) != 0 {
+				return errors.Errorf("service %s: ports need a network", name)
+			}
+		default:
+			return errors.Errorf("service %s: unsupported network_mode %q", name, svc.NetworkMode)
+		}
+		for _, spec := range svc.Ports {
+			if _, err := ParsePort(spec); err != nil {
+				return errors.Wrapf(err, "service %s", name)
+			}
+		}
+		for _, spec := range svc.Volumes {
+			source := strings.SplitN(spec, ":", 2)[0]
+			if !strings.Contains(spec, ":") || isPath(source) {
+				continue
+			}
+			if _, ok := p.Volumes[source]; !ok {
+				return errors.Errorf("service %s refers to undefined volume %s", name, source)
+			}
+		}
+		if _, err := svc.healthConfig(); err != nil {
+			return errors.Wrapf(err, "service %s", name)
+		}
+	}
+	_, err := p.Order()
+	return err
+}
+
+// ServiceNames returns the names of the services, sorted.
+func (p *Project) ServiceNames() []string {
+	return sortedKeys(p.Services)
+}
+
+// Order returns the services sorted so that each comes after the services
+// it depends on.
+func (p *Project) Order() ([]*Service, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	var ret []*Service
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return errors.Errorf("dependency cycle through service %s", name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		svc := p.Services[name]
+		for _, dep := range sortedKeys(svc.DependsOn) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		ret = append(ret, svc)
+		return nil
+	}
+	for _, name := range p.ServiceNames() {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// network returns the network of svc, empty with a network_mode.
+func (svc *Service) network() string {
+	if svc.NetworkMode != "" {
+		return ""
+	}
+	if len(svc.Networks) == 0 {
+		return DefaultNetwork
+	}
+	return svc.Networks[0]
+}
+
+func (svc *Service) healthConfig() (*image.HealthConfig, error) {
+	hc := svc.Healthcheck
+	if hc == nil {
+		return nil, nil
+	}
+	if hc.Disable {
+		return &image.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+	ret := &image.HealthConfig{Retries: hc.Retries}
+	switch {
+	case len(hc.Test) == 0:
+	case hc.Test[0] == "CMD" || hc.Test[0] == "CMD-SHELL" || hc.Test[0] == "NONE":
+		ret.Test = hc.Test
+	default:
+		// A string test is run by the shell.
+		ret.Test = []string{"CMD-SHELL", strings.Join(hc.Test, " ")}
+	}
+	for _, d := range []struct {
+		value string
+		to    *time.Duration
+	}{
+		{hc.Interval, &ret.Interval},
+		{hc.Timeout, &ret.Timeout},
+		{hc.StartPeriod, &ret.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		var err error
+		if *d.to, err = time.ParseDuration(d.value); err != nil {
+			return nil, errors.Wrap(err, "healthcheck")
+		}
+	}
+	return ret, nil
+}
+
+// isPath reports whether the source of a volume is a host path rather than
+// a volume name.
+func isPath(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".")
+}
+
+func sortedKeys(m interface{}) []string {
+	var ret []string
+	switch m := m.(type) {
+	case map[string]*Service:
+		for k := range m {
+			ret = append(ret, k)
+		}
+	case DependsOn:
+		for k := range m {
+			ret = append(ret, k)
+		}
+	case map[string]yaml.Node:
+		for k := range m {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// splitCommand splits s into words the way a shell would, honouring single
+// and double quotes and backslashes.
+func splitCommand(s string) ([]string, error) {
+	var (
+		ret     []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				ret = append(ret, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		ret = append(ret, word.String())
+	}
+	return ret, nil
+}
@@ -0,0 +1,83 @@
+package compose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStack = `
+services:
+  web:
+    image: nginx
+    command: nginx -g 'daemon off;'
+    environment:
+      A: "1"
+      B:
+    ports: ["8080:80"]
+    depends_on:
+      db:
+        condition: service_healthy
+  db:
+    image: postgres
+    healthcheck:
+      test: pg_isready
+      interval: 1s
+  worker:
+    image: busybox
+    command: ["sh", "-c", "work"]
+    networks: [back]
+    depends_on: [db, web]
+networks:
+  back:
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testStack))
+	assert.NoError(t, err)
+	web := p.Services["web"]
+	assert.Equal(t, Command{"nginx", "-g", "daemon off;"}, web.Command)
+	assert.Equal(t, Environment{"A=1", "B"}, web.Environment)
+	assert.Equal(t, DependsOn{"db": ConditionHealthy}, web.DependsOn)
+	assert.Equal(t, DependsOn{"db": ConditionStarted, "web": ConditionStarted}, p.Services["worker"].DependsOn)
+	assert.Equal(t, []string{DefaultNetwork, "back"}, p.networks())
+
+	hc, err := p.Services["db"].healthConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CMD-SHELL", "pg_isready"}, hc.Test)
+
+	order, err := p.Order()
+	assert.NoError(t, err)
+	var names []string
+	for _, svc := range order {
+		names = append(names, svc.Name)
+	}
+	assert.Equal(t, []string{"db", "web", "worker"}, names)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, stack := range []string{
+		"services: {}",
+		"services: {a: {command: x}}",
+		"services: {a: {image: x, depends_on: [b]}}",
+		"services: {a: {image: x, depends_on: [b]}, b: {image: x, depends_on: [a]}}",
+		"services: {a: {image: x, networks: [nope]}}",
+		"services: {a: {image: x, volumes: ['nope:/data']}}",
+		"services: {a: {image: x, network_mode: none, ports: ['80']}}",
+		"services: {a: {image: x, ports: ['53/udp']}}",
+	} {
+		_, err := Parse([]byte(stack))
+		assert.Error(t, err, stack)
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	p, err := ParsePort("127.0.0.1:8080:80/tcp")
+	assert.NoError(t, err)
+	assert.Equal(t, Port{HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80}, p)
+	p, err = ParsePort("80")
+	assert.NoError(t, err)
+	assert.Equal(t, Port{HostPort: 80, ContainerPort: 80}, p)
+	_, err = ParsePort("0:80")
+	assert.Error(t, err)
+}
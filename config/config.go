@@ -1,9 +1,42 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+
 	pkgdirs "github.com/exfly/container/pkg/dirs"
 )
 
+const rootHomePath = "/home/vagrant/containerd"
+
+// HomeEnv overrides the home path. child-mode inherits it from its parent,
+// as root in a user namespace it couldn't tell it runs rootless.
+const HomeEnv = "CONTAINERD_HOME"
+
+// SocketEnv overrides the path of the daemon socket.
+const SocketEnv = "CONTAINERD_SOCKET"
+
+// IsRootless reports whether we run without root privileges.
+func IsRootless() bool {
+	return os.Geteuid() != 0
+}
+
+// DefaultHomePath is where state is kept: $CONTAINERD_HOME if set, else a
+// system directory for root and $XDG_DATA_HOME/containerd in rootless mode.
+func DefaultHomePath() string {
+	if home := os.Getenv(HomeEnv); home != "" {
+		return home
+	}
+	if !IsRootless() {
+		return rootHomePath
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return filepath.Join(dataHome, "containerd")
+}
+
 func NewHome(b string) *Home {
 	ret := &Home{
 		homePath: b,
@@ -31,11 +64,39 @@ func (h *Home) ContainersPath() string {
 	return h.HomePath() + "/containers"
 }
 
+func (h *Home) VolumesPath() string {
+	return h.HomePath() + "/volumes"
+}
+
+func (h *Home) PodsPath() string {
+	return h.HomePath() + "/pods"
+}
+
 func (h *Home) NetNsPath() string {
 	return h.HomePath() + "/net-ns"
 }
 
+// SocketPath is the unix socket the daemon listens on, $CONTAINERD_SOCKET if
+// set.
+func (h *Home) SocketPath() string {
+	if path := os.Getenv(SocketEnv); path != "" {
+		return path
+	}
+	return h.HomePath() + "/containerd.sock"
+}
+
+// CRISocketPath is the unix socket the CRI server listens on.
+func (h *Home) CRISocketPath() string {
+	return h.HomePath() + "/cri.sock"
+}
+
+// HooksPath holds OCI hook configs, one JSON file each, for the hooks to
+// add to the containers they match.
+func (h *Home) HooksPath() string {
+	return h.HomePath() + "/hooks.d"
+}
+
 func (h *Home) InitDirs() (err error) {
-	dirs := []string{h.HomePath(), h.TempPath(), h.ImagesPath(), h.ImagesPath(), h.NetNsPath()}
+	dirs := []string{h.HomePath(), h.TempPath(), h.ImagesPath(), h.ContainersPath(), h.VolumesPath(), h.PodsPath(), h.NetNsPath(), h.HooksPath()}
 	return pkgdirs.CreateDirsIfDontExist(dirs)
 }
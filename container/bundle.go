@@ -0,0 +1,527 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// execFifoName is the fifo in the home of a container created from a
+// bundle. Its process blocks opening it until StartCreated reads from it.
+const execFifoName = "exec.fifo"
+
+// builtinMounts are set up in every container, bundle mounts at these
+// destinations are left out.
+var builtinMounts = map[string]bool{
+	"/proc":          true,
+	"/sys":           true,
+	"/sys/fs/cgroup": true,
+	"/dev":           true,
+	"/dev/pts":       true,
+	"/dev/shm":       true,
+	"/dev/mqueue":    true,
+	"/tmp":           true,
+}
+
+// LoadBundle reads the config.json of the OCI bundle at dir into a
+// container with ID id.
+func LoadBundle(dir, id string) (*Container, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "read bundle config")
+	}
+	var spec specs.Spec
+	if err := json.Unmarshal(content, &spec); err != nil {
+		return nil, errors.Wrap(err, "parse bundle config")
+	}
+	container, err := FromSpec(&spec, dir)
+	if err != nil {
+		return nil, err
+	}
+	container.ContainerID = &id
+	return container, nil
+}
+
+// FromSpec turns an OCI runtime spec into a container created from the
+// bundle at dir. Namespaces missing from the spec are shared with the host.
+// The container runs with the spec itself.
+func FromSpec(spec *specs.Spec, dir string) (*Container, error) {
+	if spec.Process == nil {
+		return nil, errors.New("bundle config has no process")
+	}
+	if spec.Root == nil || spec.Root.Path == "" {
+		return nil, errors.New("bundle config has no root")
+	}
+	if spec.Linux == nil {
+		return nil, errors.New("bundle config has no linux section")
+	}
+	process := spec.Process
+	if process.Terminal {
+		return nil, errors.New("terminal is not supported")
+	}
+	container := &Container{
+		Bundle:          dir,
+		Rootfs:          bundlePath(dir, spec.Root.Path),
+		ReadonlyRootfs:  spec.Root.Readonly,
+		Hostname:        spec.Hostname,
+		Labels:          spec.Annotations,
+		Args:            process.Args,
+		Env:             process.Env,
+		WorkingDir:      process.Cwd,
+		User:            fmt.Sprintf("%d:%d", process.User.UID, process.User.GID),
+		NoNewPrivileges: process.NoNewPrivileges,
+		Capabilities:    specCapabilities(process.Capabilities),
+		Hooks:           specHooks(spec.Hooks),
+		State:           &State{Status: StatusCreated},
+	}
+	ulimits, err := specUlimits(process.Rlimits)
+	if err != nil {
+		return nil, err
+	}
+	container.Ulimits = ulimits
+	if container.Mounts, err = specMounts(spec.Mounts, dir); err != nil {
+		return nil, err
+	}
+	if err := applySpecLinux(container, spec.Linux); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+func applySpecLinux(container *Container, linux *specs.Linux) error {
+	namespaces := map[specs.LinuxNamespaceType]specs.LinuxNamespace{}
+	for _, ns := range linux.Namespaces {
+		namespaces[ns.Type] = ns
+	}
+	mode := func(t specs.LinuxNamespaceType) string {
+		ns, ok := namespaces[t]
+		switch {
+		case !ok:
+			return NamespaceHost
+		case ns.Path != "":
+			return nsPathPrefix + ns.Path
+		default:
+			return ""
+		}
+	}
+	if ns, ok := namespaces[specs.MountNamespace]; !ok || ns.Path != "" {
+		return errors.New("the container needs a mount namespace of its own")
+	}
+	if ns, ok := namespaces[specs.UserNamespace]; ok {
+		if ns.Path != "" {
+			return errors.New("joining a user namespace is not supported")
+		}
+		if len(linux.UIDMappings) == 0 || len(linux.GIDMappings) == 0 {
+			return errors.New("a user namespace needs uid and gid mappings")
+		}
+	} else if len(linux.UIDMappings) != 0 || len(linux.GIDMappings) != 0 {
+		return errors.New("uid and gid mappings need a user namespace")
+	}
+	container.PidMode = mode(specs.PIDNamespace)
+	container.IpcMode = mode(specs.IPCNamespace)
+	container.UtsMode = mode(specs.UTSNamespace)
+	switch container.Network = mode(specs.NetworkNamespace); container.Network {
+	case NamespaceHost:
+		container.Network = NetworkHost
+	case "":
+		container.Network = NetworkNone
+	}
+	for _, m := range linux.UIDMappings {
+		container.UIDMappings = append(container.UIDMappings, IDMap{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+	for _, m := range linux.GIDMappings {
+		container.GIDMappings = append(container.GIDMappings, IDMap{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+
+	container.Sysctls = linux.Sysctl
+	container.RootfsPropagation = linux.RootfsPropagation
+	// Unlike docker, a bundle has no default masked or read only paths.
+	container.MaskedPaths = append([]string{}, linux.MaskedPaths...)
+	container.ReadonlyPaths = append([]string{}, linux.ReadonlyPaths...)
+	devices, err := specDevices(linux.Devices)
+	if err != nil {
+		return err
+	}
+	container.Devices = devices
+	if linux.Seccomp == nil {
+		container.SecurityOpt = []string{"seccomp=unconfined"}
+	} else {
+		if container.Seccomp, err = specSeccomp(linux.Seccomp); err != nil {
+			return err
+		}
+	}
+	if r := linux.Resources; r != nil {
+		if len(r.Devices) != 0 {
+			log.Debug("device cgroup rules are derived from the devices, ignoring the bundle ones")
+		}
+		if m := r.Memory; m != nil {
+			if m.Limit != nil {
+				container.Mem = int(*m.Limit)
+			}
+			if m.Swap != nil {
+				container.Swap = int(*m.Swap)
+			}
+		}
+		if p := r.Pids; p != nil {
+			container.Pids = int(p.Limit)
+		}
+		if cpu := r.CPU; cpu != nil {
+			if cpu.Quota != nil && *cpu.Quota > 0 {
+				period := uint64(cpuPeriod)
+				if cpu.Period != nil && *cpu.Period != 0 {
+					period = *cpu.Period
+				}
+				container.Cpus = float64(*cpu.Quota) / float64(period)
+			}
+			if cpu.Shares != nil {
+				container.CPUShares = *cpu.Shares
+			}
+		}
+	}
+	return nil
+}
+
+// specMounts converts the mounts of a spec other than the builtin ones, with
+// relative sources in dir.
+func specMounts(mounts []specs.Mount, dir string) ([]Mount, error) {
+	var ret []Mount
+	for _, m := range mounts {
+		if builtinMounts[filepath.Clean(m.Destination)] {
+			continue
+		}
+		mount, err := specMount(m, dir)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mount)
+	}
+	return ret, nil
+}
+
+// specMount converts a bind or tmpfs bundle mount. Options other than ro,
+// size and mode are ignored.
+func specMount(m specs.Mount, dir string) (Mount, error) {
+	ret := Mount{Destination: m.Destination}
+	bind := m.Type == "bind"
+	for _, opt := range m.Options {
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case opt == "bind" || opt == "rbind":
+			bind = true
+		case opt == "ro":
+			ret.ReadOnly = true
+		case kv[0] == "size" && len(kv) == 2:
+			size, err := parseSize(kv[1])
+			if err != nil {
+				return ret, errors.Errorf("invalid size in mount options %q", opt)
+			}
+			ret.TmpfsSize = size
+		case kv[0] == "mode" && len(kv) == 2:
+			mode, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil {
+				return ret, errors.Errorf("invalid mode in mount options %q", opt)
+			}
+			ret.TmpfsMode = os.FileMode(mode)
+		}
+	}
+	switch {
+	case bind:
+		ret.Type = MountTypeBind
+		ret.Source = bundlePath(dir, m.Source)
+		ret.TmpfsSize, ret.TmpfsMode = 0, 0
+	case m.Type == "tmpfs":
+		ret.Type = MountTypeTmpfs
+	default:
+		return ret, errors.Errorf("unsupported mount type %q at %s", m.Type, m.Destination)
+	}
+	return ret, ret.validate()
+}
+
+// parseSize parses a size in bytes with an optional k, m or g suffix.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		mult = 1 << 10
+	case "m":
+		mult = 1 << 20
+	case "g":
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n * mult, err
+}
+
+func specDevices(devices []specs.LinuxDevice) ([]Device, error) {
+	var ret []Device
+	for _, d := range devices {
+		device, err := specDevice(d)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, device)
+	}
+	return ret, nil
+}
+
+func specDevice(d specs.LinuxDevice) (Device, error) {
+	ret := Device{
+		PathInContainer: d.Path,
+		Major:           d.Major,
+		Minor:           d.Minor,
+		FileMode:        0666,
+		Permissions:     "rwm",
+	}
+	switch d.Type {
+	case "c", "u":
+		ret.Type = 'c'
+	case "b":
+		ret.Type = 'b'
+	default:
+		return ret, errors.Errorf("unsupported device type %q for %s", d.Type, d.Path)
+	}
+	if d.FileMode != nil {
+		ret.FileMode = *d.FileMode
+	}
+	if d.UID != nil {
+		ret.Uid = *d.UID
+	}
+	if d.GID != nil {
+		ret.Gid = *d.GID
+	}
+	return ret, nil
+}
+
+// bundlePath resolves p, relative to the bundle directory unless absolute.
+func bundlePath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// bindRootfs binds the bundle rootfs of container at target.
+func bindRootfs(container *Container, target string) error {
+	if err := unix.Mount(container.Rootfs, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.Wrapf(err, "bind rootfs %s", container.Rootfs)
+	}
+	return nil
+}
+
+func (c *ContainerService) execFifoPath(container *Container) string {
+	return c.GetContainerHome(container) + "/" + execFifoName
+}
+
+// CreateFromBundle creates container and starts its process, which sets the
+// container up and waits for StartCreated to run. Nobody waits for it:
+// the caller may exit, and the container stays created.
+func (c *ContainerService) CreateFromBundle(ctx context.Context, container *Container) error {
+	if _, err := c.Inspect(*container.ContainerID); err == nil {
+		return errors.Errorf("container %s already exists", *container.ContainerID)
+	}
+	if err := c.Create(container); err != nil {
+		return err
+	}
+	err := unix.Mkfifo(c.execFifoPath(container), 0622)
+	if err == nil {
+		err = c.mountRootfs(container)
+	}
+	if err != nil {
+		c.removeContainer(container)
+		return errors.Wrap(err, "create container")
+	}
+	// The process gets our streams, as runc without a terminal does.
+	if _, err := c.startProcess(ctx, container, stdio{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}); err != nil {
+		c.unmountRootfs(container)
+		c.removeContainer(container)
+		return err
+	}
+	c.updateContainer(container, func() {
+		container.State.Status = StatusCreated
+	})
+	return nil
+}
+
+// StartCreated lets the process of a container created from a bundle run.
+func (c *ContainerService) StartCreated(containerID string) error {
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if c.OCIStatus(container) != specs.StateCreated || container.Bundle == "" {
+		return errors.Errorf("container %s is not a created bundle container", containerID)
+	}
+	started := make(chan error, 1)
+	go func() {
+		// Blocks until the container process opens the fifo for writing,
+		// then reads until it closes it.
+		f, err := os.Open(c.execFifoPath(container))
+		if err == nil {
+			_, err = ioutil.ReadAll(f)
+			f.Close()
+		}
+		started <- err
+	}()
+	for done := false; !done; {
+		select {
+		case err := <-started:
+			if err != nil {
+				return errors.Wrapf(err, "start container %s", containerID)
+			}
+			done = true
+		case <-time.After(logPollInterval):
+			if !processAlive(container.State.Pid) {
+				return errors.Errorf("container %s exited before it was started", containerID)
+			}
+		}
+	}
+	os.Remove(c.execFifoPath(container))
+	c.updateContainer(container, func() {
+		container.State.Status = StatusRunning
+		container.State.StartedAt = time.Now()
+	})
+	if spec := c.loadSpecOrWarn(container); spec != nil {
+		runPostHooks(spec, HookPoststart, c.hookState(container, spec, specs.StateRunning, container.State.Pid))
+	}
+	return nil
+}
+
+// ociStatePaused is the status runc reports paused containers with, which
+// the runtime spec leaves to runtimes.
+const ociStatePaused specs.ContainerState = "paused"
+
+// OCIStatus is the status of container as OCI runtimes report it. Whether
+// a process runs is checked, nobody may have recorded its exit.
+func (c *ContainerService) OCIStatus(container *Container) specs.ContainerState {
+	pid := container.State.Pid
+	switch {
+	case pid != 0 && processAlive(pid) && container.State.Status == StatusCreated:
+		return specs.StateCreated
+	case pid != 0 && processAlive(pid) && container.State.Paused:
+		return ociStatePaused
+	case pid != 0 && processAlive(pid):
+		return specs.StateRunning
+	case pid == 0 && container.State.Status == StatusCreated:
+		return specs.StateCreated
+	default:
+		return specs.StateStopped
+	}
+}
+
+// OCIState returns the OCI state of a container.
+func (c *ContainerService) OCIState(containerID string) (*specs.State, error) {
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return nil, err
+	}
+	state := &specs.State{
+		Version:     specs.Version,
+		ID:          containerID,
+		Status:      c.OCIStatus(container),
+		Bundle:      container.Bundle,
+		Annotations: container.Labels,
+	}
+	if state.Status != specs.StateStopped {
+		state.Pid = processPid(container.State.Pid)
+	}
+	return state, nil
+}
+
+// processPid returns the pid of the container process child-mode with pid
+// runs, or pid until it has started it. Child-mode starts it from its main
+// thread.
+func processPid(pid int) int {
+	children, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/children", pid, pid))
+	if err != nil {
+		return pid
+	}
+	fields := strings.Fields(string(children))
+	if len(fields) == 0 {
+		return pid
+	}
+	child, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return pid
+	}
+	return child
+}
+
+// Delete removes a container whose process nobody waits for. With force a
+// running one is killed first, a created one always is.
+func (c *ContainerService) Delete(containerID string, force bool) error {
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	switch c.OCIStatus(container) {
+	case specs.StateRunning, ociStatePaused:
+		if !force {
+			return errors.Wrapf(ErrRunning, "%s, stop it first or force deletion", containerID)
+		}
+		fallthrough
+	case specs.StateCreated:
+		if pid := container.State.Pid; pid != 0 {
+			if err := unix.Kill(pid, unix.SIGKILL); err != nil && err != unix.ESRCH {
+				return errors.Wrapf(err, "kill container %s", containerID)
+			}
+			c.thawSignaled(container)
+			if !waitForExit(pid, DefaultStopTimeout) {
+				return errors.Errorf("container %s did not exit", containerID)
+			}
+		}
+	}
+	if err := c.unmountRootfs(container); err != nil {
+		log.WithError(err).Debug("unmount rootfs")
+	}
+	// Nobody waited for the process to run them when it exited.
+	if spec := c.loadSpecOrWarn(container); spec != nil {
+		runPostHooks(spec, HookPoststop, c.hookState(container, spec, specs.StateStopped, 0))
+	}
+	return c.removeContainer(container)
+}
+
+// openExecFifo opens the exec fifo of container for waitForStart, -1 if it
+// wasn't created from a bundle. The fd outlives the switch to the rootfs.
+func (c *ContainerService) openExecFifo(container *Container) (int, error) {
+	fd, err := unix.Open(c.execFifoPath(container), unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err == unix.ENOENT {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "open exec fifo")
+	}
+	return fd, nil
+}
+
+// waitForStart blocks until StartCreated reads from the exec fifo.
+func waitForStart(fd int) error {
+	if fd < 0 {
+		return nil
+	}
+	defer unix.Close(fd)
+	f, err := os.OpenFile(fmt.Sprintf("/proc/self/fd/%d", fd), os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "open exec fifo")
+	}
+	defer f.Close()
+	_, err = f.Write([]byte{0})
+	return errors.Wrap(err, "write exec fifo")
+}
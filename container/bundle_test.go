@@ -0,0 +1,61 @@
+package container
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromSpec(t *testing.T) {
+	limit := int64(64 << 20)
+	quota := int64(50000)
+	spec := &specs.Spec{
+		Root:     &specs.Root{Path: "rootfs", Readonly: true},
+		Hostname: "box",
+		Process: &specs.Process{
+			Args:    []string{"sh"},
+			Cwd:     "/",
+			User:    specs.User{UID: 1000, GID: 100},
+			Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: ^uint64(0)}},
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/data", Type: "bind", Source: "data", Options: []string{"rbind", "ro"}},
+			{Destination: "/run", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "size=64k", "mode=755"}},
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.MountNamespace},
+				{Type: specs.PIDNamespace},
+				{Type: specs.NetworkNamespace, Path: "/var/run/netns/x"},
+			},
+			Resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: &limit},
+				CPU:    &specs.LinuxCPU{Quota: &quota},
+			},
+		},
+	}
+	c, err := FromSpec(spec, "/bundle")
+	require.NoError(t, err)
+	assert.Equal(t, "/bundle/rootfs", c.Rootfs)
+	assert.True(t, c.ReadonlyRootfs)
+	assert.Equal(t, "1000:100", c.User)
+	assert.Equal(t, []Ulimit{{Name: "nofile", Soft: 1024, Hard: -1}}, c.Ulimits)
+	assert.Equal(t, []Mount{
+		{Type: MountTypeBind, Source: "/bundle/data", Destination: "/data", ReadOnly: true},
+		{Type: MountTypeTmpfs, Destination: "/run", TmpfsSize: 64 << 10, TmpfsMode: 0755},
+	}, c.Mounts)
+	assert.Equal(t, "", c.PidMode)
+	assert.Equal(t, NamespaceHost, c.IpcMode)
+	assert.Equal(t, "ns:/var/run/netns/x", c.Network)
+	assert.Equal(t, int(limit), c.Mem)
+	assert.Equal(t, 0.5, c.Cpus)
+	assert.Equal(t, []string{"seccomp=unconfined"}, c.SecurityOpt)
+	assert.NotNil(t, c.MaskedPaths)
+
+	spec.Linux.Namespaces = spec.Linux.Namespaces[1:]
+	_, err = FromSpec(spec, "/bundle")
+	assert.Error(t, err, "no mount namespace")
+}
@@ -0,0 +1,264 @@
+package container
+
+import (
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var capabilityNumbers = map[string]uint{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// defaultCapabilities is the docker default set.
+var defaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// Capabilities are the capability sets of the container process, by name.
+type Capabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+func normalizeCapability(name string) (string, error) {
+	name = strings.ToUpper(name)
+	if name == "ALL" {
+		return name, nil
+	}
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	if _, ok := capabilityNumbers[name]; !ok {
+		return "", errors.Errorf("unknown capability %q", name)
+	}
+	return name, nil
+}
+
+func allCapabilities() []string {
+	last := lastCapability()
+	var ret []string
+	for name, n := range capabilityNumbers {
+		if n <= last {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// tweakCapabilities applies --cap-add and --cap-drop to base the way docker
+// does: ALL in adds grants everything but the drops, ALL in drops starts
+// from nothing but the adds.
+func tweakCapabilities(base, adds, drops []string) ([]string, error) {
+	set := map[string]bool{}
+	addAll, dropAll := false, false
+	normAdds, normDrops := map[string]bool{}, map[string]bool{}
+	for _, c := range adds {
+		n, err := normalizeCapability(c)
+		if err != nil {
+			return nil, err
+		}
+		addAll = addAll || n == "ALL"
+		normAdds[n] = true
+	}
+	for _, c := range drops {
+		n, err := normalizeCapability(c)
+		if err != nil {
+			return nil, err
+		}
+		dropAll = dropAll || n == "ALL"
+		normDrops[n] = true
+	}
+
+	switch {
+	case addAll:
+		for _, c := range allCapabilities() {
+			set[c] = true
+		}
+	case dropAll:
+	default:
+		for _, c := range base {
+			set[c] = true
+		}
+	}
+	for c := range normDrops {
+		delete(set, c)
+	}
+	if !addAll {
+		for c := range normAdds {
+			set[c] = true
+		}
+	}
+	ret := make([]string, 0, len(set))
+	for c := range set {
+		ret = append(ret, c)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// newCapabilities returns the sets for caps. Ambient stays empty, like in
+// docker, so processes running as a non-root user end up without any.
+func newCapabilities(caps []string) *Capabilities {
+	return &Capabilities{
+		Bounding:    caps,
+		Effective:   caps,
+		Permitted:   caps,
+		Inheritable: caps,
+	}
+}
+
+func lastCapability() uint {
+	content, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return capabilityNumbers["CAP_AUDIT_READ"]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return capabilityNumbers["CAP_AUDIT_READ"]
+	}
+	return uint(n)
+}
+
+func capabilityMask(names []string) (uint64, error) {
+	var mask uint64
+	for _, name := range names {
+		n, ok := capabilityNumbers[name]
+		if !ok {
+			return 0, errors.Errorf("unknown capability %q", name)
+		}
+		mask |= 1 << n
+	}
+	return mask, nil
+}
+
+// applyCapabilities restricts the calling thread to caps, so that a process
+// forked from it inherits them. The caller must have locked the OS thread;
+// capability sets are per thread. Effective and permitted keep what the
+// forked child needs before exec (chroot through /proc/<pid>/root, switching
+// user); the kernel recomputes them from the bounding, inheritable and
+// ambient sets at exec.
+func applyCapabilities(caps *Capabilities) error {
+	bounding, err := capabilityMask(caps.Bounding)
+	if err != nil {
+		return err
+	}
+	for n := uint(0); n <= lastCapability(); n++ {
+		if bounding&(1<<n) != 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(n), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return errors.Wrapf(err, "drop capability %d from bounding set", n)
+		}
+	}
+
+	effective, err := capabilityMask(caps.Effective)
+	if err != nil {
+		return err
+	}
+	permitted, err := capabilityMask(caps.Permitted)
+	if err != nil {
+		return err
+	}
+	inheritable, err := capabilityMask(caps.Inheritable)
+	if err != nil {
+		return err
+	}
+	ambient, err := capabilityMask(caps.Ambient)
+	if err != nil {
+		return err
+	}
+	beforeExec, _ := capabilityMask([]string{"CAP_SETUID", "CAP_SETGID", "CAP_SYS_CHROOT", "CAP_SYS_PTRACE"})
+	effective |= beforeExec | ambient
+	permitted |= beforeExec | ambient
+	inheritable |= ambient
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{
+		{Effective: uint32(effective), Permitted: uint32(permitted), Inheritable: uint32(inheritable)},
+		{Effective: uint32(effective >> 32), Permitted: uint32(permitted >> 32), Inheritable: uint32(inheritable >> 32)},
+	}
+	return errors.Wrap(unix.Capset(&hdr, &data[0]), "capset")
+}
+
+// ambientCaps returns the ambient set in the form SysProcAttr.AmbientCaps
+// wants.
+func ambientCaps(caps *Capabilities) []uintptr {
+	var ret []uintptr
+	for _, name := range caps.Ambient {
+		if n, ok := capabilityNumbers[name]; ok {
+			ret = append(ret, uintptr(n))
+		}
+	}
+	return ret
+}
+
+// hasCapability reports whether set has the capability name.
+func hasCapability(set []string, name string) bool {
+	for _, c := range set {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
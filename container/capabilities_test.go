@@ -0,0 +1,26 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTweakCapabilities(t *testing.T) {
+	caps, err := tweakCapabilities([]string{"CAP_CHOWN", "CAP_KILL"}, []string{"net_admin"}, []string{"CHOWN"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CAP_KILL", "CAP_NET_ADMIN"}, caps)
+
+	caps, err = tweakCapabilities(defaultCapabilities, []string{"SYS_ADMIN"}, []string{"ALL"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CAP_SYS_ADMIN"}, caps)
+
+	caps, err = tweakCapabilities(nil, []string{"ALL"}, []string{"SYS_ADMIN"})
+	require.NoError(t, err)
+	assert.Contains(t, caps, "CAP_CHOWN")
+	assert.NotContains(t, caps, "CAP_SYS_ADMIN")
+
+	_, err = tweakCapabilities(nil, []string{"CAP_FOO"}, nil)
+	assert.Error(t, err)
+}
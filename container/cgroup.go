@@ -0,0 +1,115 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/exfly/container/pkg/cgroups"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// cpuPeriod is the CFS period Cpus is turned into a quota against, 100ms.
+const cpuPeriod = 100000
+
+func (c *ContainerService) cgroupManager(container *Container) *cgroups.Manager {
+	return cgroups.NewManager("container/" + *container.ContainerID)
+}
+
+// setupCgroup creates the container cgroup, applies its limits and moves pid
+// into it. Rootless, cgroups are only used if the hierarchy was delegated to
+// us, and device rules are left out: the user namespace can't create device
+// nodes anyway.
+func (c *ContainerService) setupCgroup(container *Container, pid int) (*cgroups.Manager, error) {
+	m := c.cgroupManager(container)
+	if err := m.Create(); err != nil {
+		if container.Rootless {
+			log.WithError(err).Warn("cgroups not available rootless, running without")
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !container.Rootless {
+		if err := m.SetDevices(deviceRules(container)); err != nil {
+			m.Destroy()
+			return nil, err
+		}
+	}
+	if err := m.SetResources(container.resources()); err != nil {
+		m.Destroy()
+		return nil, err
+	}
+	if err := m.Apply(pid); err != nil {
+		m.Destroy()
+		return nil, err
+	}
+	return m, nil
+}
+
+// execCgroup is the cgroup the processes exec'd into container start in,
+// nil if it runs without one, as it may rootless.
+func (c *ContainerService) execCgroup(container *Container) *cgroups.Manager {
+	m := c.cgroupManager(container)
+	if !m.Exists() {
+		return nil
+	}
+	return m
+}
+
+// resources are the cgroup limits of container.
+func (container *Container) resources() cgroups.Resources {
+	r := cgroups.Resources{
+		Memory:     int64(container.Mem),
+		MemorySwap: int64(container.Swap),
+		PidsLimit:  int64(container.Pids),
+		CPUShares:  container.CPUShares,
+	}
+	if container.Cpus > 0 {
+		r.CPUPeriod = cpuPeriod
+		r.CPUQuota = int64(container.Cpus * cpuPeriod)
+	}
+	return r
+}
+
+// mountCgroups shows the container its own cgroups at /sys/fs/cgroup, read
+// only, binding them from the host before the root is switched. Inside its
+// cgroup namespace they are the root cgroups.
+func (c *ContainerService) mountCgroups(container *Container, rootfs string) error {
+	m := c.cgroupManager(container)
+	target := filepath.Join(rootfs, cgroups.Root)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return errors.Wrapf(err, "create %s", target)
+	}
+	if m.IsUnified() {
+		if _, err := os.Stat(m.Path("")); err == nil {
+			return bindReadonly(m.Path(""), target)
+		}
+	}
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if err := unix.Mount("tmpfs", target, "tmpfs", flags, "mode=755"); err != nil {
+		return errors.Wrapf(err, "mount %s", target)
+	}
+	for _, sub := range m.Subsystems() {
+		if _, err := os.Stat(m.Path(sub)); err != nil {
+			// Rootless without a delegated hierarchy.
+			continue
+		}
+		dir := filepath.Join(target, sub)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return errors.Wrapf(err, "create %s", dir)
+		}
+		if err := bindReadonly(m.Path(sub), dir); err != nil {
+			return err
+		}
+	}
+	return remountReadonly(target, 0)
+}
+
+func bindReadonly(source, target string) error {
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return errors.Wrapf(err, "bind %s", source)
+	}
+	return remountReadonly(target, 0)
+}
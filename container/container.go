@@ -1,6 +1,13 @@
 package container
 
-import "github.com/exfly/container/image"
+import (
+	"time"
+
+	"github.com/exfly/container/image"
+	"github.com/exfly/container/pkg/seccomp"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
 
 func NewContainer(img *image.Image, id *string) *Container {
 	if id == nil {
@@ -10,17 +17,100 @@ func NewContainer(img *image.Image, id *string) *Container {
 	return &Container{
 		ContainerID: id,
 		Image:       img,
+		State:       &State{Status: StatusCreated},
 	}
 }
 
 type Container struct {
 	ContainerID *string      `json:"container_id,omitempty"`
 	Image       *image.Image `json:"image,omitempty"`
+	Created     time.Time    `json:"created"`
+
+	// Resource limits, enforced through the container cgroup. Mem is in
+	// bytes, Swap limits memory plus swap as docker's --memory-swap does,
+	// Pids caps the number of processes and Cpus the CPUs the container may
+	// use. CPUShares is its CPU weight.
+	Mem       int      `json:"mem,omitempty"`
+	Swap      int      `json:"swap,omitempty"`
+	Pids      int      `json:"pids,omitempty"`
+	Cpus      float64  `json:"cpus,omitempty"`
+	CPUShares uint64   `json:"cpu_shares,omitempty"`
+	Src       string   `json:"src,omitempty"`
+	Args      []string `json:"args,omitempty"`
+
+	// Bundle is the OCI bundle the container was created from. Its rootfs,
+	// Rootfs, is used instead of image layers and Image is nil. Hostname
+	// replaces the container ID as the hostname. Hooks are those of the
+	// bundle, those of the hooks directory are added when it starts.
+	Bundle   string       `json:"bundle,omitempty"`
+	Rootfs   string       `json:"rootfs,omitempty"`
+	Hostname string       `json:"hostname,omitempty"`
+	Hooks    *specs.Hooks `json:"hooks,omitempty"`
+
+	// Process config. Unset fields are filled from the image config when the
+	// container starts; a non-nil empty Entrypoint clears the image one.
+	Entrypoint   []string          `json:"entrypoint,omitempty"`
+	Cmd          []string          `json:"cmd,omitempty"`
+	Env          []string          `json:"env,omitempty"`
+	WorkingDir   string            `json:"working_dir,omitempty"`
+	User         string            `json:"user,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	StopSignal   string            `json:"stop_signal,omitempty"`
+	ExposedPorts []string          `json:"exposed_ports,omitempty"`
+	Volumes      []string          `json:"volumes,omitempty"`
+
+	Mounts  []Mount  `json:"mounts,omitempty"`
+	Devices []Device `json:"devices,omitempty"`
+	// RootfsPropagation is the propagation of the container mount tree,
+	// rprivate by default. NoPivotRoot uses chroot instead of pivot_root.
+	RootfsPropagation string `json:"rootfs_propagation,omitempty"`
+	NoPivotRoot       bool   `json:"no_pivot_root,omitempty"`
+	ReadonlyRootfs    bool   `json:"readonly_rootfs,omitempty"`
+	// CapAdd and CapDrop tweak the default capabilities into Capabilities.
+	CapAdd       []string      `json:"cap_add,omitempty"`
+	CapDrop      []string      `json:"cap_drop,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	// MaskedPaths and ReadonlyPaths default to the docker lists when nil.
+	MaskedPaths   []string `json:"masked_paths,omitempty"`
+	ReadonlyPaths []string `json:"readonly_paths,omitempty"`
+	// SecurityOpt are the --security-opt values. Seccomp is the resolved
+	// profile, the default one unless seccomp=unconfined was given.
+	SecurityOpt []string         `json:"security_opt,omitempty"`
+	Seccomp     *seccomp.Profile `json:"seccomp,omitempty"`
+	// NoNewPrivileges keeps setuid binaries and file capabilities from
+	// granting privileges, unless --security-opt no-new-privileges=false.
+	NoNewPrivileges bool `json:"no_new_privileges,omitempty"`
+	// Ulimits are the resource limits of the container process. Sysctls
+	// are written to its /proc/sys, only namespaced ones are allowed.
+	Ulimits []Ulimit          `json:"ulimits,omitempty"`
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+	// Userns is the --userns mode, resolved into UIDMappings and
+	// GIDMappings. Containers with mappings get a user namespace.
+	Userns      string  `json:"userns,omitempty"`
+	UIDMappings []IDMap `json:"uid_mappings,omitempty"`
+	GIDMappings []IDMap `json:"gid_mappings,omitempty"`
+	// Rootless is set when started without root privileges.
+	Rootless bool `json:"rootless,omitempty"`
+	// Network is host or none, none by default when rootless.
+	// NetworkHelper is a userspace network helper started for the
+	// container network namespace.
+	Network       string `json:"network,omitempty"`
+	NetworkHelper string `json:"network_helper,omitempty"`
+	// PidMode, IpcMode and UtsMode share a namespace: host, or
+	// container:<id>. TimeOffsets shift the clocks of the container time
+	// namespace, by clock name.
+	PidMode     string                   `json:"pid_mode,omitempty"`
+	IpcMode     string                   `json:"ipc_mode,omitempty"`
+	UtsMode     string                   `json:"uts_mode,omitempty"`
+	TimeOffsets map[string]time.Duration `json:"time_offsets,omitempty"`
+	// Pod is the name of the pod the container is a member of.
+	Pod string `json:"pod,omitempty"`
+	// ExtraHosts are host:ip entries added to /etc/hosts.
+	ExtraHosts []string `json:"extra_hosts,omitempty"`
+	// AutoRemove removes the container once it exits after Start.
+	AutoRemove bool `json:"auto_remove,omitempty"`
+
+	Healthcheck *image.HealthConfig `json:"healthcheck,omitempty"`
 
-	Mem  int      `json:"mem,omitempty"`
-	Swap int      `json:"swap,omitempty"`
-	Pids int      `json:"pids,omitempty"`
-	Cpus float64  `json:"cpus,omitempty"`
-	Src  string   `json:"src,omitempty"`
-	Args []string `json:"args,omitempty"`
+	State *State `json:"state,omitempty"`
 }
@@ -1,38 +1,58 @@
 package container
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/exfly/container/config"
 	"github.com/exfly/container/image"
+	"github.com/exfly/container/pkg/cgroups"
 	"github.com/exfly/container/pkg/dirs"
 	pkgdirs "github.com/exfly/container/pkg/dirs"
 	"github.com/exfly/container/pkg/file"
+	"github.com/exfly/container/volume"
 
 	"github.com/davecgh/go-spew/spew"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 type ContainerService struct {
+	// mu serializes writes of runtime.json while background monitors run.
+	mu sync.Mutex
+	// lifecycleMu serializes Start and Remove. exits has the containers
+	// started by Start that haven't exited yet, nextExits the channels
+	// given out by NextExit.
+	lifecycleMu sync.Mutex
+	exits       map[string]*exitStatus
+	nextExits   map[string][]chan int
+	// volumesMu serializes creating containers, which may mount volumes,
+	// and removing volumes no container mounts.
+	volumesMu sync.Mutex
+
 	configHome *config.Home
 	imgConf    *image.ImageConfig
 	imgSrv     *image.ImageService
+	volSrv     *volume.VolumeService
 }
 
-func NewContainerService(configHome *config.Home, imgConf *image.ImageConfig, imgSrv *image.ImageService) *ContainerService {
+func NewContainerService(configHome *config.Home, imgConf *image.ImageConfig, imgSrv *image.ImageService, volSrv *volume.VolumeService) *ContainerService {
 	return &ContainerService{
 		configHome: configHome,
 		imgConf:    imgConf,
 		imgSrv:     imgSrv,
+		volSrv:     volSrv,
+		exits:      map[string]*exitStatus{},
+		nextExits:  map[string][]chan int{},
 	}
 }
 
@@ -71,31 +91,57 @@ func (c *ContainerService) createContainerDir(container *Container) error {
 func (c *ContainerService) unmountOverlayFileSystem(container *Container) error {
 	mountedPath := c.configHome.ContainersPath() + "/" + *container.ContainerID + "/fs/mnt"
 	if err := syscall.Unmount(mountedPath, 0); err != nil {
-		log.Fatalf("Uable to mount container file system: %v at %s", err, mountedPath)
-		return errors.Wrapf(err, "Uable to mount container file system: %s", mountedPath)
+		return errors.Wrapf(err, "Uable to unmount container file system: %s", mountedPath)
 	}
 	return nil
 }
 
-func (c *ContainerService) mountOverlayFileSystem(container *Container) error {
+// imageLayers returns the layer directories of the container image, top
+// first.
+func (c *ContainerService) imageLayers(container *Container) ([]string, error) {
 	var srcLayers []string
 	mani, err := c.imgSrv.GetManifestForImage(container.Image)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if mani.IsValid() != nil {
-		return err
+		return nil, err
 	}
 
 	imageBasePath := c.imgConf.GetBasePathForImage(container.Image.ShaHex)
 	for _, layer := range mani[0].Layers {
-		srcLayers = append([]string{imageBasePath + "/" + layer[:12] + "/fs"}, srcLayers...)
+		layerFS := imageBasePath + "/" + layer[:12] + "/fs"
+		// Rootless layers already belong to the user mapped to root.
+		if container.usesUserns() && !container.Rootless {
+			if layerFS, err = remappedLayer(layerFS, container); err != nil {
+				return nil, err
+			}
+		}
+		srcLayers = append([]string{layerFS}, srcLayers...)
 		//srcLayers = append(srcLayers, imageBasePath + "/" + layer[:12] + "/fs")
 	}
+	return srcLayers, nil
+}
 
+func (c *ContainerService) overlayOptions(container *Container, srcLayers []string) string {
 	contFSHome := c.GetContainerFSHome(container)
+	return "lowerdir=" + strings.Join(srcLayers, ":") + ",upperdir=" + contFSHome + "/upperdir,workdir=" + contFSHome + "/workdir"
+}
+
+func (c *ContainerService) mountOverlayFileSystem(container *Container) error {
+	srcLayers, err := c.imageLayers(container)
+	if err != nil {
+		return err
+	}
+	contFSHome := c.GetContainerFSHome(container)
+	if container.usesUserns() {
+		// The root of the merged tree takes the ownership of upperdir.
+		if err := chownToRoot(contFSHome+"/upperdir", container); err != nil {
+			return err
+		}
+	}
 	log.WithField("p", contFSHome).Debug("container_fs_home")
-	mntOptions := "lowerdir=" + strings.Join(srcLayers, ":") + ",upperdir=" + contFSHome + "/upperdir,workdir=" + contFSHome + "/workdir"
+	mntOptions := c.overlayOptions(container, srcLayers)
 	log.Infof("mountOverlayFS: %v", mntOptions)
 	if err := syscall.Mount("none", contFSHome+"/mnt", "overlay", 0, mntOptions); err != nil {
 		return errors.Errorf("Mount failed: %v\n", err)
@@ -112,9 +158,41 @@ func (c *ContainerService) marshalContainer(container *Container) error {
 	return ioutil.WriteFile(marshalTo, content, 0644)
 }
 
+// updateContainer applies fn to container and persists the result.
+func (c *ContainerService) updateContainer(container *Container, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn()
+	if err := c.marshalContainer(container); err != nil {
+		log.WithError(err).Error("persist container state")
+	}
+}
+
+// Update applies fn to the stopped container with containerID and persists
+// the result, for the settings others own, like the namespaces of pod
+// members.
+func (c *ContainerService) Update(containerID string, fn func(*Container)) error {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if container.State.IsRunning() {
+		return errors.Wrapf(ErrRunning, "%s", containerID)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(container)
+	return c.marshalContainer(container)
+}
+
 func (c *ContainerService) unmarshalContainer(containerID string) (*Container, error) {
 	unmarshalFrom := c.GetContainerMetadataPathByID(containerID)
 	content, err := ioutil.ReadFile(unmarshalFrom)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotExists, "%s", containerID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -123,26 +201,287 @@ func (c *ContainerService) unmarshalContainer(containerID string) (*Container, e
 	return &ret, err
 }
 
-func (c *ContainerService) prepareAndExecuteContainer(ctx context.Context, container *Container, args []string) error {
-	if err := c.marshalContainer(container); err != nil {
+// Inspect returns the container with containerID, as long as it exists.
+func (c *ContainerService) Inspect(containerID string) (*Container, error) {
+	return c.unmarshalContainer(containerID)
+}
+
+// List returns the containers that have metadata on disk.
+func (c *ContainerService) List() ([]*Container, error) {
+	entries, err := ioutil.ReadDir(c.configHome.ContainersPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Container
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		container, err := c.unmarshalContainer(entry.Name())
+		if err != nil {
+			continue
+		}
+		ret = append(ret, container)
+	}
+	return ret, nil
+}
+
+// IsVolumeInUse reports whether any container mounts the named volume.
+func (c *ContainerService) IsVolumeInUse(name string) bool {
+	containers, err := c.List()
+	if err != nil {
+		// Err on the side of keeping data.
+		return true
+	}
+	for _, container := range containers {
+		for _, m := range container.Mounts {
+			if m.Type == MountTypeVolume && m.Source == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RemoveVolume removes the named volume unless a container mounts it.
+func (c *ContainerService) RemoveVolume(name string) error {
+	c.volumesMu.Lock()
+	defer c.volumesMu.Unlock()
+	if c.IsVolumeInUse(name) {
+		return errors.Wrapf(volume.ErrInUse, "%s", name)
+	}
+	return c.volSrv.Remove(name)
+}
+
+// PruneVolumes removes the volumes no container mounts and returns their
+// names.
+func (c *ContainerService) PruneVolumes() ([]string, error) {
+	c.volumesMu.Lock()
+	defer c.volumesMu.Unlock()
+	return c.volSrv.Prune(c.IsVolumeInUse)
+}
+
+// IsImageInUse reports whether any container was created from img.
+func (c *ContainerService) IsImageInUse(img *image.Image) bool {
+	containers, err := c.List()
+	if err != nil {
+		// Err on the side of keeping it.
+		return true
+	}
+	for _, container := range containers {
+		if container.Image != nil && container.Image.ShaHex == img.ShaHex {
+			return true
+		}
+	}
+	return false
+}
+
+// Create resolves the config of container and writes its metadata, in the
+// created state.
+func (c *ContainerService) Create(container *Container) error {
+	if err := c.resolve(container); err != nil {
+		return err
+	}
+	if err := c.createContainerDir(container); err != nil {
+		return err
+	}
+	c.volumesMu.Lock()
+	defer c.volumesMu.Unlock()
+	err := c.prepareVolumes(container)
+	if err == nil {
+		// Created up front, for its logs to be followed before it starts.
+		err = ioutil.WriteFile(c.GetContainerLogPath(container), nil, 0640)
+	}
+	if err == nil {
+		container.Created = time.Now()
+		container.State = &State{Status: StatusCreated}
+		err = c.marshalContainer(container)
+	}
+	if err != nil {
+		os.RemoveAll(c.GetContainerHome(container))
+		return err
+	}
+	return nil
+}
+
+// resolve completes and validates the config of container, from its image
+// and the defaults.
+func (c *ContainerService) resolve(container *Container) error {
+	container.Rootless = config.IsRootless()
+	if err := applyRootless(container); err != nil {
+		return err
+	}
+	if err := applyUserns(container); err != nil {
+		return err
+	}
+	if err := applyNetwork(container); err != nil {
+		return err
+	}
+	if err := validateNamespaces(container); err != nil {
+		return err
+	}
+	if err := validateSysctls(container); err != nil {
 		return err
 	}
-	args = append([]string{"child-mode", *container.ContainerID}, args...)
+	if container.Image != nil {
+		imgMetadata, err := c.imgSrv.GetImageMetadata(container.Image)
+		if err != nil {
+			return err
+		}
+		if err := applyImageConfig(container, imgMetadata.Config); err != nil {
+			return err
+		}
+	} else if len(container.Args) == 0 {
+		// Created from a bundle, which has the whole process config.
+		return errors.New("no command specified")
+	}
+	if err := applySecurityDefaults(container); err != nil {
+		return err
+	}
+	return validatePropagation(container.RootfsPropagation)
+}
+
+// stdio are the standard streams of a container process. Nil ones are
+// connected to /dev/null.
+type stdio struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// process is a started container, child-mode and what runs next to it.
+type process struct {
+	cmd               *exec.Cmd
+	cgroup            *cgroups.Manager
+	netHelper         *exec.Cmd
+	stopHealthMonitor func()
+	// afterExit runs once the process exited, before that is recorded.
+	afterExit func()
+	spec      *specs.Spec
+}
+
+// startProcess starts child-mode for container, whose rootfs is ready, and
+// returns once the container process runs.
+func (c *ContainerService) startProcess(ctx context.Context, container *Container, streams stdio) (*process, error) {
+	spec, err := c.writeSpec(container)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"child-mode", *container.ContainerID}
 	log.Infof("CMD: %v", args)
 	cmd := exec.Command("/proc/self/exe", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWPID |
-			syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWUTS |
-			syscall.CLONE_NEWIPC,
+	cmd.Env = append(os.Environ(), config.HomeEnv+"="+c.configHome.HomePath())
+	cmd.Stdin = streams.Stdin
+	cmd.Stdout = streams.Stdout
+	cmd.Stderr = streams.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: container.cloneFlags()}
+	if container.usesUserns() {
+		// The other namespaces are created owned by the new user namespace,
+		// and child-mode becomes its root before exec.
+		cmd.SysProcAttr.UidMappings = sysProcIDMaps(container.UIDMappings)
+		cmd.SysProcAttr.GidMappings = sysProcIDMaps(container.GIDMappings)
+		// Unprivileged, gid_map can only be written with setgroups denied.
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = !container.Rootless
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: container.Rootless}
+	}
+	shared, err := c.sharedNamespaces(container)
+	if err != nil {
+		return nil, err
 	}
-	return cmd.Run()
+	childEnd, parentEnd, err := newSyncPipe()
+	if err != nil {
+		return nil, err
+	}
+	defer parentEnd.Close()
+	// child-mode logs to our stderr, its own goes to the container.
+	cmd.ExtraFiles = []*os.File{childEnd, os.Stderr}
+	// Started from a thread in the shared namespaces, for child-mode to be
+	// created in them.
+	err = onThrowawayThread(func() error {
+		if err := joinNamespaces(shared); err != nil {
+			return err
+		}
+		return cmd.Start()
+	})
+	childEnd.Close()
+	if err != nil {
+		return nil, err
+	}
+	p := &process{cmd: cmd, spec: spec}
+	p.cgroup, err = c.setupCgroup(container, cmd.Process.Pid)
+	if err == nil {
+		p.netHelper, err = startNetworkHelper(container, cmd.Process.Pid)
+	}
+	if err == nil {
+		// The namespaces exist, child-mode waits before it switches root.
+		state := c.hookState(container, spec, specs.StateCreating, cmd.Process.Pid)
+		err = runHooks(spec, HookPrestart, state)
+		if err == nil {
+			err = runHooks(spec, HookCreateRuntime, state)
+		}
+	}
+	if err == nil {
+		err = signalChild(parentEnd)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		p.cleanup()
+		return nil, err
+	}
+	c.updateContainer(container, func() {
+		container.State.Status = StatusRunning
+		container.State.Pid = cmd.Process.Pid
+		container.State.Paused = false
+		container.State.ExitCode = 0
+		container.State.StartedAt = time.Now()
+		container.State.FinishedAt = time.Time{}
+		container.State.Health = nil
+	})
+	p.stopHealthMonitor = c.startHealthMonitor(ctx, container)
+	return p, nil
+}
+
+// waitProcess waits for the container process to exit and records it.
+func (c *ContainerService) waitProcess(container *Container, p *process) error {
+	err := p.cmd.Wait()
+	p.stopHealthMonitor()
+	p.cleanup()
+	runPostHooks(p.spec, HookPoststop, c.hookState(container, p.spec, specs.StateStopped, 0))
+	if p.afterExit != nil {
+		p.afterExit()
+	}
+	c.updateContainer(container, func() {
+		container.State.Status = StatusExited
+		container.State.Pid = 0
+		container.State.Paused = false
+		container.State.ExitCode = exitCode(p.cmd.ProcessState)
+		container.State.FinishedAt = time.Now()
+	})
+	return err
 }
 
-func (c *ContainerService) copyNameserverConfig(container *Container) error {
+// runPoststart runs the poststart hooks of the started container.
+func (p *process) runPoststart(c *ContainerService, container *Container) {
+	runPostHooks(p.spec, HookPoststart, c.hookState(container, p.spec, specs.StateRunning, p.cmd.Process.Pid))
+}
+
+func (p *process) cleanup() {
+	stopNetworkHelper(p.netHelper)
+	if p.cgroup == nil {
+		return
+	}
+	if err := p.cgroup.Destroy(); err != nil {
+		log.WithError(err).Warn("destroy cgroup")
+	}
+}
+
+// copyNameserverConfig gives the container with its root at rootfs the DNS
+// config of the host.
+func copyNameserverConfig(rootfs string) error {
 	resolvFilePaths := []string{
 		"/var/run/systemd/resolve/resolv.conf",
 		"/etc/gockerresolv.conf",
@@ -152,112 +491,269 @@ func (c *ContainerService) copyNameserverConfig(container *Container) error {
 		if _, err := os.Stat(resolvFilePath); os.IsNotExist(err) {
 			continue
 		} else {
-			return file.CopyFile(
-				resolvFilePath,
-				c.GetContainerFSHome(container)+"/mnt/etc/resolv.conf",
-			)
+			target, err := rootfsFile(rootfs, "/etc/resolv.conf")
+			if err != nil {
+				return err
+			}
+			return file.CopyFile(resolvFilePath, target)
 		}
 	}
 	return nil
 }
 
+// RunByID is child-mode: it sets the container up from inside its namespaces
+// and runs its process, as its spec says, mounts, devices and namespaces
+// included. The container itself seeds its volumes.
+// It must be called on the main thread, which main locks for child-mode.
 func (c *ContainerService) RunByID(ctx context.Context, containerID string, args []string) error {
 	container, err := c.unmarshalContainer(containerID)
 	if err != nil {
 		return err
 	}
 	log.Debug(spew.Sdump(container))
-	imgMetadata, err := c.imgSrv.GetImageMetadata(container.Image)
+	if err = waitForParent(); err != nil {
+		return err
+	}
+	spec, err := c.loadSpec(container)
+	if err != nil {
+		return err
+	}
+	execFifo, err := c.openExecFifo(container)
 	if err != nil {
 		return err
 	}
 	mntPath := c.GetContainerFSHome(container) + "/mnt"
+	process := spec.Process
+	mounts, err := specMounts(spec.Mounts, container.Bundle)
+	if err != nil {
+		return err
+	}
+	devices, err := specDevices(spec.Linux.Devices)
+	if err != nil {
+		return err
+	}
 
-	rawCmd := args[0]
-	rawCmdArgs := args[1:]
-	log.Infof("CMD: %v %v", rawCmd, rawCmdArgs)
-	cmd := exec.Command(rawCmd, rawCmdArgs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Env = imgMetadata.Config.Env
+	if len(args) == 0 {
+		args = process.Args
+	}
+	if len(args) == 0 {
+		return errors.New("no command specified")
+	}
 
-	if err = syscall.Sethostname([]byte(containerID)); err != nil {
-		return err
+	if spec.Hostname != "" {
+		if err = syscall.Sethostname([]byte(spec.Hostname)); err != nil {
+			return err
+		}
+	}
+	if ownsNamespace(spec.Linux, specs.NetworkNamespace) {
+		if err = SetupLoopback(); err != nil {
+			return err
+		}
 	}
 	// createCGroup
 	// configCGroup
-	if err = c.copyNameserverConfig(container); err != nil {
-		return errors.Wrap(err, "copy nameserver config")
+	if err = prepareRootfs(mntPath, spec.Linux.RootfsPropagation); err != nil {
+		return err
+	}
+	if container.Rootless {
+		if err = c.mountRootlessRootfs(container, mntPath); err != nil {
+			return err
+		}
+	}
+	// A bundle rootfs is the user's, it is used as is.
+	if container.Bundle == "" {
+		if err = copyNameserverConfig(mntPath); err != nil {
+			return errors.Wrap(err, "copy nameserver config")
+		}
 	}
-	if err = syscall.Chroot(mntPath); err != nil {
-		return errors.Wrap(err, "chroot")
+	if err = addExtraHosts(mntPath, container.ExtraHosts); err != nil {
+		return err
+	}
+	if err = setupDev(mntPath, withHostPaths(devices, container.Devices)); err != nil {
+		return err
 	}
-	if err = os.Chdir("/"); err != nil {
-		return errors.Wrap(err, "chdir")
+	if err = c.seedVolumes(container, mntPath); err != nil {
+		return err
 	}
-	if err = pkgdirs.CreateDirsIfDontExist([]string{"/proc", "/sys", "/tmp", "/dev"}); err != nil {
-		return errors.Wrap(err, "create proc sys")
+	if err = setupMounts(mounts, mntPath); err != nil {
+		return err
 	}
-	if err = syscall.Mount("proc", "/proc", "proc", 0, ""); err != nil {
-		return errors.Wrap(err, "mount proc")
+	if err = setupProcAndSys(mntPath); err != nil {
+		return err
+	}
+	if err = c.mountCgroups(container, mntPath); err != nil {
+		return err
+	}
+	if err = enterRootfs(mntPath, container.NoPivotRoot); err != nil {
+		return err
+	}
+	if container.resolvesUserInChild() {
+		if err = resolveSpecUser(process, "/", container.User); err != nil {
+			return err
+		}
+	}
+	if err = pkgdirs.CreateDirsIfDontExist([]string{"/tmp"}); err != nil {
+		return errors.Wrap(err, "create tmp")
 	}
 	if err = syscall.Mount("tmpfs", "/tmp", "tmpfs", 0, ""); err != nil {
 		return errors.Wrap(err, "mount tmp")
 	}
-	if err = syscall.Mount("tmpfs", "/dev", "tmpfs", 0, ""); err != nil {
-		return errors.Wrap(err, "mount dev")
+	if err = pkgdirs.CreateDirsIfDontExist([]string{process.Cwd}); err != nil {
+		return errors.Wrap(err, "create working dir")
 	}
-	if err = pkgdirs.CreateDirsIfDontExist([]string{"/dev/pts"}); err != nil {
-		return errors.Wrap(err, "create /dev/pts")
+	// Before /proc/sys is made read only.
+	if err = applySysctls(spec.Linux.Sysctl); err != nil {
+		return err
 	}
-	if err = syscall.Mount("devpts", "/dev/pts", "devpts", 0, ""); err != nil {
-		return errors.Wrap(err, "mount /dev/pts")
+	if err = applyPathRestrictions(spec.Linux.MaskedPaths, spec.Linux.ReadonlyPaths, spec.Root.Readonly); err != nil {
+		return err
 	}
-	if err = syscall.Mount("sysfs", "/sys", "sysfs", 0, ""); err != nil {
-		return errors.Wrap(err, "mount /sys")
+
+	// Resolve the command only now, against the container rootfs.
+	rawCmd, err := lookPathInRoot("/", args[0], process.Env)
+	if err != nil {
+		return err
 	}
-	if err = cmd.Run(); err != nil {
-		return errors.Wrap(err, "run")
+	caps := specCapabilities(process.Capabilities)
+	filter, err := specSeccompFilter(spec.Linux.Seccomp, caps)
+	if err != nil {
+		return err
 	}
-	if err = (syscall.Unmount("/dev/pts", 0)); err != nil {
+	ulimits, err := specUlimits(process.Rlimits)
+	if err != nil {
 		return err
 	}
-	if err = (syscall.Unmount("/dev", 0)); err != nil {
+	log.Infof("CMD: %v %v", rawCmd, args[1:])
+	cmd := exec.Command(rawCmd, args[1:]...)
+	cmd.Args[0] = args[0]
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = process.Env
+	cmd.Dir = process.Cwd
+	cred := &syscall.Credential{
+		Uid:    process.User.UID,
+		Gid:    process.User.GID,
+		Groups: process.User.AdditionalGids,
+		// setgroups is denied in a rootless user namespace.
+		NoSetGroups: container.Rootless,
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential:  cred,
+		AmbientCaps: ambientCaps(caps),
+	}
+	if err = applyUlimits(ulimits); err != nil {
 		return err
 	}
-	if err = (syscall.Unmount("/sys", 0)); err != nil {
+	if err = waitForStart(execFifo); err != nil {
 		return err
 	}
-	if err = (syscall.Unmount("/proc", 0)); err != nil {
+	// Capabilities, seccomp and the namespaces of children are per thread.
+	// The main thread restricts itself and starts the process, child-mode
+	// carries on from another thread, which can still clean up.
+	if err = unshareLateNamespaces(spec.Linux); err != nil {
 		return err
 	}
-	if err = (syscall.Unmount("/tmp", 0)); err != nil {
+	if err = restrictThread(caps, filter, process.NoNewPrivileges); err != nil {
 		return err
 	}
-	return nil
+	if err = cmd.Start(); err != nil {
+		return errors.Wrap(err, "start")
+	}
+	stopForwarding := forwardSignals(cmd.Process, container)
+	return offLockedThread(func() error {
+		waitErr := cmd.Wait()
+		stopForwarding()
+		if _, ok := waitErr.(*exec.ExitError); !ok && waitErr != nil {
+			return errors.Wrap(waitErr, "run")
+		}
+		if err := unmountChildMounts(mounts); err != nil {
+			return err
+		}
+		if waitErr != nil {
+			return &ExitError{Code: exitCode(cmd.ProcessState)}
+		}
+		return nil
+	})
 }
 
-func (c *ContainerService) Run(ctx context.Context, container *Container, args []string) error {
-	if err := c.createContainerDir(container); err != nil {
+// unmountChildMounts undoes the mounts child-mode made inside the rootfs.
+func unmountChildMounts(mounts []Mount) error {
+	teardownMounts(mounts)
+	if err := (syscall.Unmount("/dev", syscall.MNT_DETACH)); err != nil {
 		return err
 	}
-	if err := c.mountOverlayFileSystem(container); err != nil {
+	if err := (syscall.Unmount("/sys", syscall.MNT_DETACH)); err != nil {
 		return err
 	}
-	if err := c.prepareAndExecuteContainer(ctx, container, args); err != nil {
+	if err := (syscall.Unmount("/proc", syscall.MNT_DETACH)); err != nil {
 		return err
 	}
+	return syscall.Unmount("/tmp", 0)
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("clean contaier?")
-	_, _ = reader.ReadString('\n')
-	if err := c.unmountOverlayFileSystem(container); err != nil {
+// Run starts container and waits for it to exit, then removes it. Non-empty
+// args replace the image Cmd. The container shares our standard streams.
+func (c *ContainerService) Run(ctx context.Context, container *Container, args []string) error {
+	if len(args) != 0 {
+		container.Cmd = args
+	}
+	if err := c.Create(container); err != nil {
 		return err
 	}
-	if err := os.RemoveAll(c.GetContainerHome(container)); err != nil {
+	// Clean up after containers that failed or were stopped by a signal too.
+	runErr := c.mountRootfs(container)
+	if runErr == nil {
+		var p *process
+		p, runErr = c.startProcess(ctx, container, stdio{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr})
+		if runErr == nil {
+			p.runPoststart(c, container)
+			runErr = c.waitProcess(container, p)
+		}
+		if err := c.unmountRootfs(container); err != nil {
+			log.WithError(err).Warn("unmount rootfs")
+		}
+	}
+	if err := c.removeContainer(container); err != nil {
 		return err
 	}
 	log.Info("finish")
+	return runErr
+}
+
+// mountRootfs mounts the rootfs of container. Rootless, child-mode mounts it
+// inside its user namespace.
+func (c *ContainerService) mountRootfs(container *Container) error {
+	if container.Rootless {
+		return nil
+	}
+	if container.Rootfs != "" {
+		return bindRootfs(container, c.GetContainerFSHome(container)+"/mnt")
+	}
+	return c.mountOverlayFileSystem(container)
+}
+
+func (c *ContainerService) unmountRootfs(container *Container) error {
+	if container.Rootless {
+		return nil
+	}
+	return c.unmountOverlayFileSystem(container)
+}
+
+// removeContainer removes the metadata and filesystem of a container that
+// doesn't run, and its anonymous volumes.
+func (c *ContainerService) removeContainer(container *Container) error {
+	if !container.Rootless {
+		// In case it was left mounted, RemoveAll would go through it.
+		syscall.Unmount(c.GetContainerFSHome(container)+"/mnt", syscall.MNT_DETACH)
+	}
+	// Left behind by containers nobody waited for, such as bundle ones.
+	if err := c.cgroupManager(container).Destroy(); err != nil {
+		log.WithError(err).Warn("destroy cgroup")
+	}
+	if err := os.RemoveAll(c.GetContainerHome(container)); err != nil {
+		return err
+	}
+	c.removeAnonymousVolumes(container)
 	return nil
 }
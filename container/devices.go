@@ -0,0 +1,221 @@
+package container
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/exfly/container/pkg/cgroups"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Device is a device node made available in the container.
+type Device struct {
+	PathOnHost      string `json:"path_on_host,omitempty"`
+	PathInContainer string `json:"path_in_container"`
+	// Type is 'c' or 'b'.
+	Type        rune        `json:"type"`
+	Major       int64       `json:"major"`
+	Minor       int64       `json:"minor"`
+	FileMode    os.FileMode `json:"file_mode"`
+	Uid         uint32      `json:"uid"`
+	Gid         uint32      `json:"gid"`
+	Permissions string      `json:"permissions"`
+}
+
+func (d Device) rule() cgroups.DeviceRule {
+	return cgroups.DeviceRule{Type: d.Type, Major: d.Major, Minor: d.Minor, Access: d.Permissions}
+}
+
+// defaultDevices are created in every container.
+var defaultDevices = []Device{
+	{PathInContainer: "/dev/null", Type: 'c', Major: 1, Minor: 3, FileMode: 0666, Permissions: "rwm"},
+	{PathInContainer: "/dev/zero", Type: 'c', Major: 1, Minor: 5, FileMode: 0666, Permissions: "rwm"},
+	{PathInContainer: "/dev/full", Type: 'c', Major: 1, Minor: 7, FileMode: 0666, Permissions: "rwm"},
+	{PathInContainer: "/dev/random", Type: 'c', Major: 1, Minor: 8, FileMode: 0666, Permissions: "rwm"},
+	{PathInContainer: "/dev/urandom", Type: 'c', Major: 1, Minor: 9, FileMode: 0666, Permissions: "rwm"},
+	{PathInContainer: "/dev/tty", Type: 'c', Major: 5, Minor: 0, FileMode: 0666, Permissions: "rwm"},
+}
+
+// defaultDeviceRules are allowed on top of the devices in the container:
+// mknod of anything, the pty multiplexer and pty slaves.
+var defaultDeviceRules = []cgroups.DeviceRule{
+	{Type: 'c', Major: cgroups.Wildcard, Minor: cgroups.Wildcard, Access: "m"},
+	{Type: 'b', Major: cgroups.Wildcard, Minor: cgroups.Wildcard, Access: "m"},
+	{Type: 'c', Major: 5, Minor: 1, Access: "rwm"},
+	{Type: 'c', Major: 5, Minor: 2, Access: "rwm"},
+	{Type: 'c', Major: 136, Minor: cgroups.Wildcard, Access: "rwm"},
+}
+
+var devSymlinks = [][2]string{
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+	{"pts/ptmx", "/dev/ptmx"},
+}
+
+// ParseDeviceSpec parses a --device value, host[:container][:permissions],
+// and reads the device numbers from the host node.
+func ParseDeviceSpec(spec string) (Device, error) {
+	parts := strings.Split(spec, ":")
+	d := Device{Permissions: "rwm"}
+	switch len(parts) {
+	case 1:
+		d.PathOnHost = parts[0]
+	case 2:
+		d.PathOnHost = parts[0]
+		if isDevicePermissions(parts[1]) {
+			d.Permissions = parts[1]
+		} else {
+			d.PathInContainer = parts[1]
+		}
+	case 3:
+		d.PathOnHost, d.PathInContainer, d.Permissions = parts[0], parts[1], parts[2]
+	default:
+		return d, errors.Errorf("invalid device spec %q", spec)
+	}
+	if d.PathInContainer == "" {
+		d.PathInContainer = d.PathOnHost
+	}
+	if !isDevicePermissions(d.Permissions) {
+		return d, errors.Errorf("invalid device permissions %q in %q", d.Permissions, spec)
+	}
+	if !path.IsAbs(d.PathInContainer) {
+		return d, errors.Errorf("device path %q is not an absolute path", d.PathInContainer)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(d.PathOnHost, &st); err != nil {
+		return d, errors.Wrapf(err, "stat device %s", d.PathOnHost)
+	}
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		d.Type = 'c'
+	case unix.S_IFBLK:
+		d.Type = 'b'
+	default:
+		return d, errors.Errorf("%s is not a device", d.PathOnHost)
+	}
+	d.Major = int64(unix.Major(uint64(st.Rdev)))
+	d.Minor = int64(unix.Minor(uint64(st.Rdev)))
+	d.FileMode = os.FileMode(st.Mode & 0777)
+	d.Uid, d.Gid = st.Uid, st.Gid
+	return d, nil
+}
+
+func isDevicePermissions(s string) bool {
+	return s != "" && strings.Trim(s, "rwm") == ""
+}
+
+// deviceRules returns the cgroup allow list for container.
+func deviceRules(container *Container) []cgroups.DeviceRule {
+	rules := append([]cgroups.DeviceRule{}, defaultDeviceRules...)
+	for _, d := range defaultDevices {
+		rules = append(rules, d.rule())
+	}
+	for _, d := range container.Devices {
+		rules = append(rules, d.rule())
+	}
+	return rules
+}
+
+// withHostPaths gives devices the host paths known has for them, which a
+// spec doesn't keep: nodes that can't be created are bound from there.
+func withHostPaths(devices, known []Device) []Device {
+	ret := append([]Device{}, devices...)
+	for i := range ret {
+		for _, d := range known {
+			if d.PathInContainer == ret[i].PathInContainer {
+				ret[i].PathOnHost = d.PathOnHost
+			}
+		}
+	}
+	return ret
+}
+
+// setupDev populates /dev under rootfs. It runs in child-mode before the root
+// is switched, so host nodes can still be bind mounted where mknod isn't
+// permitted.
+func setupDev(rootfs string, devices []Device) error {
+	dev := filepath.Join(rootfs, "dev")
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		return errors.Wrap(err, "create /dev")
+	}
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_STRICTATIME, "mode=755,size=65536k"); err != nil {
+		return errors.Wrap(err, "mount /dev")
+	}
+	for _, d := range append(append([]Device{}, defaultDevices...), devices...) {
+		if err := createDeviceNode(rootfs, d); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{"pts", "shm", "mqueue"} {
+		if err := os.MkdirAll(filepath.Join(dev, dir), 0755); err != nil {
+			return errors.Wrapf(err, "create /dev/%s", dir)
+		}
+	}
+	pts := filepath.Join(dev, "pts")
+	err := unix.Mount("devpts", pts, "devpts", unix.MS_NOSUID|unix.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620,gid=5")
+	if err == unix.EINVAL {
+		// The tty group isn't mapped in a rootless user namespace.
+		err = unix.Mount("devpts", pts, "devpts", unix.MS_NOSUID|unix.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620")
+	}
+	if err != nil {
+		return errors.Wrap(err, "mount /dev/pts")
+	}
+	if err := unix.Mount("shm", filepath.Join(dev, "shm"), "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777,size=65536k"); err != nil {
+		return errors.Wrap(err, "mount /dev/shm")
+	}
+	if err := unix.Mount("mqueue", filepath.Join(dev, "mqueue"), "mqueue", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return errors.Wrap(err, "mount /dev/mqueue")
+	}
+	for _, link := range devSymlinks {
+		if err := os.Symlink(link[0], filepath.Join(rootfs, link[1])); err != nil && !os.IsExist(err) {
+			return errors.Wrapf(err, "symlink %s", link[1])
+		}
+	}
+	return nil
+}
+
+func createDeviceNode(rootfs string, d Device) error {
+	target := filepath.Join(rootfs, d.PathInContainer)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.Wrapf(err, "create %s", filepath.Dir(d.PathInContainer))
+	}
+	mode := uint32(d.FileMode.Perm())
+	if d.Type == 'b' {
+		mode |= unix.S_IFBLK
+	} else {
+		mode |= unix.S_IFCHR
+	}
+	err := unix.Mknod(target, mode, int(unix.Mkdev(uint32(d.Major), uint32(d.Minor))))
+	if err == unix.EPERM {
+		return bindDeviceNode(target, d)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "mknod %s", d.PathInContainer)
+	}
+	// mknod is subject to the umask.
+	if err := unix.Chmod(target, uint32(d.FileMode.Perm())); err != nil {
+		return errors.Wrapf(err, "chmod %s", d.PathInContainer)
+	}
+	return errors.Wrapf(unix.Chown(target, int(d.Uid), int(d.Gid)), "chown %s", d.PathInContainer)
+}
+
+// bindDeviceNode bind mounts the host node, for when we lack CAP_MKNOD.
+func bindDeviceNode(target string, d Device) error {
+	source := d.PathOnHost
+	if source == "" {
+		source = d.PathInContainer
+	}
+	f, err := os.OpenFile(target, os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "create %s", d.PathInContainer)
+	}
+	f.Close()
+	return errors.Wrapf(unix.Mount(source, target, "", unix.MS_BIND, ""), "bind mount %s", source)
+}
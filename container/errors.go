@@ -0,0 +1,29 @@
+package container
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotExists  error = errors.New("container not exists")
+	ErrRunning    error = errors.New("container is running")
+	ErrNotRunning error = errors.New("container is not running")
+	ErrPaused     error = errors.New("container is paused")
+	ErrNotPaused  error = errors.New("container is not paused")
+)
+
+func IsContainerNotExists(err error) bool {
+	return errors.Cause(err) == ErrNotExists
+}
+
+// ExitError is returned by RunByID when the container process exits non-zero,
+// for child-mode to exit with the same code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
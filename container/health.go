@@ -0,0 +1,239 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/exfly/container/image"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+
+	maxHealthLogEntries = 5
+	maxHealthOutputLen  = 4096
+)
+
+type Health struct {
+	Status        string       `json:"status"`
+	FailingStreak int          `json:"failing_streak"`
+	Log           []*HealthLog `json:"log,omitempty"`
+}
+
+type HealthLog struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output"`
+}
+
+// mergeHealthConfig overlays the fields set in override on top of the image
+// healthcheck, the same way docker combines --health-* flags with HEALTHCHECK.
+func mergeHealthConfig(img, override *image.HealthConfig) *image.HealthConfig {
+	if img == nil && override == nil {
+		return nil
+	}
+	ret := image.HealthConfig{}
+	if img != nil {
+		ret = *img
+	}
+	if override == nil {
+		return &ret
+	}
+	if len(override.Test) != 0 {
+		ret.Test = override.Test
+	}
+	if override.Interval != 0 {
+		ret.Interval = override.Interval
+	}
+	if override.Timeout != 0 {
+		ret.Timeout = override.Timeout
+	}
+	if override.StartPeriod != 0 {
+		ret.StartPeriod = override.StartPeriod
+	}
+	if override.Retries != 0 {
+		ret.Retries = override.Retries
+	}
+	return &ret
+}
+
+// healthProbeArgs turns a docker style Test into argv. NONE and an empty test
+// disable the check.
+func healthProbeArgs(test []string) []string {
+	if len(test) == 0 {
+		return nil
+	}
+	switch test[0] {
+	case "NONE":
+		return nil
+	case "CMD":
+		return test[1:]
+	case "CMD-SHELL":
+		return []string{"/bin/sh", "-c", strings.Join(test[1:], " ")}
+	default:
+		return test
+	}
+}
+
+// startHealthMonitor probes the container in the background until the
+// returned stop function is called.
+func (c *ContainerService) startHealthMonitor(ctx context.Context, container *Container) func() {
+	hc := container.Healthcheck
+	if hc == nil {
+		return func() {}
+	}
+	args := healthProbeArgs(hc.Test)
+	if len(args) == 0 {
+		return func() {}
+	}
+	if container.Rootless {
+		// Probes are exec'd, which rootless mode can't do.
+		log.Warn("healthcheck is not supported in rootless mode")
+		return func() {}
+	}
+	interval, timeout, retries := hc.Interval, hc.Timeout, hc.Retries
+	if interval == 0 {
+		interval = defaultHealthInterval
+	}
+	if timeout == 0 {
+		timeout = defaultHealthTimeout
+	}
+	if retries == 0 {
+		retries = defaultHealthRetries
+	}
+
+	c.updateContainer(container, func() {
+		container.State.Health = &Health{Status: HealthStarting}
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		started := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// A paused container can't answer, that doesn't make it
+			// unhealthy.
+			if c.isPaused(*container.ContainerID) {
+				continue
+			}
+			entry := c.runHealthProbe(ctx, container, args, timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			if entry == nil {
+				continue
+			}
+			inStartPeriod := time.Since(started) < hc.StartPeriod
+			c.updateContainer(container, func() {
+				container.State.Paused = c.isPaused(*container.ContainerID)
+				recordHealthResult(container.State.Health, entry, retries, inStartPeriod)
+			})
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// runHealthProbe runs a probe and returns its result, nil if the container
+// was paused.
+func (c *ContainerService) runHealthProbe(ctx context.Context, container *Container, args []string, timeout time.Duration) *HealthLog {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var out limitedBuffer
+	entry := &HealthLog{Start: time.Now()}
+	code := -1
+	filter, err := seccompFilter(container, container.Capabilities)
+	if err == nil {
+		code, err = c.execProcess(ctx, container, execOpts{
+			Args:            args,
+			Env:             container.Env,
+			Dir:             container.WorkingDir,
+			User:            container.User,
+			Capabilities:    container.Capabilities,
+			Seccomp:         filter,
+			NoNewPrivileges: container.NoNewPrivileges,
+			UIDMappings:     container.UIDMappings,
+			GIDMappings:     container.GIDMappings,
+			Cgroup:          c.execCgroup(container),
+			Stdout:          &out,
+			Stderr:          &out,
+		})
+	}
+	if errors.Cause(err) == ErrPaused {
+		// Paused since we looked.
+		return nil
+	}
+	entry.End = time.Now()
+	entry.ExitCode = code
+	entry.Output = out.String()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		entry.ExitCode = -1
+		entry.Output = "Health check exceeded timeout (" + timeout.String() + ")"
+	case err != nil:
+		entry.ExitCode = -1
+		entry.Output = err.Error()
+	}
+	log.WithField("exit_code", entry.ExitCode).Debug("health probe")
+	return entry
+}
+
+// recordHealthResult folds a probe result into h. Failures during the start
+// period don't count against the retries unless the container was already
+// reported healthy.
+func recordHealthResult(h *Health, entry *HealthLog, retries int, inStartPeriod bool) {
+	h.Log = append(h.Log, entry)
+	if len(h.Log) > maxHealthLogEntries {
+		h.Log = h.Log[len(h.Log)-maxHealthLogEntries:]
+	}
+	if entry.ExitCode == 0 {
+		h.Status = HealthHealthy
+		h.FailingStreak = 0
+		return
+	}
+	if inStartPeriod && h.Status == HealthStarting {
+		return
+	}
+	h.FailingStreak++
+	if h.FailingStreak >= retries {
+		h.Status = HealthUnhealthy
+	}
+}
+
+// limitedBuffer keeps the first maxHealthOutputLen bytes of probe output.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := maxHealthOutputLen - b.Len(); room < len(p) {
+		if room < 0 {
+			room = 0
+		}
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
@@ -0,0 +1,39 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exfly/container/image"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeHealthConfig(t *testing.T) {
+	img := &image.HealthConfig{Test: []string{"CMD", "true"}, Interval: time.Second, Retries: 5}
+	merged := mergeHealthConfig(img, &image.HealthConfig{Retries: 2})
+	assert.Equal(t, []string{"CMD", "true"}, merged.Test)
+	assert.Equal(t, time.Second, merged.Interval)
+	assert.Equal(t, 2, merged.Retries)
+	assert.Nil(t, mergeHealthConfig(nil, nil))
+}
+
+func TestRecordHealthResult(t *testing.T) {
+	h := &Health{Status: HealthStarting}
+	recordHealthResult(h, &HealthLog{ExitCode: 1}, 2, true)
+	assert.Equal(t, HealthStarting, h.Status)
+	assert.Equal(t, 0, h.FailingStreak)
+
+	recordHealthResult(h, &HealthLog{ExitCode: 0}, 2, true)
+	assert.Equal(t, HealthHealthy, h.Status)
+
+	recordHealthResult(h, &HealthLog{ExitCode: 1}, 2, false)
+	assert.Equal(t, HealthHealthy, h.Status)
+	recordHealthResult(h, &HealthLog{ExitCode: 1}, 2, false)
+	assert.Equal(t, HealthUnhealthy, h.Status)
+
+	for i := 0; i < 10; i++ {
+		recordHealthResult(h, &HealthLog{ExitCode: 1}, 2, false)
+	}
+	assert.Len(t, h.Log, maxHealthLogEntries)
+}
@@ -0,0 +1,285 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The OCI hook stages we run. Failing prestart and createRuntime hooks fail
+// the start, failing poststart and poststop ones are only logged.
+const (
+	HookPrestart      = "prestart"
+	HookCreateRuntime = "createRuntime"
+	HookPoststart     = "poststart"
+	HookPoststop      = "poststop"
+)
+
+// hookConfigVersion is the version of the hook config format we read.
+const hookConfigVersion = "1.0.0"
+
+// hookConfig is a hook of the hooks directory, in the format podman and
+// CRI-O read:
+//
+//	{"version": "1.0.0", "hook": {"path": "/usr/bin/agent", "timeout": 5},
+//	 "when": {"always": true}, "stages": ["prestart"]}
+//
+// when.annotations maps regexps of annotation keys to regexps of their
+// values, when.commands are regexps of the container command. The hook
+// applies to a container if any condition holds.
+type hookConfig struct {
+	Version string     `json:"version"`
+	Hook    specs.Hook `json:"hook"`
+	When    struct {
+		Always      bool              `json:"always,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+		Commands    []string          `json:"commands,omitempty"`
+	} `json:"when"`
+	Stages []string `json:"stages"`
+}
+
+// loadHookConfigs reads the hook configs in dir, *.json, in lexical order.
+func loadHookConfigs(dir string) ([]*hookConfig, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var ret []*hookConfig
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "read hook config")
+		}
+		var h hookConfig
+		if err := json.Unmarshal(content, &h); err != nil {
+			return nil, errors.Wrapf(err, "parse hook config %s", path)
+		}
+		if err := h.validate(); err != nil {
+			return nil, errors.Wrapf(err, "hook config %s", path)
+		}
+		ret = append(ret, &h)
+	}
+	return ret, nil
+}
+
+func (h *hookConfig) validate() error {
+	if h.Version != hookConfigVersion {
+		return errors.Errorf("unsupported version %q, want %s", h.Version, hookConfigVersion)
+	}
+	if !filepath.IsAbs(h.Hook.Path) {
+		return errors.Errorf("hook path %q is not absolute", h.Hook.Path)
+	}
+	if len(h.Stages) == 0 {
+		return errors.New("no stages")
+	}
+	for _, stage := range h.Stages {
+		switch stage {
+		case HookPrestart, HookCreateRuntime, HookPoststart, HookPoststop:
+		default:
+			return errors.Errorf("unsupported stage %q", stage)
+		}
+	}
+	return nil
+}
+
+// matches reports whether h applies to the container spec is for.
+func (h *hookConfig) matches(spec *specs.Spec) (bool, error) {
+	if h.When.Always {
+		return true, nil
+	}
+	for keyPattern, valuePattern := range h.When.Annotations {
+		key, err := regexp.Compile(keyPattern)
+		if err != nil {
+			return false, errors.Wrap(err, "annotation key")
+		}
+		value, err := regexp.Compile(valuePattern)
+		if err != nil {
+			return false, errors.Wrap(err, "annotation value")
+		}
+		for k, v := range spec.Annotations {
+			if key.MatchString(k) && value.MatchString(v) {
+				return true, nil
+			}
+		}
+	}
+	if len(spec.Process.Args) == 0 {
+		return false, nil
+	}
+	for _, pattern := range h.When.Commands {
+		command, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, errors.Wrap(err, "command")
+		}
+		if command.MatchString(spec.Process.Args[0]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addHooks adds the hooks of the hooks directory that match spec to it,
+// after its own.
+func (c *ContainerService) addHooks(spec *specs.Spec) error {
+	configs, err := loadHookConfigs(c.configHome.HooksPath())
+	if err != nil {
+		return err
+	}
+	for _, h := range configs {
+		ok, err := h.matches(spec)
+		if err != nil {
+			return errors.Wrapf(err, "hook %s", h.Hook.Path)
+		}
+		if !ok {
+			continue
+		}
+		if spec.Hooks == nil {
+			spec.Hooks = &specs.Hooks{}
+		}
+		for _, stage := range h.Stages {
+			hooks := stageHooks(spec.Hooks, stage)
+			*hooks = append(*hooks, h.Hook)
+		}
+	}
+	return nil
+}
+
+// stageHooks returns the hooks of a stage.
+func stageHooks(hooks *specs.Hooks, stage string) *[]specs.Hook {
+	switch stage {
+	case HookPrestart:
+		return &hooks.Prestart
+	case HookCreateRuntime:
+		return &hooks.CreateRuntime
+	case HookPoststart:
+		return &hooks.Poststart
+	default:
+		return &hooks.Poststop
+	}
+}
+
+// specHooks copies the hooks of a bundle spec, with a warning about those
+// of the stages run inside the container, which aren't supported.
+func specHooks(hooks *specs.Hooks) *specs.Hooks {
+	if hooks == nil {
+		return nil
+	}
+	if len(hooks.CreateContainer) != 0 || len(hooks.StartContainer) != 0 {
+		log.Warn("createContainer and startContainer hooks are not supported, ignoring them")
+	}
+	ret := &specs.Hooks{}
+	for _, stage := range []string{HookPrestart, HookCreateRuntime, HookPoststart, HookPoststop} {
+		*stageHooks(ret, stage) = *stageHooks(hooks, stage)
+	}
+	return ret
+}
+
+// hookState is the state the hooks of container get: its spec is in the
+// bundle, its home unless it was created from one.
+func (c *ContainerService) hookState(container *Container, spec *specs.Spec, status specs.ContainerState, pid int) *specs.State {
+	bundle := container.Bundle
+	if bundle == "" {
+		bundle = c.GetContainerHome(container)
+	}
+	return &specs.State{
+		Version:     specs.Version,
+		ID:          *container.ContainerID,
+		Status:      status,
+		Pid:         pid,
+		Bundle:      bundle,
+		Annotations: spec.Annotations,
+	}
+}
+
+// runHooks runs the hooks of spec for stage in order, stopping at the first
+// that fails.
+func runHooks(spec *specs.Spec, stage string, state *specs.State) error {
+	if spec.Hooks == nil {
+		return nil
+	}
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	for _, h := range *stageHooks(spec.Hooks, stage) {
+		if err := runHook(h, content); err != nil {
+			return errors.Wrapf(err, "%s hook %s", stage, h.Path)
+		}
+	}
+	return nil
+}
+
+// runPostHooks runs poststart or poststop hooks, whose failures don't
+// change anything for the container.
+func runPostHooks(spec *specs.Spec, stage string, state *specs.State) {
+	if err := runHooks(spec, stage, state); err != nil {
+		log.WithError(err).WithField("container", state.ID).Warn("run hooks")
+	}
+}
+
+// runHook runs h with state on its stdin, killing it after its timeout.
+func runHook(h specs.Hook, state []byte) error {
+	cmd := exec.Command(h.Path)
+	if len(h.Args) != 0 {
+		cmd.Args = h.Args
+	}
+	cmd.Env = h.Env
+	cmd.Stdin = bytes.NewReader(state)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// The hook runs in its own process group so a timeout kills whatever it
+	// forked too, a child holding the output pipe would block Wait otherwise.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var timeout <-chan time.Time
+	if h.Timeout != nil && *h.Timeout > 0 {
+		timer := time.NewTimer(time.Duration(*h.Timeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case err = <-done:
+	case <-timeout:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		err = errors.Errorf("timed out after %ds", *h.Timeout)
+	}
+	if err != nil {
+		if out := strings.TrimSpace(output.String()); out != "" {
+			return errors.Errorf("%v: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// loadSpecOrWarn loads the spec of container for its hooks, nil if it has
+// none, as containers that never started don't.
+func (c *ContainerService) loadSpecOrWarn(container *Container) *specs.Spec {
+	spec, err := c.loadSpec(container)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).WithField("container", *container.ContainerID).Warn("load spec")
+		}
+		return nil
+	}
+	return spec
+}
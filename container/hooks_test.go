@@ -0,0 +1,81 @@
+package container
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"version": "1.0.0",
+		"hook": {"path": "/bin/agent"}, "when": {"annotations": {"^monitor$": "yes"}}, "stages": ["prestart", "poststop"]}`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"version": "1.0.0",
+		"hook": {"path": "/bin/setup"}, "when": {"commands": ["^/usr/bin/"]}, "stages": ["createRuntime"]}`), 0644))
+
+	configs, err := loadHookConfigs(dir)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, "/bin/setup", configs[0].Hook.Path)
+
+	spec := &specs.Spec{Process: &specs.Process{Args: []string{"/usr/bin/app"}}, Annotations: map[string]string{"monitor": "no"}}
+	ok, err := configs[0].matches(spec)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = configs[1].matches(spec)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	spec.Annotations["monitor"] = "yes"
+	ok, err = configs[1].matches(spec)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.json"), []byte(`{"version": "1.0.0",
+		"hook": {"path": "/bin/x"}, "when": {"always": true}, "stages": ["startContainer"]}`), 0644))
+	_, err = loadHookConfigs(dir)
+	assert.Error(t, err)
+}
+
+func TestRunHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "state.json")
+	timeout := 1
+	spec := &specs.Spec{Hooks: &specs.Hooks{
+		Poststart: []specs.Hook{{Path: "/bin/sh", Args: []string{"sh", "-c", "cat > " + out}}},
+		Poststop: []specs.Hook{
+			{Path: "/bin/sh", Args: []string{"sh", "-c", "echo no agent; exit 3"}},
+			{Path: "/bin/sh", Args: []string{"sh", "-c", "touch " + out}},
+		},
+		CreateRuntime: []specs.Hook{{Path: "/bin/sh", Args: []string{"sh", "-c", "sleep 30 & wait"}, Timeout: &timeout}},
+	}}
+	state := &specs.State{Version: specs.Version, ID: "abc", Status: specs.StateRunning, Pid: 42}
+
+	require.NoError(t, runHooks(spec, HookPoststart, state))
+	content, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	var got specs.State
+	require.NoError(t, json.Unmarshal(content, &got))
+	assert.Equal(t, *state, got)
+
+	require.NoError(t, os.Remove(out))
+	err = runHooks(spec, HookPoststop, state)
+	assert.EqualError(t, err, "poststop hook /bin/sh: exit status 3: no agent")
+	assert.NoFileExists(t, out, "hooks after a failing one don't run")
+
+	start := time.Now()
+	err = runHooks(spec, HookCreateRuntime, state)
+	assert.EqualError(t, err, "createRuntime hook /bin/sh: timed out after 1s")
+	assert.WithinDuration(t, start.Add(time.Second), time.Now(), 2*time.Second, "the hook's children are killed too")
+	assert.NoError(t, runHooks(spec, HookPrestart, state))
+}
@@ -0,0 +1,60 @@
+package container
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exfly/container/pkg/file"
+
+	"github.com/pkg/errors"
+)
+
+// ParseExtraHost parses an --add-host value, host:ip.
+func ParseExtraHost(spec string) (string, error) {
+	kv := strings.SplitN(spec, ":", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", errors.Errorf("invalid --add-host %q, want host:ip", spec)
+	}
+	if net.ParseIP(kv[1]) == nil {
+		return "", errors.Errorf("invalid ip %q in --add-host %q", kv[1], spec)
+	}
+	return spec, nil
+}
+
+// addExtraHosts appends the host:ip entries to /etc/hosts of the rootfs. It
+// runs before the root is switched, and before the user mounts, which may
+// cover /etc/hosts: the path is resolved inside rootfs.
+func addExtraHosts(rootfs string, hosts []string) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	path, err := rootfsFile(rootfs, "/etc/hosts")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open /etc/hosts")
+	}
+	defer f.Close()
+	for _, h := range hosts {
+		kv := strings.SplitN(h, ":", 2)
+		if _, err := fmt.Fprintf(f, "%s\t%s\n", kv[1], kv[0]); err != nil {
+			return errors.Wrap(err, "write /etc/hosts")
+		}
+	}
+	return nil
+}
+
+// rootfsFile resolves name inside rootfs, creating the directory it ends up
+// in.
+func rootfsFile(rootfs, name string) (string, error) {
+	path, err := file.SecureJoin(rootfs, name)
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve %s", name)
+	}
+	return path, errors.Wrapf(os.MkdirAll(filepath.Dir(path), 0755), "create the directory of %s", name)
+}
@@ -0,0 +1,31 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddExtraHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rootfs := filepath.Join(dir, "rootfs")
+	outside := filepath.Join(dir, "outside")
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "etc"), 0755))
+	require.NoError(t, ioutil.WriteFile(outside, nil, 0644))
+	// An absolute link is resolved inside the rootfs, not on the host.
+	require.NoError(t, os.Symlink(outside, filepath.Join(rootfs, "etc/hosts")))
+
+	require.NoError(t, addExtraHosts(rootfs, []string{"db:10.0.0.2"}))
+	content, err := ioutil.ReadFile(filepath.Join(rootfs, outside))
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2\tdb\n", string(content))
+	content, err = ioutil.ReadFile(outside)
+	require.NoError(t, err)
+	assert.Empty(t, content)
+}
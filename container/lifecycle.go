@@ -0,0 +1,280 @@
+package container
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// exitStatus is closed once a container started by Start has exited and
+// been cleaned up.
+type exitStatus struct {
+	done     chan struct{}
+	exitCode int
+}
+
+// Start starts a created or exited container in the background, with its
+// output going to its log. The container runs until it exits on its own or
+// is stopped, ctx is for its health checks.
+func (c *ContainerService) Start(ctx context.Context, containerID string) error {
+	return c.start(ctx, containerID, stdio{})
+}
+
+// StartAttached starts a container like Start, with stdin as its standard
+// input and its output copied to stdout and stderr besides its log. Should
+// writing there fail, the output only goes to the log from then on.
+func (c *ContainerService) StartAttached(ctx context.Context, containerID string, stdin *os.File, stdout, stderr io.Writer) error {
+	return c.start(ctx, containerID, stdio{Stdin: stdin, Stdout: stdout, Stderr: stderr})
+}
+
+func (c *ContainerService) start(ctx context.Context, containerID string, attached stdio) error {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if container.State.IsRunning() {
+		return errors.Wrapf(ErrRunning, "%s", containerID)
+	}
+	if err := c.mountRootfs(container); err != nil {
+		return err
+	}
+	logs, err := openLogFile(c.GetContainerLogPath(container))
+	if err != nil {
+		c.unmountRootfs(container)
+		return err
+	}
+	stdout, stderr := logs.stream(StreamStdout), logs.stream(StreamStderr)
+	streams := stdio{Stdout: stdout, Stderr: stderr}
+	if attached.Stdin != nil {
+		streams.Stdin = attached.Stdin
+	}
+	if attached.Stdout != nil {
+		streams.Stdout = io.MultiWriter(stdout, &detachableWriter{w: attached.Stdout})
+	}
+	if attached.Stderr != nil {
+		streams.Stderr = io.MultiWriter(stderr, &detachableWriter{w: attached.Stderr})
+	}
+	p, err := c.startProcess(ctx, container, streams)
+	if err != nil {
+		logs.Close()
+		c.unmountRootfs(container)
+		return err
+	}
+	p.runPoststart(c, container)
+	p.afterExit = func() {
+		stdout.flush()
+		stderr.flush()
+		logs.Close()
+	}
+	exit := &exitStatus{done: make(chan struct{})}
+	c.exits[containerID] = exit
+	go func() {
+		if err := c.waitProcess(container, p); err != nil {
+			log.WithError(err).WithField("container", containerID).Info("container exited")
+		}
+		if err := c.unmountRootfs(container); err != nil {
+			log.WithError(err).WithField("container", containerID).Warn("unmount rootfs")
+		}
+		if container.AutoRemove {
+			if err := c.removeContainer(container); err != nil {
+				log.WithError(err).WithField("container", containerID).Warn("remove container")
+			}
+		}
+		c.lifecycleMu.Lock()
+		delete(c.exits, containerID)
+		for _, ch := range c.nextExits[containerID] {
+			ch <- container.State.ExitCode
+			close(ch)
+		}
+		delete(c.nextExits, containerID)
+		c.lifecycleMu.Unlock()
+		exit.exitCode = container.State.ExitCode
+		close(exit.done)
+	}()
+	return nil
+}
+
+// detachableWriter writes to w until that fails once, for clients that may
+// go away while the container runs.
+type detachableWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+func (d *detachableWriter) Write(p []byte) (int, error) {
+	if !d.failed {
+		if _, err := d.w.Write(p); err != nil {
+			d.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// Kill sends sig to a running container, or to the process of a created
+// bundle container, which has one before it runs. A paused container is
+// thawed to handle it. The recorded pid of a container whose exit nobody
+// recorded may belong to another process by now, so it must still run.
+func (c *ContainerService) Kill(containerID string, sig syscall.Signal) error {
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if container.State.Pid == 0 || c.OCIStatus(container) == specs.StateStopped {
+		return errors.Wrapf(ErrNotRunning, "%s", containerID)
+	}
+	if err := unix.Kill(container.State.Pid, sig); err != nil && err != unix.ESRCH {
+		return errors.Wrapf(err, "signal container %s", containerID)
+	}
+	c.thawSignaled(container)
+	return nil
+}
+
+// Wait waits for a container to exit and returns its exit code. A
+// container that isn't running has exited already.
+func (c *ContainerService) Wait(ctx context.Context, containerID string) (int, error) {
+	c.lifecycleMu.Lock()
+	exit := c.exits[containerID]
+	c.lifecycleMu.Unlock()
+	if exit != nil {
+		select {
+		case <-exit.done:
+			return exit.exitCode, nil
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+	// Started by another process: all we can do is watch its state.
+	for {
+		container, err := c.Inspect(containerID)
+		if err != nil {
+			return -1, err
+		}
+		if !container.State.IsRunning() {
+			return container.State.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+// NextExit returns a channel that gets the exit code of the next exit of a
+// container, be it running or yet to be started. It is closed without one
+// if the container is removed first.
+func (c *ContainerService) NextExit(ctx context.Context, containerID string) (<-chan int, error) {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan int, 1)
+	if container.State.IsRunning() && c.exits[containerID] == nil {
+		// Started by another process, nobody will tell us.
+		go func() {
+			if code, err := c.Wait(ctx, containerID); err == nil {
+				ch <- code
+			}
+			close(ch)
+		}()
+		return ch, nil
+	}
+	c.nextExits[containerID] = append(c.nextExits[containerID], ch)
+	return ch, nil
+}
+
+// Remove removes a container that isn't running. With force a running one
+// is killed first.
+func (c *ContainerService) Remove(ctx context.Context, containerID string, force bool) error {
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if container.State.IsRunning() {
+		if !force {
+			return errors.Wrapf(ErrRunning, "%s, stop it first or force removal", containerID)
+		}
+		if err := c.Kill(containerID, unix.SIGKILL); err != nil && errors.Cause(err) != ErrNotRunning {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, DefaultStopTimeout)
+		defer cancel()
+		if _, err := c.Wait(ctx, containerID); err != nil {
+			if IsContainerNotExists(err) {
+				// Removed on exit.
+				return nil
+			}
+			return err
+		}
+	}
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	if container, err = c.Inspect(containerID); err != nil {
+		if force && IsContainerNotExists(err) {
+			// It was killed and removed itself.
+			return nil
+		}
+		return err
+	}
+	if container.State.IsRunning() {
+		return errors.Wrapf(ErrRunning, "%s", containerID)
+	}
+	if err := c.removeContainer(container); err != nil {
+		return err
+	}
+	if c.exits[containerID] != nil {
+		// Just exited, Start has yet to hand out the exit code.
+		return nil
+	}
+	for _, ch := range c.nextExits[containerID] {
+		close(ch)
+	}
+	delete(c.nextExits, containerID)
+	return nil
+}
+
+// Reconcile marks the containers recorded as running whose process is gone,
+// because whoever ran them died with them, as exited and unmounts them.
+func (c *ContainerService) Reconcile() error {
+	containers, err := c.List()
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		if !container.State.IsRunning() || processAlive(container.State.Pid) {
+			continue
+		}
+		log.WithField("container", *container.ContainerID).Warn("container process is gone, marking it exited")
+		if err := c.unmountRootfs(container); err != nil {
+			log.WithError(err).Debug("unmount rootfs")
+		}
+		c.updateContainer(container, func() {
+			container.State.Status = StatusExited
+			container.State.Pid = 0
+			container.State.Paused = false
+			container.State.ExitCode = -1
+			container.State.FinishedAt = time.Now()
+		})
+	}
+	return nil
+}
+
+// exitCode is the exit code of a process the way a shell reports it,
+// 128+n when killed by signal n.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
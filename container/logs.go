@@ -0,0 +1,149 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	logPollInterval = 200 * time.Millisecond
+)
+
+// LogEntry is a line of container output, as docker's json-file driver
+// stores it. Log keeps the trailing newline.
+type LogEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+func (c *ContainerService) GetContainerLogPath(container *Container) string {
+	return c.GetContainerHome(container) + "/container.log"
+}
+
+// logFile writes the output of a container as json lines.
+type logFile struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, errors.Wrap(err, "open container log")
+	}
+	return &logFile{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *logFile) write(stream string, line []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(LogEntry{Log: string(line), Stream: stream, Time: time.Now().UTC()})
+}
+
+func (l *logFile) Close() error {
+	return l.f.Close()
+}
+
+// maxLogLine is the longest line logged whole. Longer ones are split, as
+// docker does, so that output without newlines doesn't pile up in memory.
+const maxLogLine = 16 * 1024
+
+// logStream is a writer for one stream of a container, it logs whole lines.
+type logStream struct {
+	file   *logFile
+	stream string
+	buf    []byte
+}
+
+func (l *logFile) stream(name string) *logStream {
+	return &logStream{file: l, stream: name}
+}
+
+func (s *logStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		n := bytes.IndexByte(s.buf, '\n') + 1
+		if n == 0 {
+			if len(s.buf) < maxLogLine {
+				return len(p), nil
+			}
+			n = maxLogLine
+		}
+		if err := s.file.write(s.stream, s.buf[:n]); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[n:]
+	}
+}
+
+// flush logs what is left of an unterminated last line.
+func (s *logStream) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := s.file.write(s.stream, s.buf)
+	s.buf = nil
+	return err
+}
+
+// Logs calls fn with the logged output of a container. With follow it then
+// waits for more until the container has run and exited, or ctx is done.
+func (c *ContainerService) Logs(ctx context.Context, containerID string, follow bool, fn func(LogEntry) error) error {
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(c.GetContainerLogPath(container))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			var entry LogEntry
+			if err := json.Unmarshal(partial, &entry); err != nil {
+				return errors.Wrap(err, "parse container log")
+			}
+			partial = nil
+			if err := fn(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+		// Once it exited, what is there is all there will be. Containers
+		// that didn't start yet are waited for.
+		current, err := c.Inspect(containerID)
+		if err != nil || current.State.Status == StatusExited {
+			follow = false
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(logPollInterval):
+		}
+	}
+}
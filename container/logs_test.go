@@ -0,0 +1,48 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "container.log")
+	logs, err := openLogFile(path)
+	require.NoError(t, err)
+	s := logs.stream(StreamStdout)
+
+	long := bytes.Repeat([]byte("x"), maxLogLine+10)
+	for _, p := range [][]byte{[]byte("he"), []byte("llo\nwor"), long, []byte("\nend")} {
+		n, err := s.Write(p)
+		require.NoError(t, err)
+		assert.Equal(t, len(p), n)
+	}
+	assert.Equal(t, "end", string(s.buf))
+	require.NoError(t, s.flush())
+	require.NoError(t, logs.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry LogEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		lines = append(lines, entry.Log)
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{"hello\n", "wor" + string(long[:maxLogLine-3]), string(long[:13]) + "\n", "end"}, lines)
+}
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// defaultMaskedPaths are hidden from the container: kernel memory, keyrings
+// and firmware interfaces.
+var defaultMaskedPaths = []string{
+	"/proc/acpi",
+	"/proc/asound",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// defaultReadonlyPaths are visible but can't be used to reconfigure the host
+// kernel.
+var defaultReadonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// maskPath hides path: directories get an empty read-only tmpfs, files get
+// /dev/null bound over them. Paths the kernel doesn't have are skipped.
+func maskPath(path string) error {
+	err := unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+	if err == unix.ENOTDIR {
+		err = unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "size=0")
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "mask %s", path)
+	}
+	return nil
+}
+
+// readonlyPath bind mounts path onto itself read-only.
+func readonlyPath(path string) error {
+	if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "bind %s", path)
+	}
+	return remountReadonlyTree(path)
+}
+
+// remountReadonly keeps the flags already on the mount: in a user namespace
+// those inherited from the host are locked and can't be cleared.
+func remountReadonly(path string, flags uintptr) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return errors.Wrapf(err, "statfs %s", path)
+	}
+	flags |= unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY | lockedMountFlags(st.Flags)
+	return errors.Wrapf(unix.Mount("", path, "", flags, ""), "remount %s read-only", path)
+}
+
+// remountReadonlyTree remounts path and every mount below it read-only:
+// MS_REC doesn't carry the read-only flag of a bind remount to submounts.
+func remountReadonlyTree(path string) error {
+	mounts, err := mountPointsUnder(path)
+	if err != nil {
+		return err
+	}
+	for _, mp := range mounts {
+		if err := remountReadonly(mp, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockedMountFlags translates statfs ST_* flags to the matching MS_* ones.
+func lockedMountFlags(stFlags int64) uintptr {
+	var ret uintptr
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if stFlags&st != 0 {
+			ret |= ms
+		}
+	}
+	return ret
+}
+
+// applyPathRestrictions masks and write protects kernel paths, and makes the
+// root read-only if requested. It runs after every other mount is in place.
+func applyPathRestrictions(masked, readonly []string, readonlyRoot bool) error {
+	for _, p := range masked {
+		if err := maskPath(p); err != nil {
+			return err
+		}
+	}
+	for _, p := range readonly {
+		if err := readonlyPath(p); err != nil {
+			return err
+		}
+	}
+	if readonlyRoot {
+		// Only the root mount itself: /dev, /tmp, /proc and volumes stay
+		// writable.
+		return remountReadonly("/", 0)
+	}
+	return nil
+}
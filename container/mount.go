@@ -0,0 +1,334 @@
+package container
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/exfly/container/pkg/file"
+	"github.com/exfly/container/volume"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MountTypeBind   = "bind"
+	MountTypeVolume = "volume"
+	MountTypeTmpfs  = "tmpfs"
+)
+
+// Mount is a user requested mount. For volumes Source is the volume name.
+type Mount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only,omitempty"`
+	// volume only: don't seed an empty volume from the image
+	NoCopy bool `json:"no_copy,omitempty"`
+	// tmpfs only
+	TmpfsSize int64       `json:"tmpfs_size,omitempty"`
+	TmpfsMode os.FileMode `json:"tmpfs_mode,omitempty"`
+}
+
+// ParseVolumeSpec parses a -v value: host-path:dest[:ro|rw], name:dest[:ro|rw]
+// or a bare dest for an anonymous volume.
+func ParseVolumeSpec(spec string) (Mount, error) {
+	parts := strings.Split(spec, ":")
+	m := Mount{Type: MountTypeVolume}
+	switch len(parts) {
+	case 1:
+		m.Destination = parts[0]
+	case 2, 3:
+		m.Source, m.Destination = parts[0], parts[1]
+		if len(parts) == 3 {
+			switch parts[2] {
+			case "ro":
+				m.ReadOnly = true
+			case "rw":
+			default:
+				return m, errors.Errorf("invalid mode %q in volume spec %q", parts[2], spec)
+			}
+		}
+	default:
+		return m, errors.Errorf("invalid volume spec %q", spec)
+	}
+	if path.IsAbs(m.Source) {
+		m.Type = MountTypeBind
+	}
+	return m, m.validate()
+}
+
+// ParseMountSpec parses a --mount value such as
+// type=bind,source=/src,target=/dst,readonly.
+func ParseMountSpec(spec string) (Mount, error) {
+	m := Mount{Type: MountTypeVolume}
+	for _, field := range strings.Split(spec, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		key, val := strings.ToLower(strings.TrimSpace(kv[0])), ""
+		if len(kv) == 2 {
+			val = kv[1]
+		}
+		switch key {
+		case "type":
+			m.Type = val
+		case "source", "src":
+			m.Source = val
+		case "destination", "dst", "target":
+			m.Destination = val
+		case "readonly", "ro":
+			ro := true
+			if val != "" {
+				var err error
+				if ro, err = strconv.ParseBool(val); err != nil {
+					return m, errors.Errorf("invalid value for %s: %q", key, val)
+				}
+			}
+			m.ReadOnly = ro
+		case "volume-nocopy":
+			nocopy := true
+			if val != "" {
+				var err error
+				if nocopy, err = strconv.ParseBool(val); err != nil {
+					return m, errors.Errorf("invalid value for volume-nocopy: %q", val)
+				}
+			}
+			m.NoCopy = nocopy
+		case "tmpfs-size":
+			size, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return m, errors.Errorf("invalid value for tmpfs-size: %q", val)
+			}
+			m.TmpfsSize = size
+		case "tmpfs-mode":
+			mode, err := strconv.ParseUint(val, 8, 32)
+			if err != nil {
+				return m, errors.Errorf("invalid value for tmpfs-mode: %q", val)
+			}
+			m.TmpfsMode = os.FileMode(mode)
+		default:
+			return m, errors.Errorf("unexpected key %q in mount spec %q", key, spec)
+		}
+	}
+	return m, m.validate()
+}
+
+func (m Mount) validate() error {
+	if !path.IsAbs(m.Destination) {
+		return errors.Errorf("mount destination %q is not an absolute path", m.Destination)
+	}
+	switch m.Type {
+	case MountTypeBind:
+		if !path.IsAbs(m.Source) {
+			return errors.Errorf("bind source %q is not an absolute path", m.Source)
+		}
+	case MountTypeVolume:
+		if m.Source != "" && !volume.IsValidName(m.Source) {
+			return errors.Wrapf(volume.ErrInvalidName, "%q", m.Source)
+		}
+	case MountTypeTmpfs:
+		if m.Source != "" {
+			return errors.New("tmpfs mounts don't take a source")
+		}
+	default:
+		return errors.Errorf("unsupported mount type %q", m.Type)
+	}
+	return nil
+}
+
+// prepareVolumes creates the named volumes used by container, and anonymous
+// volumes for volume mounts without a source.
+func (c *ContainerService) prepareVolumes(container *Container) error {
+	for i := range container.Mounts {
+		m := &container.Mounts[i]
+		if m.Type != MountTypeVolume {
+			continue
+		}
+		vol, err := c.volSrv.Create(m.Source, nil)
+		if err != nil {
+			return err
+		}
+		m.Source = vol.Name
+		if container.usesUserns() {
+			// Hand fresh volumes to the container root, like docker does.
+			empty, err := file.IsEmptyDir(vol.Mountpoint)
+			if err != nil {
+				return err
+			}
+			if empty {
+				if err := chownToRoot(vol.Mountpoint, container); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// removeAnonymousVolumes removes the anonymous volumes created for container
+// once it is gone, named volumes are kept.
+func (c *ContainerService) removeAnonymousVolumes(container *Container) {
+	for _, m := range container.Mounts {
+		if m.Type != MountTypeVolume {
+			continue
+		}
+		vol, err := c.volSrv.Inspect(m.Source)
+		if err != nil || !vol.Anonymous {
+			continue
+		}
+		if err := c.volSrv.Remove(vol.Name); err != nil {
+			log.WithError(err).WithField("volume", vol.Name).Warn("remove anonymous volume")
+		}
+	}
+}
+
+// mountSource returns the host path backing m.
+func (c *ContainerService) mountSource(m Mount) string {
+	if m.Type == MountTypeVolume {
+		return c.volSrv.GetVolumeDataPath(m.Source)
+	}
+	return m.Source
+}
+
+// seedVolumes copies the image content under rootfs into the empty volumes
+// of container, before they are mounted over it.
+func (c *ContainerService) seedVolumes(container *Container, rootfs string) error {
+	for _, m := range container.Mounts {
+		if m.Type != MountTypeVolume || m.NoCopy {
+			continue
+		}
+		target, err := file.SecureJoin(rootfs, m.Destination)
+		if err != nil {
+			return errors.Wrapf(err, "resolve mount point %s", m.Destination)
+		}
+		if err := seedVolume(c.mountSource(m), target); err != nil {
+			return errors.Wrapf(err, "copy image content into volume %s", m.Source)
+		}
+	}
+	return nil
+}
+
+// setupMounts mounts the bind and tmpfs mounts of a spec under rootfs. It
+// runs in child-mode before the root is switched, so destinations are
+// resolved inside rootfs: symlinks of the image must not lead to the host.
+func setupMounts(mounts []Mount, rootfs string) error {
+	for _, m := range mounts {
+		target, err := file.SecureJoin(rootfs, m.Destination)
+		if err != nil {
+			return errors.Wrapf(err, "resolve mount point %s", m.Destination)
+		}
+		if m.Type == MountTypeTmpfs {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return errors.Wrapf(err, "create mount point %s", m.Destination)
+			}
+			var flags uintptr = syscall.MS_NOSUID | syscall.MS_NODEV
+			if m.ReadOnly {
+				flags |= syscall.MS_RDONLY
+			}
+			if err := syscall.Mount("tmpfs", target, "tmpfs", flags, m.tmpfsOptions()); err != nil {
+				return errors.Wrapf(err, "mount tmpfs on %s", m.Destination)
+			}
+			continue
+		}
+
+		source := m.Source
+		info, err := os.Stat(source)
+		if err != nil {
+			return errors.Wrapf(err, "mount source %s", source)
+		}
+		if err := createMountPoint(target, info.IsDir()); err != nil {
+			return errors.Wrapf(err, "create mount point %s", m.Destination)
+		}
+		if err := syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return errors.Wrapf(err, "bind mount %s on %s", source, m.Destination)
+		}
+		if m.ReadOnly {
+			// MS_RDONLY is ignored on the initial bind, it takes a remount,
+			// of the mounts below it too.
+			if err := remountReadonlyTree(target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// teardownMounts unmounts the mounts setupMounts made, seen from inside the
+// new root, in reverse order.
+func teardownMounts(mounts []Mount) {
+	for i := len(mounts) - 1; i >= 0; i-- {
+		dest := mounts[i].Destination
+		if err := syscall.Unmount(dest, syscall.MNT_DETACH); err != nil {
+			log.WithError(err).WithField("mount", dest).Warn("unmount")
+		}
+	}
+}
+
+// seedVolume copies the image content at target into the volume directory
+// source if the volume is still empty, so the volume starts out looking like
+// the image did.
+func seedVolume(source, target string) error {
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	empty, err := file.IsEmptyDir(source)
+	if err != nil || !empty {
+		return err
+	}
+	log.WithField("path", target).Debug("seed volume")
+	return file.CopyTree(target, source)
+}
+
+// addImageVolumes adds an anonymous volume for every image VOLUME that isn't
+// already covered by a user mount. The image is not trusted more than the
+// user: its volumes are validated like user mounts.
+func addImageVolumes(container *Container) error {
+	for _, dest := range container.Volumes {
+		if err := (Mount{Type: MountTypeVolume, Destination: dest}).validate(); err != nil {
+			return errors.Wrap(err, "image volume")
+		}
+		covered := false
+		for _, m := range container.Mounts {
+			if path.Clean(m.Destination) == path.Clean(dest) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			container.Mounts = append(container.Mounts, Mount{Type: MountTypeVolume, Destination: path.Clean(dest)})
+		}
+	}
+	return nil
+}
+
+func (m Mount) tmpfsOptions() string {
+	var opts []string
+	if m.TmpfsSize > 0 {
+		opts = append(opts, "size="+strconv.FormatInt(m.TmpfsSize, 10))
+	}
+	if m.TmpfsMode != 0 {
+		opts = append(opts, "mode="+strconv.FormatUint(uint64(m.TmpfsMode), 8))
+	}
+	return strings.Join(opts, ",")
+}
+
+func createMountPoint(target string, isDir bool) error {
+	if isDir {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
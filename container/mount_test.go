@@ -0,0 +1,41 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVolumeSpec(t *testing.T) {
+	m, err := ParseVolumeSpec("/src:/dst:ro")
+	assert.NoError(t, err)
+	assert.Equal(t, Mount{Type: MountTypeBind, Source: "/src", Destination: "/dst", ReadOnly: true}, m)
+
+	m, err = ParseVolumeSpec("cache:/root/.cache")
+	assert.NoError(t, err)
+	assert.Equal(t, Mount{Type: MountTypeVolume, Source: "cache", Destination: "/root/.cache"}, m)
+
+	m, err = ParseVolumeSpec("/data")
+	assert.NoError(t, err)
+	assert.Equal(t, Mount{Type: MountTypeVolume, Destination: "/data"}, m)
+
+	_, err = ParseVolumeSpec("/src:relative")
+	assert.Error(t, err)
+	_, err = ParseVolumeSpec("/src:/dst:rx")
+	assert.Error(t, err)
+}
+
+func TestParseMountSpec(t *testing.T) {
+	m, err := ParseMountSpec("type=bind,src=/src,target=/dst,readonly")
+	assert.NoError(t, err)
+	assert.Equal(t, Mount{Type: MountTypeBind, Source: "/src", Destination: "/dst", ReadOnly: true}, m)
+
+	m, err = ParseMountSpec("type=tmpfs,destination=/run,tmpfs-size=1024,tmpfs-mode=1777")
+	assert.NoError(t, err)
+	assert.Equal(t, "size=1024,mode=1777", m.tmpfsOptions())
+
+	_, err = ParseMountSpec("type=nfs,target=/dst")
+	assert.Error(t, err)
+	_, err = ParseMountSpec("type=volume,src=../x,target=/dst")
+	assert.Error(t, err)
+}
@@ -0,0 +1,190 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// NamespaceHost shares a namespace with the host, "container:<id>" with a
+// running container and "ns:<path>" joins the namespace at path, such as
+// /proc/<pid>/ns/ipc. The default, "", is a namespace of its own.
+const (
+	NamespaceHost = "host"
+
+	containerPrefix = "container:"
+	nsPathPrefix    = "ns:"
+)
+
+// timeClocks are the clocks a time namespace can offset.
+var timeClocks = map[string]bool{"monotonic": true, "boottime": true}
+
+// validateNamespaceMode checks a --pid, --ipc or --uts value.
+func validateNamespaceMode(flag, mode string) error {
+	switch {
+	case mode == "" || mode == NamespaceHost:
+	case strings.HasPrefix(mode, containerPrefix) && mode != containerPrefix:
+	case strings.HasPrefix(mode, nsPathPrefix) && mode != nsPathPrefix:
+	default:
+		return errors.Errorf("invalid --%s %q, want host, container:<id> or ns:<path>", flag, mode)
+	}
+	return nil
+}
+
+func validateNamespaces(container *Container) error {
+	for flag, mode := range map[string]string{"pid": container.PidMode, "ipc": container.IpcMode, "uts": container.UtsMode} {
+		if err := validateNamespaceMode(flag, mode); err != nil {
+			return err
+		}
+	}
+	for clock := range container.TimeOffsets {
+		if !timeClocks[clock] {
+			return errors.Errorf("invalid time offset clock %q, want monotonic or boottime", clock)
+		}
+	}
+	return nil
+}
+
+// ParseTimeOffset parses a --time-offset value, clock=duration.
+func ParseTimeOffset(spec string) (string, time.Duration, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || !timeClocks[kv[0]] {
+		return "", 0, errors.Errorf("invalid time offset %q, want monotonic|boottime=duration", spec)
+	}
+	d, err := time.ParseDuration(kv[1])
+	if err != nil {
+		return "", 0, errors.Errorf("invalid time offset %q", spec)
+	}
+	return kv[0], d, nil
+}
+
+// cloneFlags are the namespaces child-mode is started in.
+func (container *Container) cloneFlags() uintptr {
+	flags := uintptr(syscall.CLONE_NEWNS)
+	if container.PidMode == "" {
+		flags |= syscall.CLONE_NEWPID
+	}
+	if container.UtsMode == "" {
+		flags |= syscall.CLONE_NEWUTS
+	}
+	if container.IpcMode == "" {
+		flags |= syscall.CLONE_NEWIPC
+	}
+	if container.usesUserns() {
+		flags |= syscall.CLONE_NEWUSER
+	}
+	if container.usesNetns() {
+		flags |= syscall.CLONE_NEWNET
+	}
+	return flags
+}
+
+// sharedNamespaces returns the paths of the namespaces child-mode joins, by
+// their name in /proc/<pid>/ns.
+func (c *ContainerService) sharedNamespaces(container *Container) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, ns := range []struct{ name, mode string }{
+		{"ipc", container.IpcMode},
+		{"uts", container.UtsMode},
+		{"net", container.Network},
+		{"pid", container.PidMode},
+	} {
+		switch {
+		case strings.HasPrefix(ns.mode, nsPathPrefix):
+			ret[ns.name] = strings.TrimPrefix(ns.mode, nsPathPrefix)
+		case strings.HasPrefix(ns.mode, containerPrefix):
+			id := strings.TrimPrefix(ns.mode, containerPrefix)
+			other, err := c.unmarshalContainer(id)
+			if err != nil {
+				return nil, errors.Wrapf(err, "--%s %s", ns.name, ns.mode)
+			}
+			if !other.State.IsRunning() {
+				return nil, errors.Errorf("--%s %s: container is not running", ns.name, ns.mode)
+			}
+			ret[ns.name] = fmt.Sprintf("/proc/%d/ns/%s", other.State.Pid, ns.name)
+		}
+	}
+	return ret, nil
+}
+
+// joinNamespaces moves the calling thread, which must be locked, into the
+// shared namespaces, so that the processes it starts are created in them.
+// A pid namespace only applies to those processes.
+func joinNamespaces(shared map[string]string) error {
+	for _, ns := range []string{"ipc", "uts", "net", "pid"} {
+		if path, ok := shared[ns]; ok {
+			if err := joinNamespacePath(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ownsNamespace reports whether linux gives the container a new namespace
+// of type typ, rather than none or one to join.
+func ownsNamespace(linux *specs.Linux, typ specs.LinuxNamespaceType) bool {
+	for _, ns := range linux.Namespaces {
+		if ns.Type == typ {
+			return ns.Path == ""
+		}
+	}
+	return false
+}
+
+// unshareLateNamespaces gives the processes the calling thread starts the
+// new cgroup and time namespaces linux asks for. It runs in child-mode once
+// it is in the container cgroup, which becomes the cgroup namespace root, on
+// the main thread: time offsets can only be set for the thread group leader.
+func unshareLateNamespaces(linux *specs.Linux) error {
+	if ownsNamespace(linux, specs.CgroupNamespace) {
+		if err := unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+			return errors.Wrap(err, "unshare cgroup namespace")
+		}
+	}
+	if !ownsNamespace(linux, specs.TimeNamespace) {
+		return nil
+	}
+	err := unix.Unshare(unix.CLONE_NEWTIME)
+	if err == unix.EINVAL && len(linux.TimeOffsets) == 0 {
+		// No time namespaces in this kernel, and nothing to offset.
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "unshare time namespace")
+	}
+	var offsets []string
+	for clock, o := range linux.TimeOffsets {
+		d := time.Duration(o.Secs)*time.Second + time.Duration(o.Nanosecs)
+		offsets = append(offsets, timeOffsetLine(clock, d))
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	// Writable until the first process enters the namespace.
+	err = ioutil.WriteFile("/proc/self/timens_offsets", []byte(strings.Join(offsets, "\n")), 0)
+	return errors.Wrap(err, "set time namespace offsets")
+}
+
+// timeOffsetLine formats an offset for timens_offsets.
+func timeOffsetLine(clock string, d time.Duration) string {
+	secs, nsecs := splitTimeOffset(d)
+	return fmt.Sprintf("%s %d %d", clock, secs, nsecs)
+}
+
+// splitTimeOffset splits d into seconds and nanoseconds, which can't be
+// negative.
+func splitTimeOffset(d time.Duration) (int64, int64) {
+	secs, nsecs := int64(d/time.Second), int64(d%time.Second)
+	if nsecs < 0 {
+		secs--
+		nsecs += int64(time.Second)
+	}
+	return secs, nsecs
+}
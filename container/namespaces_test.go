@@ -0,0 +1,37 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneFlags(t *testing.T) {
+	c := &Container{Network: NetworkHost}
+	assert.Equal(t, uintptr(syscall.CLONE_NEWNS|syscall.CLONE_NEWPID|syscall.CLONE_NEWUTS|syscall.CLONE_NEWIPC), c.cloneFlags())
+
+	c = &Container{Network: NetworkNone, PidMode: NamespaceHost, IpcMode: "container:abc"}
+	assert.Equal(t, uintptr(syscall.CLONE_NEWNS|syscall.CLONE_NEWUTS|syscall.CLONE_NEWNET), c.cloneFlags())
+}
+
+func TestValidateNamespaces(t *testing.T) {
+	assert.NoError(t, validateNamespaces(&Container{PidMode: "host", UtsMode: "container:abc", IpcMode: "ns:/proc/1/ns/ipc"}))
+	assert.Error(t, validateNamespaces(&Container{IpcMode: "container:"}))
+	assert.Error(t, validateNamespaces(&Container{PidMode: "private"}))
+}
+
+func TestTimeOffset(t *testing.T) {
+	clock, d, err := ParseTimeOffset("boottime=-1500ms")
+	require.NoError(t, err)
+	assert.Equal(t, "boottime", clock)
+	assert.Equal(t, "boottime -2 500000000", timeOffsetLine(clock, d))
+	assert.Equal(t, "monotonic 86400 0", timeOffsetLine("monotonic", 24*time.Hour))
+
+	for _, spec := range []string{"realtime=1s", "monotonic", "monotonic=x"} {
+		_, _, err := ParseTimeOffset(spec)
+		assert.Error(t, err, spec)
+	}
+}
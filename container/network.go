@@ -0,0 +1,132 @@
+package container
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	NetworkHost = "host"
+	NetworkNone = "none"
+)
+
+// applyNetwork defaults and validates the network mode: host, none or
+// ns:<path> to join a network namespace. Rootless containers can't use the
+// host network namespace sensibly, they get their own, with a helper such as
+// slirp4netns to reach the outside.
+func applyNetwork(container *Container) error {
+	if container.Network == "" {
+		container.Network = NetworkHost
+		if container.Rootless || container.NetworkHelper != "" {
+			container.Network = NetworkNone
+		}
+	}
+	switch {
+	case container.Network == NetworkHost || container.Network == NetworkNone:
+	case strings.HasPrefix(container.Network, nsPathPrefix) && container.Network != nsPathPrefix:
+	default:
+		return errors.Errorf("invalid network %q", container.Network)
+	}
+	if container.NetworkHelper != "" && container.Network != NetworkNone {
+		return errors.Errorf("--network-helper needs a network namespace of its own, not --network=%s", container.Network)
+	}
+	return nil
+}
+
+// usesNetns reports whether container gets a network namespace of its own.
+func (container *Container) usesNetns() bool {
+	return container.Network == NetworkNone
+}
+
+// NetworkNamespacePath returns the path of the network namespace container
+// joins, empty unless its network is ns:<path>.
+func (container *Container) NetworkNamespacePath() string {
+	if !strings.HasPrefix(container.Network, nsPathPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(container.Network, nsPathPrefix)
+}
+
+// DialInNamespace connects to addr from inside the network namespace at
+// nsPath. The socket stays in that namespace.
+func DialInNamespace(nsPath, network, addr string, timeout time.Duration) (net.Conn, error) {
+	var conn net.Conn
+	err := onThrowawayThread(func() (err error) {
+		if err := joinNamespacePath(nsPath); err != nil {
+			return err
+		}
+		conn, err = net.DialTimeout(network, addr, timeout)
+		return err
+	})
+	return conn, err
+}
+
+// startNetworkHelper runs the network helper of container for its init
+// process pid. {pid} in the helper command is replaced by the pid, which is
+// appended otherwise, e.g. "slirp4netns --configure --mtu=65520 {pid} tap0".
+func startNetworkHelper(container *Container, pid int) (*exec.Cmd, error) {
+	if container.NetworkHelper == "" {
+		return nil, nil
+	}
+	args := strings.Fields(container.NetworkHelper)
+	replaced := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{pid}") {
+			args[i] = strings.Replace(arg, "{pid}", strconv.Itoa(pid), -1)
+			replaced = true
+		}
+	}
+	if !replaced {
+		args = append(args, strconv.Itoa(pid))
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "start network helper")
+	}
+	log.WithField("args", args).Debug("network helper started")
+	return cmd, nil
+}
+
+func stopNetworkHelper(cmd *exec.Cmd) {
+	if cmd == nil {
+		return
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+}
+
+// SetupLoopback brings lo up in a new network namespace.
+func SetupLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrap(err, "socket")
+	}
+	defer unix.Close(fd)
+
+	// struct ifreq with ifr_flags.
+	var ifr struct {
+		name  [unix.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(ifr.name[:], "lo")
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return errors.Wrap(errno, "get lo flags")
+	}
+	ifr.flags |= unix.IFF_UP
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return errors.Wrap(errno, "bring lo up")
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyNetwork(t *testing.T) {
+	c := &Container{}
+	assert.NoError(t, applyNetwork(c))
+	assert.Equal(t, NetworkHost, c.Network)
+
+	c = &Container{Rootless: true}
+	assert.NoError(t, applyNetwork(c))
+	assert.Equal(t, NetworkNone, c.Network)
+	assert.True(t, c.usesNetns())
+
+	c = &Container{NetworkHelper: "slirp4netns {pid} tap0"}
+	assert.NoError(t, applyNetwork(c))
+	assert.Equal(t, NetworkNone, c.Network)
+
+	assert.Error(t, applyNetwork(&Container{Network: NetworkHost, NetworkHelper: "slirp4netns"}))
+	assert.Error(t, applyNetwork(&Container{Network: "bridge"}))
+}
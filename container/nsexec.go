@@ -0,0 +1,347 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/exfly/container/pkg/cgroups"
+	pkgenv "github.com/exfly/container/pkg/env"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const defaultPathEnv = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// namespaces joined by execInContainer. The mount and time namespaces can't
+// be joined from a multi-threaded process: we chroot into /proc/<pid>/root
+// instead, and exec'd processes see the host clocks.
+var execNamespaces = []string{"ipc", "uts", "net", "pid"}
+
+type execOpts struct {
+	Args []string
+	Env  []string
+	Dir  string
+	User string
+	// Capabilities restricts the process, nil keeps those of the caller.
+	Capabilities *Capabilities
+	// Seccomp is installed before the process starts, nil for none.
+	Seccomp         []unix.SockFilter
+	NoNewPrivileges bool
+	// UIDMappings and GIDMappings are those of a container with a user
+	// namespace. Go can't join one from a multi-threaded process, so the
+	// process runs with the host ids its user maps to instead, which leaves
+	// container root without capabilities.
+	UIDMappings []IDMap
+	GIDMappings []IDMap
+	// Cgroup is the cgroup the process starts in, for the limits and device
+	// rules of the container to apply to it. nil leaves it in ours.
+	Cgroup *cgroups.Manager
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// execInContainer runs a process inside the namespaces and root of the
+// container whose init process is pid, and returns its exit code.
+func execInContainer(ctx context.Context, pid int, opts execOpts) (int, error) {
+	cmd, err := startInContainer(ctx, pid, opts)
+	if err != nil {
+		return -1, err
+	}
+	return waitInContainer(cmd)
+}
+
+// startInContainer starts the process execInContainer runs.
+func startInContainer(ctx context.Context, pid int, opts execOpts) (*exec.Cmd, error) {
+	if len(opts.Args) == 0 {
+		return nil, errors.New("exec: no command")
+	}
+	var cmd *exec.Cmd
+	err := onThrowawayThread(func() (err error) {
+		cmd, err = startOnLockedThread(ctx, pid, opts)
+		return err
+	})
+	return cmd, err
+}
+
+// waitInContainer waits for a process startInContainer started and returns
+// its exit code.
+func waitInContainer(cmd *exec.Cmd) (int, error) {
+	// Wait off the throwaway thread, whose syscalls may now be filtered.
+	err := cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "exec in container")
+	}
+	return 0, nil
+}
+
+// execProcess runs a process in container like execInContainer, unless it
+// is paused: the process would start frozen in its cgroup, on cgroup v1
+// with the thread starting it. Pause waits for it to have started.
+func (c *ContainerService) execProcess(ctx context.Context, container *Container, opts execOpts) (int, error) {
+	c.lifecycleMu.Lock()
+	if c.isPaused(*container.ContainerID) {
+		c.lifecycleMu.Unlock()
+		return -1, errors.Wrapf(ErrPaused, "%s", *container.ContainerID)
+	}
+	cmd, err := startInContainer(ctx, container.State.Pid, opts)
+	c.lifecycleMu.Unlock()
+	if err != nil {
+		return -1, err
+	}
+	return waitInContainer(cmd)
+}
+
+// onThrowawayThread runs fn on an OS thread of its own that is thrown away
+// afterwards, for fn to change per-thread state such as namespaces and
+// capabilities.
+func onThrowawayThread(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		// Never unlocked: the thread exits with the goroutine.
+		runtime.LockOSThread()
+		done <- fn()
+	}()
+	return <-done
+}
+
+// offLockedThread runs fn on another thread than the calling goroutine, which
+// is locked to its thread.
+func offLockedThread(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	return <-done
+}
+
+func startOnLockedThread(ctx context.Context, pid int, opts execOpts) (*exec.Cmd, error) {
+	for _, ns := range execNamespaces {
+		if err := joinNamespace(pid, ns); err != nil {
+			return nil, err
+		}
+	}
+	root := fmt.Sprintf("/proc/%d/root", pid)
+	user, err := resolveUser(root, opts.User)
+	if err != nil {
+		return nil, err
+	}
+	env := userEnv(opts.Env, user)
+	path, err := lookPathInRoot(root, opts.Args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	cred := user.credential()
+	if len(opts.UIDMappings) != 0 {
+		if cred, err = hostCredential(cred, opts.UIDMappings, opts.GIDMappings); err != nil {
+			return nil, err
+		}
+	}
+	cmd := exec.CommandContext(ctx, path, opts.Args[1:]...)
+	cmd.Args[0] = opts.Args[0]
+	cmd.Env = env
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	// On cgroup v1 the process starts in the cgroup of the thread forking
+	// it. Threads can't join one of their own on v2: the process starts
+	// traced instead, to stop at exec until it was moved.
+	traced := opts.Cgroup != nil && opts.Cgroup.IsUnified()
+	if opts.Cgroup != nil && !traced {
+		// The device rules of the cgroup apply to this thread too: the
+		// missing streams are opened before it joins.
+		devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer devNull.Close()
+		if cmd.Stdin == nil {
+			cmd.Stdin = devNull
+		}
+		if cmd.Stdout == nil {
+			cmd.Stdout = devNull
+		}
+		if cmd.Stderr == nil {
+			cmd.Stderr = devNull
+		}
+		// This thread may be the main thread, which never exits: it leaves
+		// once the process started.
+		restore, err := opts.Cgroup.ApplyThread(unix.Gettid())
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := restore(); err != nil {
+				log.WithError(err).Warn("leave container cgroup")
+			}
+		}()
+	}
+	if err := restrictThread(opts.Capabilities, opts.Seccomp, opts.NoNewPrivileges); err != nil {
+		return nil, err
+	}
+	cmd.Dir = opts.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = "/"
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Chroot:     root,
+		Credential: cred,
+		Ptrace:     traced,
+	}
+	if opts.Capabilities != nil {
+		cmd.SysProcAttr.AmbientCaps = ambientCaps(opts.Capabilities)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "exec in container")
+	}
+	if traced {
+		// Off this thread, whose syscalls may be filtered: the filter
+		// allows ptrace, the process could not have been traced otherwise.
+		err = offLockedThread(func() error {
+			return enterCgroupStopped(cmd.Process.Pid, opts.Cgroup)
+		})
+		if err == nil {
+			// Only the tracer can let it go, this thread.
+			err = errors.Wrap(unix.PtraceDetach(cmd.Process.Pid), "detach exec")
+		}
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// enterCgroupStopped moves pid, started traced, into cgroup once it stopped
+// at exec. Waiting for the stop discards its SIGTRAP.
+func enterCgroupStopped(pid int, cgroup *cgroups.Manager) error {
+	var ws unix.WaitStatus
+	if _, err := unix.Wait4(pid, &ws, 0, nil); err != nil {
+		return errors.Wrap(err, "wait for exec")
+	}
+	if !ws.Stopped() {
+		return errors.New("exec in container: process did not stop at exec")
+	}
+	return cgroup.Apply(pid)
+}
+
+func joinNamespace(pid int, ns string) error {
+	return joinNamespacePath(fmt.Sprintf("/proc/%d/ns/%s", pid, ns))
+}
+
+func joinNamespacePath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", path)
+	}
+	defer f.Close()
+	if err := unix.Setns(int(f.Fd()), 0); err != nil {
+		return errors.Wrapf(err, "setns %s", path)
+	}
+	return nil
+}
+
+// lookPathInRoot resolves file against the PATH in env, looking inside root
+// rather than the host filesystem. The returned path is relative to root.
+func lookPathInRoot(root, file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	pathEnv := defaultPathEnv
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			pathEnv = strings.TrimPrefix(kv, "PATH=")
+		}
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		candidate := filepath.Join("/", dir, file)
+		// Lstat: absolute symlinks would otherwise resolve on the host.
+		info, err := os.Lstat(filepath.Join(root, candidate))
+		if err == nil && (info.Mode()&os.ModeSymlink != 0 || (info.Mode().IsRegular() && info.Mode()&0111 != 0)) {
+			return candidate, nil
+		}
+	}
+	return "", errors.Errorf("exec: %q: executable file not found in $PATH", file)
+}
+
+// ExecConfig describes a process to start in a running container.
+type ExecConfig struct {
+	Args []string
+	// Env is merged over the container environment.
+	Env []string
+	// CapAdd and CapDrop tweak the container capabilities.
+	CapAdd  []string
+	CapDrop []string
+	// Stdin, Stdout and Stderr default to ours when none is set.
+	Stdin  io.Reader `json:"-"`
+	Stdout io.Writer `json:"-"`
+	Stderr io.Writer `json:"-"`
+}
+
+// Exec runs a process inside a running container and returns its exit code.
+func (c *ContainerService) Exec(ctx context.Context, containerID string, cfg ExecConfig) (int, error) {
+	container, err := c.unmarshalContainer(containerID)
+	if err != nil {
+		return -1, err
+	}
+	if !container.State.IsRunning() {
+		return -1, errors.Wrapf(ErrNotRunning, "%s", containerID)
+	}
+	if container.State.Paused {
+		return -1, errors.Wrapf(ErrPaused, "%s", containerID)
+	}
+	if container.Rootless {
+		return -1, errors.New("exec is not supported in rootless mode")
+	}
+	if cfg.Stdin == nil && cfg.Stdout == nil && cfg.Stderr == nil {
+		cfg.Stdin, cfg.Stdout, cfg.Stderr = os.Stdin, os.Stdout, os.Stderr
+	}
+	caps, err := c.execCapabilities(container, cfg)
+	if err != nil {
+		return -1, err
+	}
+	filter, err := seccompFilter(container, caps)
+	if err != nil {
+		return -1, err
+	}
+	return c.execProcess(ctx, container, execOpts{
+		Args:            cfg.Args,
+		Env:             pkgenv.Merge(container.Env, cfg.Env),
+		Dir:             container.WorkingDir,
+		User:            container.User,
+		Capabilities:    caps,
+		Seccomp:         filter,
+		NoNewPrivileges: container.NoNewPrivileges,
+		UIDMappings:     container.UIDMappings,
+		GIDMappings:     container.GIDMappings,
+		Cgroup:          c.execCgroup(container),
+		Stdin:           cfg.Stdin,
+		Stdout:          cfg.Stdout,
+		Stderr:          cfg.Stderr,
+	})
+}
+
+func (c *ContainerService) execCapabilities(container *Container, cfg ExecConfig) (*Capabilities, error) {
+	var base []string
+	if container.Capabilities != nil {
+		base = container.Capabilities.Bounding
+	}
+	caps, err := tweakCapabilities(base, cfg.CapAdd, cfg.CapDrop)
+	if err != nil {
+		return nil, err
+	}
+	return newCapabilities(caps), nil
+}
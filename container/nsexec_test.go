@@ -0,0 +1,34 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/exfly/container/pkg/cgroups"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecInContainerCgroup(t *testing.T) {
+	m := cgroups.NewManager("container-test-exec")
+	if os.Geteuid() != 0 || m.Create() != nil {
+		t.Skip("needs root and cgroups")
+	}
+	defer m.Destroy()
+	// /dev/zero only.
+	require.NoError(t, m.SetDevices([]cgroups.DeviceRule{{Type: 'c', Major: 1, Minor: 5, Access: "rwm"}}))
+
+	var out bytes.Buffer
+	code, err := execInContainer(context.Background(), os.Getpid(), execOpts{
+		Args:   []string{"sh", "-c", "grep -q container-test-exec /proc/self/cgroup || exit 42; head -c1 /dev/zero >&2; echo > /dev/null"},
+		Cgroup: m,
+		Stdout: &out,
+		Stderr: &out,
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, []int{0, 42}, code, out.String())
+	assert.Contains(t, out.String(), "/dev/null")
+	assert.Contains(t, out.String(), "not permitted")
+}
@@ -0,0 +1,80 @@
+package container
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pause freezes all the processes of a running container until Unpause.
+// They stay where they are, in memory, without getting any CPU time.
+func (c *ContainerService) Pause(containerID string) error {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if !container.State.IsRunning() || !processAlive(container.State.Pid) {
+		return errors.Wrapf(ErrNotRunning, "%s", containerID)
+	}
+	if container.State.Paused {
+		return errors.Wrapf(ErrPaused, "%s", containerID)
+	}
+	if err := c.cgroupManager(container).Freeze(); err != nil {
+		return errors.Wrapf(err, "pause container %s", containerID)
+	}
+	return c.setPaused(containerID, true)
+}
+
+// Unpause thaws a paused container.
+func (c *ContainerService) Unpause(containerID string) error {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	container, err := c.Inspect(containerID)
+	if err != nil {
+		return err
+	}
+	if !container.State.Paused {
+		return errors.Wrapf(ErrNotPaused, "%s", containerID)
+	}
+	if err := c.cgroupManager(container).Thaw(); err != nil {
+		return errors.Wrapf(err, "unpause container %s", containerID)
+	}
+	return c.setPaused(containerID, false)
+}
+
+// thawSignaled thaws a paused container that was just sent a signal:
+// frozen processes don't act on signals, on cgroup v1 not even on SIGKILL.
+func (c *ContainerService) thawSignaled(container *Container) {
+	if !container.State.Paused {
+		return
+	}
+	id := *container.ContainerID
+	if err := c.cgroupManager(container).Thaw(); err != nil {
+		log.WithError(err).WithField("container", id).Warn("thaw signaled container")
+		return
+	}
+	if err := c.setPaused(id, false); err != nil {
+		log.WithError(err).WithField("container", id).Warn("record container thawed")
+	}
+}
+
+// setPaused records whether a container is paused in its state as on disk,
+// not in a copy whoever runs the container may write back: that one gets it
+// from isPaused.
+func (c *ContainerService) setPaused(containerID string, paused bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	container, err := c.unmarshalContainer(containerID)
+	if err != nil {
+		return err
+	}
+	container.State.Paused = paused
+	return c.marshalContainer(container)
+}
+
+// isPaused reports whether a container is recorded as paused.
+func (c *ContainerService) isPaused(containerID string) bool {
+	container, err := c.unmarshalContainer(containerID)
+	return err == nil && container.State.Paused
+}
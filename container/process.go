@@ -0,0 +1,73 @@
+package container
+
+import (
+	"path"
+	"sort"
+
+	"github.com/exfly/container/image"
+	pkgenv "github.com/exfly/container/pkg/env"
+
+	"github.com/pkg/errors"
+)
+
+// applyImageConfig fills the process config of container from the image
+// config, following docker: overriding the entrypoint also drops the image
+// Cmd, and positional args replace Cmd.
+func applyImageConfig(container *Container, cfg image.ImageMetadataDetails) error {
+	if container.Entrypoint == nil {
+		container.Entrypoint = cfg.Entrypoint
+		if container.Cmd == nil {
+			container.Cmd = cfg.Cmd
+		}
+	}
+	container.Env = pkgenv.Merge(cfg.Env, container.Env)
+	if _, ok := pkgenv.Lookup(container.Env, "PATH"); !ok {
+		container.Env = append([]string{"PATH=" + defaultPathEnv}, container.Env...)
+	}
+	if container.WorkingDir == "" {
+		container.WorkingDir = cfg.WorkingDir
+	}
+	if container.WorkingDir != "" && !path.IsAbs(container.WorkingDir) {
+		return errors.Errorf("working directory %q is not an absolute path", container.WorkingDir)
+	}
+	if container.User == "" {
+		container.User = cfg.User
+	}
+	if container.StopSignal == "" {
+		container.StopSignal = cfg.StopSignal
+	}
+	if len(cfg.Labels) != 0 {
+		labels := make(map[string]string, len(cfg.Labels)+len(container.Labels))
+		for k, v := range cfg.Labels {
+			labels[k] = v
+		}
+		for k, v := range container.Labels {
+			labels[k] = v
+		}
+		container.Labels = labels
+	}
+	container.ExposedPorts = sortedKeys(cfg.ExposedPorts)
+	container.Volumes = sortedKeys(cfg.Volumes)
+	if err := addImageVolumes(container); err != nil {
+		return err
+	}
+	container.Healthcheck = mergeHealthConfig(cfg.Healthcheck, container.Healthcheck)
+
+	container.Args = append(append([]string{}, container.Entrypoint...), container.Cmd...)
+	if len(container.Args) == 0 {
+		return errors.New("no command specified")
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
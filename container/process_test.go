@@ -0,0 +1,44 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/exfly/container/image"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyImageConfig(t *testing.T) {
+	cfg := image.ImageMetadataDetails{
+		Entrypoint: []string{"/entrypoint.sh"},
+		Cmd:        []string{"serve"},
+		WorkingDir: "/app",
+	}
+
+	c := &Container{}
+	assert.NoError(t, applyImageConfig(c, cfg))
+	assert.Equal(t, []string{"/entrypoint.sh", "serve"}, c.Args)
+	assert.Equal(t, "/app", c.WorkingDir)
+
+	c = &Container{Cmd: []string{"migrate"}}
+	assert.NoError(t, applyImageConfig(c, cfg))
+	assert.Equal(t, []string{"/entrypoint.sh", "migrate"}, c.Args)
+
+	c = &Container{Entrypoint: []string{"/bin/sh"}}
+	assert.NoError(t, applyImageConfig(c, cfg))
+	assert.Equal(t, []string{"/bin/sh"}, c.Args)
+
+	c = &Container{Entrypoint: []string{}}
+	assert.Error(t, applyImageConfig(c, cfg))
+
+	c = &Container{WorkingDir: "relative"}
+	assert.Error(t, applyImageConfig(c, cfg))
+
+	cfg.Volumes = map[string]struct{}{"/data/../var/lib": {}}
+	c = &Container{}
+	assert.NoError(t, applyImageConfig(c, cfg))
+	assert.Equal(t, []Mount{{Type: MountTypeVolume, Destination: "/var/lib"}}, c.Mounts)
+
+	cfg.Volumes = map[string]struct{}{"data": {}}
+	assert.Error(t, applyImageConfig(&Container{}, cfg))
+}
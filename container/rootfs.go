@@ -0,0 +1,207 @@
+package container
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var mountPropagation = map[string]uintptr{
+	"private":  unix.MS_PRIVATE,
+	"rprivate": unix.MS_PRIVATE | unix.MS_REC,
+	"slave":    unix.MS_SLAVE,
+	"rslave":   unix.MS_SLAVE | unix.MS_REC,
+	"shared":   unix.MS_SHARED,
+	"rshared":  unix.MS_SHARED | unix.MS_REC,
+}
+
+const defaultRootfsPropagation = "rprivate"
+
+func validatePropagation(p string) error {
+	if p == "" {
+		return nil
+	}
+	if _, ok := mountPropagation[p]; !ok {
+		return errors.Errorf("invalid rootfs propagation %q", p)
+	}
+	return nil
+}
+
+// prepareRootfs detaches the new mount namespace from the host according to
+// propagation and turns rootfs into a mount point of its own, so that it can
+// be pivoted into. It runs in child-mode before any container mount.
+func prepareRootfs(rootfs, propagation string) error {
+	if propagation == "" {
+		propagation = defaultRootfsPropagation
+	}
+	flags, ok := mountPropagation[propagation]
+	if !ok {
+		return errors.Errorf("invalid rootfs propagation %q", propagation)
+	}
+	if err := unix.Mount("", "/", "", flags, ""); err != nil {
+		return errors.Wrapf(err, "make / %s", propagation)
+	}
+	// pivot_root refuses a new root whose parent mount is shared.
+	if flags&unix.MS_SHARED != 0 {
+		parent, err := mountPointOf(filepath.Dir(rootfs))
+		if err != nil {
+			return err
+		}
+		if err := unix.Mount("", parent, "", unix.MS_PRIVATE, ""); err != nil {
+			return errors.Wrapf(err, "make %s private", parent)
+		}
+	}
+	if err := unix.Mount(rootfs, rootfs, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.Wrap(err, "bind rootfs onto itself")
+	}
+	return nil
+}
+
+// enterRootfs makes rootfs the root of the mount namespace. pivot_root is
+// used unless noPivot is set, in which case we fall back to chroot, which
+// works on a ramfs root but leaves the old root reachable.
+func enterRootfs(rootfs string, noPivot bool) error {
+	if noPivot {
+		if err := unix.Chroot(rootfs); err != nil {
+			return errors.Wrap(err, "chroot")
+		}
+		return errors.Wrap(unix.Chdir("/"), "chdir")
+	}
+	return pivotRoot(rootfs)
+}
+
+// pivotRoot pivots into rootfs without a temporary put_old directory: the old
+// root is stacked on top of the new one and lazily detached.
+func pivotRoot(rootfs string) error {
+	oldroot, err := unix.Open("/", unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "open old root")
+	}
+	defer unix.Close(oldroot)
+	newroot, err := unix.Open(rootfs, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "open new root")
+	}
+	defer unix.Close(newroot)
+
+	if err := unix.Fchdir(newroot); err != nil {
+		return errors.Wrap(err, "fchdir new root")
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return errors.Wrap(err, "pivot_root (use --no-pivot on a ramfs root)")
+	}
+	if err := unix.Fchdir(oldroot); err != nil {
+		return errors.Wrap(err, "fchdir old root")
+	}
+	// Don't let the unmount propagate back to the host.
+	if err := unix.Mount("", ".", "", unix.MS_SLAVE|unix.MS_REC, ""); err != nil {
+		return errors.Wrap(err, "make old root rslave")
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return errors.Wrap(err, "detach old root")
+	}
+	return errors.Wrap(unix.Chdir("/"), "chdir")
+}
+
+// setupProcAndSys mounts /proc and a read-only /sys under rootfs. It runs
+// before the root is switched: in a user namespace the kernel only allows
+// mounting proc while the host one is still visible, and sysfs not at all
+// unless the namespace owns the network namespace, in which case the host
+// /sys is bound instead.
+func setupProcAndSys(rootfs string) error {
+	proc := filepath.Join(rootfs, "proc")
+	sys := filepath.Join(rootfs, "sys")
+	for _, dir := range []string{proc, sys} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "create %s", dir)
+		}
+	}
+	if err := unix.Mount("proc", proc, "proc", 0, ""); err != nil {
+		return errors.Wrap(err, "mount proc")
+	}
+	flags := uintptr(unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	err := unix.Mount("sysfs", sys, "sysfs", flags, "")
+	if err != unix.EPERM {
+		return errors.Wrap(err, "mount /sys")
+	}
+	if err := unix.Mount("/sys", sys, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.Wrap(err, "bind /sys")
+	}
+	return remountReadonly(sys, unix.MS_REC)
+}
+
+// mountPointOf returns the mount point of the mount containing path.
+func mountPointOf(path string) (string, error) {
+	best := "/"
+	err := scanMountPoints(func(mp string) {
+		if isUnder(path, mp) && len(mp) > len(best) {
+			best = mp
+		}
+	})
+	return best, err
+}
+
+// mountPointsUnder returns path, which must be a mount point, and the mount
+// points below it, parents first.
+func mountPointsUnder(path string) ([]string, error) {
+	seen := map[string]bool{}
+	var ret []string
+	err := scanMountPoints(func(mp string) {
+		if isUnder(mp, path) && !seen[mp] {
+			seen[mp] = true
+			ret = append(ret, mp)
+		}
+	})
+	sort.Slice(ret, func(i, j int) bool { return len(ret[i]) < len(ret[j]) })
+	return ret, err
+}
+
+// scanMountPoints calls fn with the mount point of every mount of our mount
+// namespace, as seen from our root.
+func scanMountPoints(fn func(string)) error {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		fn(unescapeMountPoint(fields[4]))
+	}
+	return scanner.Err()
+}
+
+// isUnder reports whether path is dir or below it.
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// unescapeMountPoint undoes the octal escapes of mountinfo, such as \040
+// for a space.
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package container
+
+import (
+	"os"
+
+	"github.com/exfly/container/pkg/file"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// applyRootless maps the current user to root in the container. Without
+// privileges the kernel only lets us map our own ids, so the other
+// container users can't be switched to.
+func applyRootless(container *Container) error {
+	if !container.Rootless {
+		return nil
+	}
+	if container.Userns != "" || len(container.UIDMappings) != 0 || len(container.GIDMappings) != 0 {
+		return errors.New("rootless mode only maps the current user to root, --userns, --uidmap and --gidmap are not supported")
+	}
+	container.UIDMappings = []IDMap{{ContainerID: 0, HostID: uint32(os.Geteuid()), Size: 1}}
+	container.GIDMappings = []IDMap{{ContainerID: 0, HostID: uint32(os.Getegid()), Size: 1}}
+	return nil
+}
+
+// mountRootlessRootfs sets up the rootfs from child-mode, inside the user
+// namespace, where the parent couldn't mount it. Overlayfs needs a kernel
+// that allows it in user namespaces (5.11); otherwise the layers are copied
+// into the rootfs instead.
+func (c *ContainerService) mountRootlessRootfs(container *Container, rootfs string) error {
+	if container.Rootfs != "" {
+		return bindRootfs(container, rootfs)
+	}
+	srcLayers, err := c.imageLayers(container)
+	if err != nil {
+		return err
+	}
+	options := c.overlayOptions(container, srcLayers)
+	// userxattr keeps overlay metadata in user.* xattrs, the trusted.* ones
+	// need privileges.
+	err = unix.Mount("none", rootfs, "overlay", 0, options+",userxattr")
+	if err == unix.EINVAL {
+		err = unix.Mount("none", rootfs, "overlay", 0, options)
+	}
+	if err == nil {
+		return nil
+	}
+	log.WithError(err).Warn("overlay not available in user namespace, copying layers")
+	empty, err := file.IsEmptyDir(rootfs)
+	if err != nil || !empty {
+		return err
+	}
+	for i := len(srcLayers) - 1; i >= 0; i-- {
+		if err := file.CopyTree(srcLayers[i], rootfs); err != nil {
+			return errors.Wrapf(err, "copy layer %s", srcLayers[i])
+		}
+	}
+	return nil
+}
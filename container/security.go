@@ -0,0 +1,119 @@
+package container
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/exfly/container/pkg/seccomp"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// applySecurityDefaults fills in the security settings the user didn't set.
+func applySecurityDefaults(container *Container) error {
+	if container.MaskedPaths == nil {
+		container.MaskedPaths = defaultMaskedPaths
+	}
+	if container.ReadonlyPaths == nil {
+		container.ReadonlyPaths = defaultReadonlyPaths
+	}
+	if container.Capabilities == nil {
+		caps, err := tweakCapabilities(defaultCapabilities, container.CapAdd, container.CapDrop)
+		if err != nil {
+			return err
+		}
+		container.Capabilities = newCapabilities(caps)
+	}
+	if err := applySecurityOpts(container); err != nil {
+		return err
+	}
+	// Fail now rather than in child-mode on a profile we can't compile.
+	_, err := seccompFilter(container, container.Capabilities)
+	return err
+}
+
+// applySecurityOpts resolves the --security-opt values: seccomp=unconfined,
+// seccomp=<profile.json> and no-new-privileges[=true|false], which is on
+// unless disabled.
+func applySecurityOpts(container *Container) error {
+	unconfined := false
+	container.NoNewPrivileges = true
+	for _, opt := range container.SecurityOpt {
+		kv := strings.SplitN(opt, "=", 2)
+		if kv[0] == "no-new-privileges" {
+			enabled := true
+			if len(kv) == 2 {
+				var err error
+				if enabled, err = strconv.ParseBool(kv[1]); err != nil {
+					return errors.Errorf("invalid --security-opt %q", opt)
+				}
+			}
+			container.NoNewPrivileges = enabled
+			continue
+		}
+		if len(kv) != 2 {
+			return errors.Errorf("invalid --security-opt %q", opt)
+		}
+		switch kv[0] {
+		case "seccomp":
+			if kv[1] == "unconfined" {
+				unconfined = true
+				container.Seccomp = nil
+				continue
+			}
+			profile, err := seccomp.LoadProfile(kv[1])
+			if err != nil {
+				return err
+			}
+			container.Seccomp = profile
+		default:
+			return errors.Errorf("unsupported --security-opt %q", opt)
+		}
+	}
+	if container.Seccomp == nil && !unconfined {
+		container.Seccomp = seccomp.DefaultProfile()
+	}
+	return nil
+}
+
+// seccompFilter compiles the profile of container for a process with caps,
+// nil if the container is unconfined.
+func seccompFilter(container *Container, caps *Capabilities) ([]unix.SockFilter, error) {
+	if container.Seccomp == nil {
+		return nil, nil
+	}
+	var names []string
+	if caps != nil {
+		names = caps.Bounding
+	}
+	filter, err := seccomp.Compile(container.Seccomp, names)
+	return filter, errors.Wrap(err, "compile seccomp profile")
+}
+
+// restrictThread drops the calling thread, which must be locked, to caps and
+// loads filter, last so that it only has to allow what the process does.
+// Without no_new_privs loading a filter takes CAP_SYS_ADMIN: if caps drop
+// it, the filter goes first instead and must allow dropping them.
+func restrictThread(caps *Capabilities, filter []unix.SockFilter, noNewPrivs bool) error {
+	early := filter != nil && !noNewPrivs && caps != nil && !hasCapability(caps.Effective, "CAP_SYS_ADMIN")
+	if early {
+		if err := seccomp.Install(filter); err != nil {
+			return err
+		}
+	}
+	if caps != nil {
+		if err := applyCapabilities(caps); err != nil {
+			return err
+		}
+	}
+	if noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return errors.Wrap(err, "set no_new_privs")
+		}
+	}
+	if filter != nil && !early {
+		return seccomp.Install(filter)
+	}
+	return nil
+}
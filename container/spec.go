@@ -0,0 +1,409 @@
+package container
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exfly/container/pkg/cgroups"
+	"github.com/exfly/container/pkg/file"
+	"github.com/exfly/container/pkg/seccomp"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// specFileName is the OCI runtime spec a container runs with, written to its
+// home each time it starts, and to bundles.
+const specFileName = "config.json"
+
+// builtinSpecMounts are the mounts child-mode sets up in every container.
+var builtinSpecMounts = []specs.Mount{
+	{Destination: "/proc", Type: "proc", Source: "proc"},
+	{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+	{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", "gid=5"}},
+	{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+	{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+	{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+	{Destination: "/sys/fs/cgroup", Type: "cgroup", Source: "cgroup", Options: []string{"nosuid", "noexec", "nodev", "relatime", "ro"}},
+	{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs"},
+}
+
+// Spec builds the OCI runtime spec of a created container with its root at
+// rootfs. The user is resolved to ids against the passwd and group files of
+// the rootfs, and the seccomp profile to the rules that apply. A rootless
+// rootfs is only mounted in child-mode, which resolves the user itself.
+func (c *ContainerService) Spec(container *Container, rootfs string) (*specs.Spec, error) {
+	process := &specs.Process{
+		Args:            container.Args,
+		Env:             container.Env,
+		Cwd:             container.WorkingDir,
+		NoNewPrivileges: container.NoNewPrivileges,
+	}
+	if process.Cwd == "" {
+		process.Cwd = "/"
+	}
+	if !container.resolvesUserInChild() {
+		if err := resolveSpecUser(process, rootfs, container.User); err != nil {
+			return nil, err
+		}
+	}
+	if caps := container.Capabilities; caps != nil {
+		process.Capabilities = &specs.LinuxCapabilities{
+			Bounding:    caps.Bounding,
+			Effective:   caps.Effective,
+			Permitted:   caps.Permitted,
+			Inheritable: caps.Inheritable,
+			Ambient:     caps.Ambient,
+		}
+	}
+	for _, u := range container.Ulimits {
+		process.Rlimits = append(process.Rlimits, specs.POSIXRlimit{
+			Type: "RLIMIT_" + strings.ToUpper(u.Name),
+			Soft: rlimitValue(u.Soft),
+			Hard: rlimitValue(u.Hard),
+		})
+	}
+
+	spec := &specs.Spec{
+		Version:     specs.Version,
+		Process:     process,
+		Root:        &specs.Root{Path: rootfs, Readonly: container.ReadonlyRootfs},
+		Mounts:      append([]specs.Mount{}, builtinSpecMounts...),
+		Annotations: container.Labels,
+		Hooks:       container.Hooks,
+	}
+	if container.UtsMode == "" {
+		spec.Hostname = *container.ContainerID
+		if container.Hostname != "" {
+			spec.Hostname = container.Hostname
+		}
+	}
+	for _, m := range container.Mounts {
+		spec.Mounts = append(spec.Mounts, c.specMount(m))
+	}
+	linux, err := c.specLinux(container)
+	if err != nil {
+		return nil, err
+	}
+	spec.Linux = linux
+	return spec, nil
+}
+
+// resolvesUserInChild reports whether child-mode resolves the user of
+// container, whose rootfs is only mounted there. A bundle gives the ids.
+func (container *Container) resolvesUserInChild() bool {
+	return container.Rootless && container.Bundle == ""
+}
+
+// resolveSpecUser resolves user inside rootfs for process, which gets its
+// HOME too.
+func resolveSpecUser(process *specs.Process, rootfs, user string) error {
+	u, err := resolveUser(rootfs, user)
+	if err != nil {
+		return err
+	}
+	process.User = specs.User{UID: uint32(u.Uid), GID: uint32(u.Gid)}
+	for _, g := range u.Sgids {
+		process.User.AdditionalGids = append(process.User.AdditionalGids, uint32(g))
+	}
+	process.Env = userEnv(process.Env, u)
+	return nil
+}
+
+func (c *ContainerService) specMount(m Mount) specs.Mount {
+	var ret specs.Mount
+	if m.Type == MountTypeTmpfs {
+		ret = specs.Mount{Destination: m.Destination, Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev"}}
+		if opts := m.tmpfsOptions(); opts != "" {
+			ret.Options = append(ret.Options, strings.Split(opts, ",")...)
+		}
+	} else {
+		// Volumes are bound from where they are on the host.
+		ret = specs.Mount{Destination: m.Destination, Type: "bind", Source: c.mountSource(m), Options: []string{"rbind"}}
+	}
+	if m.ReadOnly {
+		ret.Options = append(ret.Options, "ro")
+	}
+	return ret
+}
+
+func (c *ContainerService) specLinux(container *Container) (*specs.Linux, error) {
+	linux := &specs.Linux{
+		Sysctl:            container.Sysctls,
+		CgroupsPath:       "container/" + *container.ContainerID,
+		RootfsPropagation: container.RootfsPropagation,
+		MaskedPaths:       container.MaskedPaths,
+		ReadonlyPaths:     container.ReadonlyPaths,
+		Resources:         specResources(container),
+	}
+	for _, m := range container.UIDMappings {
+		linux.UIDMappings = append(linux.UIDMappings, specs.LinuxIDMapping{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+	for _, m := range container.GIDMappings {
+		linux.GIDMappings = append(linux.GIDMappings, specs.LinuxIDMapping{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+
+	shared, err := c.sharedNamespaces(container)
+	if err != nil {
+		return nil, err
+	}
+	linux.Namespaces = []specs.LinuxNamespace{{Type: specs.MountNamespace}}
+	for _, ns := range []struct {
+		typ  specs.LinuxNamespaceType
+		name string
+		own  bool
+	}{
+		{specs.PIDNamespace, "pid", container.PidMode == ""},
+		{specs.NetworkNamespace, "net", container.usesNetns()},
+		{specs.IPCNamespace, "ipc", container.IpcMode == ""},
+		{specs.UTSNamespace, "uts", container.UtsMode == ""},
+		{specs.UserNamespace, "user", container.usesUserns()},
+	} {
+		if path, ok := shared[ns.name]; ok {
+			linux.Namespaces = append(linux.Namespaces, specs.LinuxNamespace{Type: ns.typ, Path: path})
+		} else if ns.own {
+			linux.Namespaces = append(linux.Namespaces, specs.LinuxNamespace{Type: ns.typ})
+		}
+	}
+	linux.Namespaces = append(linux.Namespaces, specs.LinuxNamespace{Type: specs.CgroupNamespace})
+	if len(container.TimeOffsets) != 0 {
+		linux.Namespaces = append(linux.Namespaces, specs.LinuxNamespace{Type: specs.TimeNamespace})
+		linux.TimeOffsets = map[string]specs.LinuxTimeOffset{}
+		for clock, d := range container.TimeOffsets {
+			secs, nsecs := splitTimeOffset(d)
+			linux.TimeOffsets[clock] = specs.LinuxTimeOffset{Secs: secs, Nanosecs: uint32(nsecs)}
+		}
+	}
+
+	for _, d := range container.Devices {
+		mode := d.FileMode
+		uid, gid := d.Uid, d.Gid
+		linux.Devices = append(linux.Devices, specs.LinuxDevice{
+			Path:     d.PathInContainer,
+			Type:     string(d.Type),
+			Major:    d.Major,
+			Minor:    d.Minor,
+			FileMode: &mode,
+			UID:      &uid,
+			GID:      &gid,
+		})
+	}
+	if container.Seccomp != nil {
+		var caps []string
+		if container.Capabilities != nil {
+			caps = container.Capabilities.Bounding
+		}
+		profile, err := seccomp.Resolve(container.Seccomp, caps)
+		if err != nil {
+			return nil, err
+		}
+		content, err := json.Marshal(profile)
+		if err != nil {
+			return nil, err
+		}
+		linux.Seccomp = &specs.LinuxSeccomp{}
+		if err := json.Unmarshal(content, linux.Seccomp); err != nil {
+			return nil, errors.Wrap(err, "convert seccomp profile")
+		}
+	}
+	return linux, nil
+}
+
+// specResources are the cgroup limits of container, devices included.
+func specResources(container *Container) *specs.LinuxResources {
+	r := container.resources()
+	ret := &specs.LinuxResources{
+		Devices: []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}},
+	}
+	for _, rule := range deviceRules(container) {
+		ret.Devices = append(ret.Devices, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   string(rule.Type),
+			Major:  deviceNumber(rule.Major),
+			Minor:  deviceNumber(rule.Minor),
+			Access: rule.Access,
+		})
+	}
+	if r.Memory != 0 || r.MemorySwap != 0 {
+		ret.Memory = &specs.LinuxMemory{}
+		if r.Memory != 0 {
+			ret.Memory.Limit = &r.Memory
+		}
+		if r.MemorySwap != 0 {
+			ret.Memory.Swap = &r.MemorySwap
+		}
+	}
+	if r.PidsLimit != 0 {
+		ret.Pids = &specs.LinuxPids{Limit: r.PidsLimit}
+	}
+	if r.CPUQuota != 0 || r.CPUShares != 0 {
+		ret.CPU = &specs.LinuxCPU{}
+		if r.CPUQuota != 0 {
+			ret.CPU.Quota, ret.CPU.Period = &r.CPUQuota, &r.CPUPeriod
+		}
+		if r.CPUShares != 0 {
+			ret.CPU.Shares = &r.CPUShares
+		}
+	}
+	return ret
+}
+
+// deviceNumber is nil, any number, for the wildcard.
+func deviceNumber(n int64) *int64 {
+	if n == cgroups.Wildcard {
+		return nil
+	}
+	return &n
+}
+
+func (c *ContainerService) specPath(container *Container) string {
+	return c.GetContainerHome(container) + "/" + specFileName
+}
+
+// writeSpec writes the spec container is about to run with to its home,
+// where child-mode picks it up, with the hooks of the hooks directory. A
+// bundle container runs with the spec of its bundle.
+func (c *ContainerService) writeSpec(container *Container) (*specs.Spec, error) {
+	var spec *specs.Spec
+	var err error
+	if container.Bundle != "" {
+		spec, err = readSpecFile(filepath.Join(container.Bundle, specFileName))
+	} else {
+		spec, err = c.Spec(container, c.GetContainerFSHome(container)+"/mnt")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.addHooks(spec); err != nil {
+		return nil, err
+	}
+	return spec, writeSpecFile(c.specPath(container), spec)
+}
+
+func writeSpecFile(path string, spec *specs.Spec) error {
+	content, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(ioutil.WriteFile(path, content, 0644), "write spec")
+}
+
+// loadSpec reads the spec writeSpec wrote for container.
+func (c *ContainerService) loadSpec(container *Container) (*specs.Spec, error) {
+	return readSpecFile(c.specPath(container))
+}
+
+func readSpecFile(path string) (*specs.Spec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read spec")
+	}
+	var spec specs.Spec
+	if err := json.Unmarshal(content, &spec); err != nil {
+		return nil, errors.Wrap(err, "parse spec")
+	}
+	if spec.Process == nil || spec.Root == nil || spec.Linux == nil {
+		return nil, errors.New("incomplete spec")
+	}
+	return &spec, nil
+}
+
+// specCapabilities converts the capabilities of a spec, none if it has none.
+func specCapabilities(caps *specs.LinuxCapabilities) *Capabilities {
+	if caps == nil {
+		return &Capabilities{}
+	}
+	return &Capabilities{
+		Bounding:    caps.Bounding,
+		Effective:   caps.Effective,
+		Permitted:   caps.Permitted,
+		Inheritable: caps.Inheritable,
+		Ambient:     caps.Ambient,
+	}
+}
+
+// specUlimits converts the rlimits of a spec, RLIM_INFINITY to -1.
+func specUlimits(rlimits []specs.POSIXRlimit) ([]Ulimit, error) {
+	var ret []Ulimit
+	for _, r := range rlimits {
+		name := strings.ToLower(strings.TrimPrefix(r.Type, "RLIMIT_"))
+		if _, ok := rlimitNumbers[name]; !ok {
+			return nil, errors.Errorf("unknown rlimit %q", r.Type)
+		}
+		ret = append(ret, Ulimit{Name: name, Soft: int64(r.Soft), Hard: int64(r.Hard)})
+	}
+	return ret, nil
+}
+
+// specSeccomp converts the seccomp config of a spec, whose format is the
+// docker profile one without its conditions, nil for none.
+func specSeccomp(s *specs.LinuxSeccomp) (*seccomp.Profile, error) {
+	if s == nil {
+		return nil, nil
+	}
+	content, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return seccomp.ParseProfile(content)
+}
+
+// specSeccompFilter compiles the seccomp config of a spec, nil for none.
+func specSeccompFilter(s *specs.LinuxSeccomp, caps *Capabilities) ([]unix.SockFilter, error) {
+	profile, err := specSeccomp(s)
+	if err != nil || profile == nil {
+		return nil, err
+	}
+	filter, err := seccomp.Compile(profile, caps.Bounding)
+	return filter, errors.Wrap(err, "compile seccomp profile")
+}
+
+// WriteBundle resolves container the way Create does, without creating it,
+// and writes it to dir as an OCI bundle: its image flattened into
+// dir/rootfs and its spec into dir/config.json. Its volumes are created and
+// bound from the host.
+func (c *ContainerService) WriteBundle(container *Container, dir string) error {
+	if container.ContainerID == nil {
+		id := CreateContainerID()
+		container.ContainerID = &id
+	}
+	if err := c.resolve(container); err != nil {
+		return err
+	}
+	if container.Rootless {
+		return errors.New("writing a bundle for a rootless container is not supported")
+	}
+	if err := c.prepareVolumes(container); err != nil {
+		return err
+	}
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(rootfs, 0755); err != nil {
+		return err
+	}
+	if empty, err := file.IsEmptyDir(rootfs); err != nil || !empty {
+		return errors.Errorf("%s is not empty", rootfs)
+	}
+	layers, err := c.imageLayers(container)
+	if err != nil {
+		return err
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		if err := file.CopyTree(layers[i], rootfs); err != nil {
+			return errors.Wrapf(err, "copy layer %s", layers[i])
+		}
+	}
+	if err := copyNameserverConfig(rootfs); err != nil {
+		return errors.Wrap(err, "copy nameserver config")
+	}
+	spec, err := c.Spec(container, rootfs)
+	if err != nil {
+		return err
+	}
+	// Relative, for the bundle to be moved around.
+	spec.Root.Path = "rootfs"
+	return writeSpecFile(filepath.Join(dir, specFileName), spec)
+}
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exfly/container/pkg/seccomp"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpec(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootfs)
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "etc"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/passwd"), []byte(
+		"app:x:1000:1000::/home/app:/bin/sh\n"), 0644))
+
+	id := "abc"
+	container := &Container{
+		ContainerID:  &id,
+		Args:         []string{"sh"},
+		Env:          []string{"PATH=/bin"},
+		User:         "app",
+		Mem:          64 << 20,
+		Cpus:         0.5,
+		Network:      NetworkNone,
+		IpcMode:      NamespaceHost,
+		Ulimits:      []Ulimit{{Name: "nofile", Soft: 1024, Hard: -1}},
+		Mounts:       []Mount{{Type: MountTypeTmpfs, Destination: "/run", TmpfsSize: 1024}},
+		Capabilities: newCapabilities(defaultCapabilities),
+		Seccomp:      seccomp.DefaultProfile(),
+	}
+	spec, err := (&ContainerService{}).Spec(container, rootfs)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", spec.Hostname)
+	assert.Equal(t, specs.User{UID: 1000, GID: 1000}, spec.Process.User)
+	assert.Equal(t, []string{"PATH=/bin", "HOME=/home/app"}, spec.Process.Env)
+	assert.Equal(t, "/", spec.Process.Cwd)
+	assert.Equal(t, specs.Mount{Destination: "/run", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev", "size=1024"}},
+		spec.Mounts[len(spec.Mounts)-1])
+	assert.Equal(t, []specs.LinuxNamespace{
+		{Type: specs.MountNamespace},
+		{Type: specs.PIDNamespace},
+		{Type: specs.NetworkNamespace},
+		{Type: specs.UTSNamespace},
+		{Type: specs.CgroupNamespace},
+	}, spec.Linux.Namespaces)
+	assert.Equal(t, int64(50000), *spec.Linux.Resources.CPU.Quota)
+	require.NotNil(t, spec.Linux.Seccomp)
+
+	// What a bundle created from the spec runs with.
+	back, err := FromSpec(spec, rootfs)
+	require.NoError(t, err)
+	assert.Equal(t, "1000:1000", back.User)
+	assert.Equal(t, container.Ulimits, back.Ulimits)
+	assert.Equal(t, container.Mounts, back.Mounts)
+	assert.Equal(t, container.Mem, back.Mem)
+	assert.Equal(t, container.Cpus, back.Cpus)
+	assert.Equal(t, NamespaceHost, back.IpcMode)
+	assert.Equal(t, container.Capabilities, back.Capabilities)
+	_, err = seccompFilter(back, back.Capabilities)
+	assert.NoError(t, err)
+
+	// Child-mode resolves the user once it has mounted a rootless rootfs.
+	container.Rootless = true
+	spec, err = (&ContainerService{}).Spec(container, filepath.Join(rootfs, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, specs.User{}, spec.Process.User)
+	require.NoError(t, resolveSpecUser(spec.Process, rootfs, container.User))
+	assert.Equal(t, specs.User{UID: 1000, GID: 1000}, spec.Process.User)
+	assert.Equal(t, []string{"PATH=/bin", "HOME=/home/app"}, spec.Process.Env)
+}
@@ -0,0 +1,37 @@
+package container
+
+import "time"
+
+const (
+	StatusCreated = "created"
+	StatusRunning = "running"
+	StatusExited  = "exited"
+	// StatusPaused is only reported: a paused container is still running,
+	// with State.Paused set.
+	StatusPaused = "paused"
+)
+
+// State is the runtime state of a container, persisted in runtime.json
+// next to the container config. Paused is set while the processes of a
+// running container are frozen.
+type State struct {
+	Status     string    `json:"status,omitempty"`
+	Pid        int       `json:"pid,omitempty"`
+	Paused     bool      `json:"paused,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Health     *Health   `json:"health,omitempty"`
+}
+
+func (s *State) IsRunning() bool {
+	return s != nil && s.Status == StatusRunning
+}
+
+// DisplayStatus is the status to show, paused for a paused container.
+func (s *State) DisplayStatus() string {
+	if s.IsRunning() && s.Paused {
+		return StatusPaused
+	}
+	return s.Status
+}
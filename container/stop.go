@@ -0,0 +1,133 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultStopTimeout is how long Stop waits before killing the container.
+const DefaultStopTimeout = 10 * time.Second
+
+// forwardedSignals are passed on by child-mode, pid 1 of the container, to
+// the container process.
+var forwardedSignals = []os.Signal{
+	unix.SIGTERM, unix.SIGINT, unix.SIGHUP, unix.SIGQUIT, unix.SIGUSR1, unix.SIGUSR2, unix.SIGWINCH,
+}
+
+// ParseSignal parses a signal by name, with or without SIG, or number.
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 || n > 64 {
+			return 0, errors.Errorf("invalid signal %q", s)
+		}
+		return syscall.Signal(n), nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, errors.Errorf("invalid signal %q", s)
+	}
+	return sig, nil
+}
+
+// forwardSignals passes the signals child-mode gets on to process, the
+// stop signal of container too, until the returned function is called.
+func forwardSignals(process *os.Process, container *Container) func() {
+	signals := forwardedSignals
+	if container.StopSignal != "" {
+		if sig, err := ParseSignal(container.StopSignal); err == nil {
+			signals = append(append([]os.Signal{}, signals...), sig)
+		}
+	}
+	ch := make(chan os.Signal, 8)
+	signal.Notify(ch, signals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Stop sends the stop signal of a running container, SIGTERM by default,
+// and kills it if it is still running after timeout. A paused container is
+// thawed to handle it.
+func (c *ContainerService) Stop(containerID string, timeout time.Duration) error {
+	container, err := c.unmarshalContainer(containerID)
+	if err != nil {
+		return err
+	}
+	if !container.State.IsRunning() {
+		return nil
+	}
+	sig := unix.SIGTERM
+	if container.StopSignal != "" {
+		if sig, err = ParseSignal(container.StopSignal); err != nil {
+			return err
+		}
+	}
+	pid := container.State.Pid
+	if err := unix.Kill(pid, sig); err != nil {
+		if err == unix.ESRCH {
+			return nil
+		}
+		return errors.Wrapf(err, "signal container %s", containerID)
+	}
+	c.thawSignaled(container)
+	if waitForExit(pid, timeout) {
+		return nil
+	}
+	log.WithField("container", containerID).Warn("container did not stop in time, killing it")
+	if err := unix.Kill(pid, unix.SIGKILL); err != nil && err != unix.ESRCH {
+		return errors.Wrapf(err, "kill container %s", containerID)
+	}
+	if !waitForExit(pid, timeout) {
+		return errors.Errorf("container %s did not exit", containerID)
+	}
+	return nil
+}
+
+// waitForExit polls until pid has exited, zombies count as exited.
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !processAlive(pid) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func processAlive(pid int) bool {
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the command name, which is in parentheses.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
@@ -0,0 +1,25 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for spec, want := range map[string]syscall.Signal{
+		"SIGTERM": syscall.SIGTERM,
+		"term":    syscall.SIGTERM,
+		"QUIT":    syscall.SIGQUIT,
+		"9":       syscall.SIGKILL,
+	} {
+		sig, err := ParseSignal(spec)
+		assert.NoError(t, err, spec)
+		assert.Equal(t, want, sig, spec)
+	}
+	for _, spec := range []string{"SIGNOPE", "0", "100"} {
+		_, err := ParseSignal(spec)
+		assert.Error(t, err, spec)
+	}
+}
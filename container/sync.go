@@ -0,0 +1,46 @@
+package container
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// syncFd is the fd on which child-mode inherits its end of the sync pipe.
+// The parent writes a single byte on it once the container is set up from
+// the outside (cgroups and so on); child-mode waits for it before doing
+// anything.
+const syncFd = 3
+
+// childLogFd is the fd on which child-mode inherits the stderr of its parent,
+// for its own logs: its stderr is the one of the container.
+const childLogFd = 4
+
+func newSyncPipe() (childEnd, parentEnd *os.File, err error) {
+	return os.Pipe()
+}
+
+// signalChild releases child-mode.
+func signalChild(parentEnd *os.File) error {
+	_, err := parentEnd.Write([]byte{0})
+	return errors.Wrap(err, "signal child")
+}
+
+// waitForParent blocks until the parent has set the container up. EOF means
+// the parent gave up.
+func waitForParent() error {
+	f := os.NewFile(syncFd, "sync")
+	defer f.Close()
+	buf := make([]byte, 1)
+	if n, err := f.Read(buf); n != 1 {
+		return errors.Wrap(err, "wait for parent")
+	}
+	return nil
+}
+
+// ChildModeLog returns where child-mode logs to.
+func ChildModeLog() *os.File {
+	syscall.CloseOnExec(childLogFd)
+	return os.NewFile(childLogFd, "log")
+}
@@ -0,0 +1,75 @@
+package container
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ipcSysctls are the sysctls of the IPC namespace, besides fs.mqueue.*.
+var ipcSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+// ParseSysctl parses a --sysctl value, key=value.
+func ParseSysctl(spec string) (string, string, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", errors.Errorf("invalid sysctl %q, want key=value", spec)
+	}
+	return kv[0], kv[1], nil
+}
+
+// validateSysctls only lets through sysctls of the namespaces the container
+// has of its own, the others would change the host.
+func validateSysctls(container *Container) error {
+	for key := range container.Sysctls {
+		switch {
+		case ipcSysctls[key] || strings.HasPrefix(key, "fs.mqueue."):
+			if container.IpcMode != "" {
+				return errors.Errorf("sysctl %s is not allowed with a shared IPC namespace", key)
+			}
+		case key == "kernel.domainname":
+			if container.UtsMode != "" {
+				return errors.Errorf("sysctl %s is not allowed with a shared UTS namespace", key)
+			}
+		case strings.HasPrefix(key, "net."):
+			if !container.usesNetns() {
+				return errors.Errorf("sysctl %s is not allowed with the host network", key)
+			}
+		default:
+			return errors.Errorf("sysctl %s is not namespaced, not allowed", key)
+		}
+		if strings.Contains(key, "..") || strings.Contains(key, "/") {
+			return errors.Errorf("invalid sysctl %s", key)
+		}
+	}
+	return nil
+}
+
+// applySysctls writes sysctls to /proc/sys, which must be the proc of the
+// container.
+func applySysctls(sysctls map[string]string) error {
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := filepath.Join("/proc/sys", strings.Replace(key, ".", "/", -1))
+		if err := ioutil.WriteFile(path, []byte(sysctls[key]), 0644); err != nil {
+			return errors.Wrapf(err, "set sysctl %s", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package container
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var rlimitNumbers = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+// Ulimit is a resource limit of the container process. -1 is unlimited.
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// ParseUlimit parses a --ulimit value, name=soft[:hard]. Without a hard
+// limit both are set to soft.
+func ParseUlimit(spec string) (Ulimit, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 {
+		return Ulimit{}, errors.Errorf("invalid ulimit %q, want name=soft[:hard]", spec)
+	}
+	if _, ok := rlimitNumbers[kv[0]]; !ok {
+		return Ulimit{}, errors.Errorf("invalid ulimit %q: unknown resource %s", spec, kv[0])
+	}
+	limits := strings.SplitN(kv[1], ":", 2)
+	ret := Ulimit{Name: kv[0]}
+	var err error
+	if ret.Soft, err = parseRlimit(limits[0]); err != nil {
+		return Ulimit{}, errors.Errorf("invalid ulimit %q", spec)
+	}
+	ret.Hard = ret.Soft
+	if len(limits) == 2 {
+		if ret.Hard, err = parseRlimit(limits[1]); err != nil {
+			return Ulimit{}, errors.Errorf("invalid ulimit %q", spec)
+		}
+	}
+	if ret.Hard != -1 && (ret.Soft == -1 || ret.Soft > ret.Hard) {
+		return Ulimit{}, errors.Errorf("invalid ulimit %q: soft limit exceeds hard limit", spec)
+	}
+	return ret, nil
+}
+
+func parseRlimit(s string) (int64, error) {
+	if s == "unlimited" || s == "-1" {
+		return -1, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func rlimitValue(v int64) uint64 {
+	if v == -1 {
+		return unix.RLIM_INFINITY
+	}
+	return uint64(v)
+}
+
+// applyUlimits sets the limits of the calling process, inherited by the
+// processes it starts. Later ulimits for a resource win.
+func applyUlimits(ulimits []Ulimit) error {
+	names := make(map[string]Ulimit, len(ulimits))
+	for _, u := range ulimits {
+		names[u.Name] = u
+	}
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		u := names[name]
+		resource, ok := rlimitNumbers[name]
+		if !ok {
+			return errors.Errorf("unknown ulimit %s", name)
+		}
+		// syscall.Setrlimit, so that the Go runtime doesn't restore its
+		// own nofile limit in the processes it starts.
+		rlim := &syscall.Rlimit{Cur: rlimitValue(u.Soft), Max: rlimitValue(u.Hard)}
+		if err := syscall.Setrlimit(resource, rlim); err != nil {
+			return errors.Wrapf(err, "set ulimit %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUlimit(t *testing.T) {
+	u, err := ParseUlimit("nofile=1024:2048")
+	require.NoError(t, err)
+	assert.Equal(t, Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}, u)
+
+	u, err = ParseUlimit("core=unlimited")
+	require.NoError(t, err)
+	assert.Equal(t, Ulimit{Name: "core", Soft: -1, Hard: -1}, u)
+
+	u, err = ParseUlimit("nproc=10:-1")
+	require.NoError(t, err)
+	assert.Equal(t, Ulimit{Name: "nproc", Soft: 10, Hard: -1}, u)
+
+	for _, spec := range []string{"nofile", "bogus=1", "nofile=x", "nofile=2048:1024", "nofile=unlimited:10"} {
+		_, err := ParseUlimit(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestValidateSysctls(t *testing.T) {
+	c := &Container{Network: NetworkNone, Sysctls: map[string]string{
+		"net.ipv4.ip_forward":  "1",
+		"kernel.shmmax":        "1",
+		"fs.mqueue.queues_max": "1",
+	}}
+	assert.NoError(t, validateSysctls(c))
+
+	c.Network = NetworkHost
+	assert.Error(t, validateSysctls(c))
+	assert.Error(t, validateSysctls(&Container{Sysctls: map[string]string{"vm.swappiness": "1"}}))
+}
@@ -0,0 +1,212 @@
+package container
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	pkgenv "github.com/exfly/container/pkg/env"
+	"github.com/exfly/container/pkg/file"
+
+	"github.com/pkg/errors"
+)
+
+// execUser is the identity a container process runs with.
+type execUser struct {
+	Uid   int
+	Gid   int
+	Sgids []int
+	Home  string
+}
+
+func (u *execUser) credential() *syscall.Credential {
+	groups := make([]uint32, 0, len(u.Sgids))
+	for _, g := range u.Sgids {
+		groups = append(groups, uint32(g))
+	}
+	return &syscall.Credential{Uid: uint32(u.Uid), Gid: uint32(u.Gid), Groups: groups}
+}
+
+// userEnv sets HOME for u unless env already has it.
+func userEnv(env []string, u *execUser) []string {
+	if _, ok := pkgenv.Lookup(env, "HOME"); ok {
+		return env
+	}
+	return append(append([]string{}, env...), "HOME="+u.Home)
+}
+
+type passwdEntry struct {
+	Name string
+	Uid  int
+	Gid  int
+	Home string
+}
+
+type groupEntry struct {
+	Name    string
+	Gid     int
+	Members []string
+}
+
+// resolveUser resolves user ("", "name", "uid", "name:group", "uid:gid" and
+// so on) against /etc/passwd and /etc/group inside rootfs, whose symlinks
+// are followed as if it were the root. Numeric ids that have no entry are
+// used as is, names must exist.
+func resolveUser(rootfs, user string) (*execUser, error) {
+	passwdPath, err := file.SecureJoin(rootfs, "/etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	passwd, err := readPasswd(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+	groupPath, err := file.SecureJoin(rootfs, "/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := readGroup(groupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	userArg, groupArg := user, ""
+	if i := strings.Index(user, ":"); i >= 0 {
+		userArg, groupArg = user[:i], user[i+1:]
+	}
+	if userArg == "" {
+		userArg = "0"
+	}
+
+	ret := &execUser{Home: "/"}
+	var pw *passwdEntry
+	if uid, err := strconv.Atoi(userArg); err == nil {
+		if uid < 0 {
+			return nil, errors.Errorf("invalid uid %d", uid)
+		}
+		ret.Uid = uid
+		for i := range passwd {
+			if passwd[i].Uid == uid {
+				pw = &passwd[i]
+				break
+			}
+		}
+	} else {
+		for i := range passwd {
+			if passwd[i].Name == userArg {
+				pw = &passwd[i]
+				break
+			}
+		}
+		if pw == nil {
+			return nil, errors.Errorf("unable to find user %s: no matching entries in passwd file", userArg)
+		}
+		ret.Uid = pw.Uid
+	}
+	if pw != nil {
+		ret.Gid = pw.Gid
+		if pw.Home != "" {
+			ret.Home = pw.Home
+		}
+		for _, g := range groups {
+			if g.Gid == pw.Gid {
+				continue
+			}
+			for _, m := range g.Members {
+				if m == pw.Name {
+					ret.Sgids = append(ret.Sgids, g.Gid)
+					break
+				}
+			}
+		}
+	}
+
+	if groupArg != "" {
+		if gid, err := strconv.Atoi(groupArg); err == nil {
+			if gid < 0 {
+				return nil, errors.Errorf("invalid gid %d", gid)
+			}
+			ret.Gid = gid
+		} else {
+			found := false
+			for _, g := range groups {
+				if g.Name == groupArg {
+					ret.Gid = g.Gid
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("unable to find group %s: no matching entries in group file", groupArg)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func readPasswd(path string) ([]passwdEntry, error) {
+	var ret []passwdEntry
+	err := readColonFile(path, func(fields []string) {
+		if len(fields) < 6 {
+			return
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return
+		}
+		ret = append(ret, passwdEntry{Name: fields[0], Uid: uid, Gid: gid, Home: fields[5]})
+	})
+	return ret, err
+}
+
+func readGroup(path string) ([]groupEntry, error) {
+	var ret []groupEntry
+	err := readColonFile(path, func(fields []string) {
+		if len(fields) < 3 {
+			return
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return
+		}
+		g := groupEntry{Name: fields[0], Gid: gid}
+		if len(fields) > 3 && fields[3] != "" {
+			g.Members = strings.Split(fields[3], ",")
+		}
+		ret = append(ret, g)
+	})
+	return ret, err
+}
+
+// readColonFile calls fn with the fields of every entry of an
+// /etc/passwd-like file. A missing file has no entries.
+func readColonFile(path string, fn func([]string)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return parseColonFile(f, fn)
+}
+
+func parseColonFile(r io.Reader, fn func([]string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(strings.Split(line, ":"))
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,49 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveUser(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(rootfs)
+	assert.NoError(t, os.MkdirAll(filepath.Join(rootfs, "etc"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/passwd"), []byte(
+		"root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/group"), []byte(
+		"root:x:0:\napp:x:1000:\nwheel:x:10:root,app\naudio:x:29:app\n"), 0644))
+
+	u, err := resolveUser(rootfs, "")
+	assert.NoError(t, err)
+	assert.Equal(t, &execUser{Uid: 0, Gid: 0, Sgids: []int{10}, Home: "/root"}, u)
+
+	u, err = resolveUser(rootfs, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, &execUser{Uid: 1000, Gid: 1000, Sgids: []int{10, 29}, Home: "/home/app"}, u)
+
+	u, err = resolveUser(rootfs, "app:wheel")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, u.Gid)
+
+	u, err = resolveUser(rootfs, "4242:4343")
+	assert.NoError(t, err)
+	assert.Equal(t, &execUser{Uid: 4242, Gid: 4343, Home: "/"}, u)
+
+	_, err = resolveUser(rootfs, "nobody")
+	assert.Error(t, err)
+	_, err = resolveUser(rootfs, "app:nogroup")
+	assert.Error(t, err)
+
+	// Symlinks resolve inside the rootfs, not on the host.
+	assert.NoError(t, os.Rename(filepath.Join(rootfs, "etc/passwd"), filepath.Join(rootfs, "etc/passwd.real")))
+	assert.NoError(t, os.Symlink("/etc/passwd.real", filepath.Join(rootfs, "etc/passwd")))
+	u, err = resolveUser(rootfs, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, u.Uid)
+}
@@ -0,0 +1,272 @@
+package container
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/exfly/container/pkg/file"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	subuidPath = "/etc/subuid"
+	subgidPath = "/etc/subgid"
+)
+
+// IDMap maps Size ids starting at ContainerID in the container to ids
+// starting at HostID on the host.
+type IDMap struct {
+	ContainerID uint32 `json:"container_id"`
+	HostID      uint32 `json:"host_id"`
+	Size        uint32 `json:"size"`
+}
+
+// ParseIDMap parses a --uidmap or --gidmap value, container:host:size.
+func ParseIDMap(spec string) (IDMap, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return IDMap{}, errors.Errorf("invalid id mapping %q, want container:host:size", spec)
+	}
+	var ids [3]uint32
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return IDMap{}, errors.Errorf("invalid id mapping %q", spec)
+		}
+		ids[i] = uint32(n)
+	}
+	if ids[2] == 0 {
+		return IDMap{}, errors.Errorf("invalid id mapping %q: empty range", spec)
+	}
+	return IDMap{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}, nil
+}
+
+// hostID translates a container id, ok is false if it isn't mapped.
+func hostID(maps []IDMap, id uint32) (uint32, bool) {
+	for _, m := range maps {
+		if id >= m.ContainerID && id-m.ContainerID < m.Size {
+			return m.HostID + id - m.ContainerID, true
+		}
+	}
+	return 0, false
+}
+
+func sysProcIDMaps(maps []IDMap) []syscall.SysProcIDMap {
+	ret := make([]syscall.SysProcIDMap, 0, len(maps))
+	for _, m := range maps {
+		ret = append(ret, syscall.SysProcIDMap{ContainerID: int(m.ContainerID), HostID: int(m.HostID), Size: int(m.Size)})
+	}
+	return ret
+}
+
+// usesUserns reports whether container runs in a user namespace of its own.
+func (container *Container) usesUserns() bool {
+	return len(container.UIDMappings) != 0
+}
+
+// applyUserns resolves --userns into id mappings. "auto" and "auto:<user>"
+// take the subordinate ranges of the current or the given user from
+// /etc/subuid and /etc/subgid. A --uidmap without --gidmap is used for both.
+func applyUserns(container *Container) error {
+	switch {
+	case container.Userns == "" || container.Userns == "host":
+	case container.Userns == "auto" || strings.HasPrefix(container.Userns, "auto:"):
+		if container.usesUserns() {
+			return errors.New("--userns=auto conflicts with --uidmap")
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(container.Userns, "auto"), ":")
+		uid := ""
+		if name == "" {
+			u, err := osuser.Current()
+			if err != nil {
+				return errors.Wrap(err, "look up current user")
+			}
+			name, uid = u.Username, u.Uid
+		}
+		var err error
+		if container.UIDMappings, err = subIDMappings(subuidPath, name, uid); err != nil {
+			return err
+		}
+		if container.GIDMappings, err = subIDMappings(subgidPath, name, uid); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("invalid --userns %q", container.Userns)
+	}
+	if len(container.GIDMappings) == 0 {
+		container.GIDMappings = container.UIDMappings
+	}
+	if !container.usesUserns() {
+		return nil
+	}
+	// child-mode switches to root in the namespace before anything else.
+	if _, ok := hostID(container.UIDMappings, 0); !ok {
+		return errors.New("user namespace does not map the container root uid")
+	}
+	if _, ok := hostID(container.GIDMappings, 0); !ok {
+		return errors.New("user namespace does not map the container root gid")
+	}
+	return nil
+}
+
+// subIDMappings maps the subordinate ranges of user (by name or uid) in path
+// one after the other, starting at container id 0.
+func subIDMappings(path, name, uid string) ([]IDMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", path)
+	}
+	defer f.Close()
+
+	var ret []IDMap
+	next := uint32(0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 || (fields[0] != name && (uid == "" || fields[0] != uid)) {
+			continue
+		}
+		m, err := ParseIDMap(fmt.Sprintf("%d:%s:%s", next, fields[1], fields[2]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", path)
+		}
+		ret = append(ret, m)
+		next += m.Size
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, errors.Errorf("no subordinate ids for %s in %s", name, path)
+	}
+	return ret, nil
+}
+
+// idMappingKey names a set of mappings, for caching remapped layers.
+func idMappingKey(uidMaps, gidMaps []IDMap) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v/%v", uidMaps, gidMaps)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// remappedLayer returns a copy of the layer at layerFS owned by the host ids
+// container ids map to, creating it the first time. Overlayfs shows lower
+// layers with their host ownership, which the container root couldn't
+// otherwise write to. Containers started at the same time wait for the one
+// creating the copy.
+func remappedLayer(layerFS string, container *Container) (string, error) {
+	target := layerFS + "-userns-" + idMappingKey(container.UIDMappings, container.GIDMappings)
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+	lock, err := lockFile(target + ".lock")
+	if err != nil {
+		return "", err
+	}
+	defer lock.Close()
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+
+	log.WithField("layer", layerFS).Info("remap layer ownership")
+	tmp, err := ioutil.TempDir(filepath.Dir(target), filepath.Base(target)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	if err := file.CopyTree(layerFS, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", errors.Wrapf(err, "copy layer %s", layerFS)
+	}
+	if err := shiftOwnership(tmp, container.UIDMappings, container.GIDMappings); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.RemoveAll(tmp)
+		return "", errors.Wrap(err, "remap layer")
+	}
+	return target, nil
+}
+
+// lockFile takes an exclusive lock on path, creating it. Closing the file
+// releases the lock.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "lock %s", path)
+	}
+	return f, nil
+}
+
+// shiftOwnership chowns everything under dir from container to host ids.
+func shiftOwnership(dir string, uidMaps, gidMaps []IDMap) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		uid, ok := hostID(uidMaps, st.Uid)
+		if !ok {
+			return errors.Errorf("uid %d of %s is not mapped in the user namespace", st.Uid, path)
+		}
+		gid, ok := hostID(gidMaps, st.Gid)
+		if !ok {
+			return errors.Errorf("gid %d of %s is not mapped in the user namespace", st.Gid, path)
+		}
+		if err := os.Lchown(path, int(uid), int(gid)); err != nil {
+			return err
+		}
+		// chown clears setuid and setgid bits.
+		if mode := info.Mode(); mode&os.ModeSymlink == 0 && mode&(os.ModeSetuid|os.ModeSetgid) != 0 {
+			return os.Chmod(path, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+		}
+		return nil
+	})
+}
+
+// chownToRoot hands path to the host ids of the container root.
+func chownToRoot(path string, container *Container) error {
+	uid, _ := hostID(container.UIDMappings, 0)
+	gid, _ := hostID(container.GIDMappings, 0)
+	return errors.Wrapf(os.Lchown(path, int(uid), int(gid)), "chown %s", path)
+}
+
+// hostCredential translates cred from container to host ids, for processes
+// that start outside the user namespace.
+func hostCredential(cred *syscall.Credential, uidMaps, gidMaps []IDMap) (*syscall.Credential, error) {
+	ret := &syscall.Credential{}
+	var ok bool
+	if ret.Uid, ok = hostID(uidMaps, cred.Uid); !ok {
+		return nil, errors.Errorf("uid %d is not mapped in the user namespace", cred.Uid)
+	}
+	if ret.Gid, ok = hostID(gidMaps, cred.Gid); !ok {
+		return nil, errors.Errorf("gid %d is not mapped in the user namespace", cred.Gid)
+	}
+	for _, g := range cred.Groups {
+		if h, ok := hostID(gidMaps, g); ok {
+			ret.Groups = append(ret.Groups, h)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,87 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIDMap(t *testing.T) {
+	m, err := ParseIDMap("0:100000:65536")
+	require.NoError(t, err)
+	assert.Equal(t, IDMap{ContainerID: 0, HostID: 100000, Size: 65536}, m)
+
+	for _, spec := range []string{"0:100000", "0:x:1", "0:1:0"} {
+		_, err := ParseIDMap(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSubIDMappings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subid")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subuid")
+	require.NoError(t, ioutil.WriteFile(path, []byte("alice:100000:1000\nbob:200000:65536\n1000:300000:10\n"), 0644))
+
+	maps, err := subIDMappings(path, "alice", "1000")
+	require.NoError(t, err)
+	assert.Equal(t, []IDMap{{0, 100000, 1000}, {1000, 300000, 10}}, maps)
+
+	id, ok := hostID(maps, 1005)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(300005), id)
+	_, ok = hostID(maps, 1010)
+	assert.False(t, ok)
+
+	_, err = subIDMappings(path, "carol", "")
+	assert.Error(t, err)
+}
+
+func TestRemappedLayer(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("chown needs root")
+	}
+	dir, err := ioutil.TempDir("", "layers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	layer := filepath.Join(dir, "layer")
+	require.NoError(t, os.MkdirAll(filepath.Join(layer, "etc"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(layer, "etc/hostname"), []byte("x"), 0644))
+
+	c := &Container{
+		UIDMappings: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		GIDMappings: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+	}
+	var wg sync.WaitGroup
+	targets := make([]string, 4)
+	errs := make([]error, len(targets))
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			targets[i], errs[i] = remappedLayer(layer, c)
+		}(i)
+	}
+	wg.Wait()
+	for i := range targets {
+		require.NoError(t, errs[i])
+		assert.Equal(t, targets[0], targets[i])
+	}
+	info, err := os.Stat(filepath.Join(targets[0], "etc/hostname"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(100000), info.Sys().(*syscall.Stat_t).Uid)
+	info, err = os.Stat(targets[0])
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "layer, its copy and the lock")
+}
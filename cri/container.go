@@ -0,0 +1,390 @@
+package cri
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exfly/container/container"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// CreateContainer creates a container in a sandbox from a local image. It
+// joins the namespaces of the sandbox, or the host ones the sandbox shares.
+func (s *Server) CreateContainer(ctx context.Context, req *runtimeapi.CreateContainerRequest) (*runtimeapi.CreateContainerResponse, error) {
+	p, err := s.lookupSandbox(req.PodSandboxId)
+	if err != nil {
+		return nil, err
+	}
+	cfg := req.GetConfig()
+	if cfg.GetMetadata() == nil {
+		return nil, invalidArgument("container config must include metadata")
+	}
+	if cfg.GetImage().GetImage() == "" {
+		return nil, invalidArgument("container config must include an image")
+	}
+	if cfg.Tty {
+		return nil, invalidArgument("tty is not supported")
+	}
+	if cfg.Stdin {
+		log.WithField("container", cfg.Metadata.Name).Warn("stdin is not supported, ignoring it")
+	}
+	img, err := s.resolveImage(cfg.Image.Image)
+	if err != nil {
+		return nil, err
+	}
+	c := container.NewContainer(img, nil)
+	c.Entrypoint = cfg.Command
+	c.Cmd = cfg.Args
+	c.WorkingDir = cfg.WorkingDir
+	for _, kv := range cfg.Envs {
+		c.Env = append(c.Env, kv.Key+"="+kv.Value)
+	}
+	for _, m := range cfg.Mounts {
+		if !path.IsAbs(m.HostPath) {
+			return nil, invalidArgument("mount host path %q must be absolute", m.HostPath)
+		}
+		spec := m.HostPath + ":" + m.ContainerPath
+		if m.Readonly {
+			spec += ":ro"
+		}
+		mount, err := container.ParseVolumeSpec(spec)
+		if err != nil {
+			return nil, invalidArgument("%v", err)
+		}
+		c.Mounts = append(c.Mounts, mount)
+	}
+	for _, d := range cfg.Devices {
+		device, err := container.ParseDeviceSpec(d.HostPath + ":" + d.ContainerPath + ":" + d.Permissions)
+		if err != nil {
+			return nil, invalidArgument("%v", err)
+		}
+		c.Devices = append(c.Devices, device)
+	}
+	if err := applySecurityContext(c, cfg.GetLinux().GetSecurityContext()); err != nil {
+		return nil, err
+	}
+	md := cfg.Metadata
+	c.Labels = encodeLabels(cfg.Labels, cfg.Annotations, map[string]string{
+		labelContainerName: md.Name,
+		labelAttempt:       strconv.FormatUint(uint64(md.Attempt), 10),
+		labelLogPath:       cfg.LogPath,
+	})
+	if err := s.podSrv.Join(c, p.Name); err != nil {
+		return nil, err
+	}
+	if p.Labels[labelHostNetwork] == "true" {
+		c.Network, c.UtsMode = "host", "host"
+	}
+	if p.Labels[labelHostIPC] == "true" {
+		c.IpcMode = "host"
+	}
+	if p.Labels[labelHostPID] == "true" {
+		c.PidMode = "host"
+	}
+	if err := s.containerSrv.Create(c); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.CreateContainerResponse{ContainerId: *c.ContainerID}, nil
+}
+
+// applySecurityContext maps the CRI security context onto c. An empty
+// seccomp profile is the runtime default.
+func applySecurityContext(c *container.Container, sc *runtimeapi.LinuxContainerSecurityContext) error {
+	if sc == nil {
+		return nil
+	}
+	if sc.Privileged {
+		return invalidArgument("privileged containers are not supported")
+	}
+	c.CapAdd = sc.GetCapabilities().GetAddCapabilities()
+	c.CapDrop = sc.GetCapabilities().GetDropCapabilities()
+	switch {
+	case sc.RunAsUser != nil:
+		c.User = strconv.FormatInt(sc.RunAsUser.Value, 10)
+	case sc.RunAsUsername != "":
+		c.User = sc.RunAsUsername
+	}
+	if sc.RunAsGroup != nil {
+		if c.User == "" {
+			return invalidArgument("run_as_group requires run_as_user or run_as_username")
+		}
+		c.User += ":" + strconv.FormatInt(sc.RunAsGroup.Value, 10)
+	}
+	if len(sc.SupplementalGroups) != 0 {
+		log.Warn("supplemental groups are not supported, ignoring them")
+	}
+	c.ReadonlyRootfs = sc.ReadonlyRootfs
+	c.MaskedPaths = sc.MaskedPaths
+	c.ReadonlyPaths = sc.ReadonlyPaths
+	switch profile := sc.SeccompProfilePath; {
+	case profile == "unconfined":
+		c.SecurityOpt = append(c.SecurityOpt, "seccomp=unconfined")
+	case profile == "", profile == "runtime/default", profile == "docker/default":
+	case strings.HasPrefix(profile, "localhost/"):
+		c.SecurityOpt = append(c.SecurityOpt, "seccomp="+strings.TrimPrefix(profile, "localhost/"))
+	default:
+		return invalidArgument("unsupported seccomp profile %q", profile)
+	}
+	// Kubernetes allows privilege escalation unless told otherwise.
+	c.SecurityOpt = append(c.SecurityOpt, "no-new-privileges="+strconv.FormatBool(sc.NoNewPrivs))
+	return nil
+}
+
+// StartContainer starts a container and copies its output to its CRI log
+// file.
+func (s *Server) StartContainer(ctx context.Context, req *runtimeapi.StartContainerRequest) (*runtimeapi.StartContainerResponse, error) {
+	c, err := s.lookupContainer(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.containerSrv.Start(s.ctx, *c.ContainerID); err != nil {
+		return nil, err
+	}
+	if logPath := s.logPath(c); logPath != "" {
+		if err := s.copyLogs(*c.ContainerID, logPath); err != nil {
+			log.WithError(err).WithField("container", *c.ContainerID).Warn("open container log")
+		}
+	}
+	return &runtimeapi.StartContainerResponse{}, nil
+}
+
+// StopContainer stops a container and waits for it to have exited.
+// Stopping a container that isn't running succeeds.
+func (s *Server) StopContainer(ctx context.Context, req *runtimeapi.StopContainerRequest) (*runtimeapi.StopContainerResponse, error) {
+	c, err := s.lookupContainer(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(req.Timeout) * time.Second
+	if err := s.containerSrv.Stop(*c.ContainerID, timeout); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, container.DefaultStopTimeout)
+	defer cancel()
+	if _, err := s.containerSrv.Wait(ctx, *c.ContainerID); err != nil && !container.IsContainerNotExists(err) {
+		return nil, err
+	}
+	return &runtimeapi.StopContainerResponse{}, nil
+}
+
+// RemoveContainer removes a container, running or not. Removing a
+// container that is gone succeeds.
+func (s *Server) RemoveContainer(ctx context.Context, req *runtimeapi.RemoveContainerRequest) (*runtimeapi.RemoveContainerResponse, error) {
+	c, err := s.lookupContainer(req.ContainerId)
+	if container.IsContainerNotExists(err) {
+		return &runtimeapi.RemoveContainerResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.removeContainer(*c.ContainerID); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.RemoveContainerResponse{}, nil
+}
+
+func (s *Server) removeContainer(id string) error {
+	err := s.containerSrv.Remove(s.ctx, id, true)
+	if err != nil && !container.IsContainerNotExists(err) {
+		return err
+	}
+	s.closeLog(id)
+	return nil
+}
+
+func (s *Server) ListContainers(ctx context.Context, req *runtimeapi.ListContainersRequest) (*runtimeapi.ListContainersResponse, error) {
+	containers, err := s.containerSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	filter := req.GetFilter()
+	var ret []*runtimeapi.Container
+	for _, c := range containers {
+		if !isCRIContainer(c) {
+			continue
+		}
+		cc := criContainer(c)
+		if filter != nil {
+			if filter.Id != "" && !strings.HasPrefix(cc.Id, filter.Id) {
+				continue
+			}
+			if filter.PodSandboxId != "" && !strings.HasPrefix(cc.PodSandboxId, filter.PodSandboxId) {
+				continue
+			}
+			if filter.State != nil && filter.State.State != cc.State {
+				continue
+			}
+			if !matchLabels(cc.Labels, filter.LabelSelector) {
+				continue
+			}
+		}
+		ret = append(ret, cc)
+	}
+	return &runtimeapi.ListContainersResponse{Containers: ret}, nil
+}
+
+func (s *Server) ContainerStatus(ctx context.Context, req *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	c, err := s.lookupContainer(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	cc := criContainer(c)
+	status := &runtimeapi.ContainerStatus{
+		Id:          cc.Id,
+		Metadata:    cc.Metadata,
+		State:       cc.State,
+		CreatedAt:   cc.CreatedAt,
+		StartedAt:   unixNano(c.State.StartedAt),
+		FinishedAt:  unixNano(c.State.FinishedAt),
+		Image:       cc.Image,
+		ImageRef:    cc.ImageRef,
+		Labels:      cc.Labels,
+		Annotations: cc.Annotations,
+		LogPath:     s.logPath(c),
+	}
+	if cc.State == runtimeapi.ContainerState_CONTAINER_EXITED {
+		status.ExitCode = int32(c.State.ExitCode)
+		status.Reason = "Error"
+		if c.State.ExitCode == 0 {
+			status.Reason = "Completed"
+		}
+	}
+	for _, m := range c.Mounts {
+		status.Mounts = append(status.Mounts, &runtimeapi.Mount{
+			ContainerPath: m.Destination,
+			HostPath:      m.Source,
+			Readonly:      m.ReadOnly,
+		})
+	}
+	return &runtimeapi.ContainerStatusResponse{Status: status}, nil
+}
+
+// ExecSync runs a command in a container and returns its output once it
+// exited, or was killed after the timeout.
+func (s *Server) ExecSync(ctx context.Context, req *runtimeapi.ExecSyncRequest) (*runtimeapi.ExecSyncResponse, error) {
+	if len(req.Cmd) == 0 {
+		return nil, invalidArgument("command must not be empty")
+	}
+	c, err := s.lookupContainer(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	code, err := s.containerSrv.Exec(ctx, *c.ContainerID, container.ExecConfig{
+		Args:   req.Cmd,
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "exec in container %s", *c.ContainerID)
+		}
+		return nil, err
+	}
+	return &runtimeapi.ExecSyncResponse{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: int32(code),
+	}, nil
+}
+
+func isCRIContainer(c *container.Container) bool {
+	_, ok := c.Labels[labelContainerName]
+	return ok
+}
+
+// lookupContainer returns the container id refers to, which may be an
+// unambiguous prefix of its ID. Containers not created through the CRI
+// aren't considered.
+func (s *Server) lookupContainer(id string) (*container.Container, error) {
+	if id == "" {
+		return nil, invalidArgument("container ID must not be empty")
+	}
+	c, err := s.containerSrv.Inspect(id)
+	if err == nil && isCRIContainer(c) {
+		return c, nil
+	}
+	if err != nil && !container.IsContainerNotExists(err) {
+		return nil, err
+	}
+	containers, err := s.containerSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	var match *container.Container
+	for _, c := range containers {
+		if !isCRIContainer(c) || !strings.HasPrefix(*c.ContainerID, id) {
+			continue
+		}
+		if match != nil {
+			return nil, invalidArgument("container ID %q is ambiguous", id)
+		}
+		match = c
+	}
+	if match == nil {
+		return nil, errors.Wrapf(container.ErrNotExists, "%s", id)
+	}
+	return match, nil
+}
+
+// logPath is the CRI log file of c, relative to the log directory of its
+// sandbox. Empty if kubelet didn't ask for one.
+func (s *Server) logPath(c *container.Container) string {
+	rel := c.Labels[labelLogPath]
+	if rel == "" {
+		return ""
+	}
+	p, err := s.podSrv.Inspect(c.Pod)
+	if err != nil || p.Labels[labelSandboxLogDir] == "" {
+		return ""
+	}
+	return filepath.Join(p.Labels[labelSandboxLogDir], rel)
+}
+
+func criContainer(c *container.Container) *runtimeapi.Container {
+	state := runtimeapi.ContainerState_CONTAINER_UNKNOWN
+	switch c.State.Status {
+	case container.StatusCreated:
+		state = runtimeapi.ContainerState_CONTAINER_CREATED
+	case container.StatusRunning:
+		state = runtimeapi.ContainerState_CONTAINER_RUNNING
+	case container.StatusExited:
+		state = runtimeapi.ContainerState_CONTAINER_EXITED
+	}
+	labels, annotations := splitLabels(c.Labels)
+	return &runtimeapi.Container{
+		Id:           *c.ContainerID,
+		PodSandboxId: c.Pod,
+		Metadata: &runtimeapi.ContainerMetadata{
+			Name:    c.Labels[labelContainerName],
+			Attempt: attempt(c.Labels),
+		},
+		Image:       &runtimeapi.ImageSpec{Image: c.Image.ID()},
+		ImageRef:    imageRef(c.Image),
+		State:       state,
+		CreatedAt:   unixNano(c.Created),
+		Labels:      labels,
+		Annotations: annotations,
+	}
+}
+
+// unixNano is t in nanoseconds since the epoch, 0 for the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,82 @@
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/exfly/container/container"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestLabels(t *testing.T) {
+	all := encodeLabels(
+		map[string]string{"app": "web"},
+		map[string]string{"note": "x"},
+		map[string]string{labelContainerName: "web", labelAttempt: "2"},
+	)
+	assert.Equal(t, "x", all[annotationPrefix+"note"])
+	assert.Equal(t, uint32(2), attempt(all))
+	labels, annotations := splitLabels(all)
+	assert.Equal(t, map[string]string{"app": "web"}, labels)
+	assert.Equal(t, map[string]string{"note": "x"}, annotations)
+	assert.True(t, matchLabels(labels, map[string]string{"app": "web"}))
+	assert.False(t, matchLabels(labels, map[string]string{"app": "db"}))
+}
+
+func TestApplySecurityContext(t *testing.T) {
+	c := &container.Container{}
+	err := applySecurityContext(c, &runtimeapi.LinuxContainerSecurityContext{
+		RunAsUser:          &runtimeapi.Int64Value{Value: 1000},
+		RunAsGroup:         &runtimeapi.Int64Value{Value: 100},
+		SeccompProfilePath: "localhost/profile.json",
+		NoNewPrivs:         true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1000:100", c.User)
+	assert.Equal(t, []string{"seccomp=profile.json", "no-new-privileges=true"}, c.SecurityOpt)
+
+	c = &container.Container{}
+	assert.NoError(t, applySecurityContext(c, &runtimeapi.LinuxContainerSecurityContext{}))
+	assert.Equal(t, []string{"no-new-privileges=false"}, c.SecurityOpt)
+
+	assert.Error(t, applySecurityContext(c, &runtimeapi.LinuxContainerSecurityContext{Privileged: true}))
+}
+
+func TestFormatLogLine(t *testing.T) {
+	ts := time.Date(2020, 8, 1, 10, 0, 0, 5, time.UTC)
+	line := formatLogLine(container.LogEntry{Log: "hello\n", Stream: container.StreamStdout, Time: ts})
+	assert.Equal(t, "2020-08-01T10:00:00.000000005Z stdout F hello\n", line)
+}
+
+func TestServeV1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cri")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "cri.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewServer(ctx, nil, nil, nil, nil).Serve(ln)
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	for method, version := range map[string]string{
+		"/runtime.v1.RuntimeService/Version":       "v1",
+		"/runtime.v1alpha2.RuntimeService/Version": "v1alpha2",
+	} {
+		var resp runtimeapi.VersionResponse
+		require.NoError(t, conn.Invoke(ctx, method, &runtimeapi.VersionRequest{}, &resp), method)
+		assert.Equal(t, version, resp.RuntimeApiVersion)
+	}
+}
@@ -0,0 +1,167 @@
+package cri
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exfly/container/image"
+
+	"github.com/pkg/errors"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// imageIDPrefix prefixes the hash of an image config in image IDs.
+const imageIDPrefix = "sha256:"
+
+func (s *Server) ListImages(ctx context.Context, req *runtimeapi.ListImagesRequest) (*runtimeapi.ListImagesResponse, error) {
+	images, err := s.imgSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	var want string
+	if ref := req.GetFilter().GetImage().GetImage(); ref != "" {
+		img, err := image.NewImage(ref)
+		if err != nil {
+			return nil, invalidArgument("%v", err)
+		}
+		want = img.ID()
+	}
+	var ret []*runtimeapi.Image
+	for _, img := range images {
+		if want != "" && img.ID() != want {
+			continue
+		}
+		ret = append(ret, s.criImage(img))
+	}
+	return &runtimeapi.ListImagesResponse{Images: ret}, nil
+}
+
+// ImageStatus returns a nil image for images that aren't local.
+func (s *Server) ImageStatus(ctx context.Context, req *runtimeapi.ImageStatusRequest) (*runtimeapi.ImageStatusResponse, error) {
+	img, err := s.resolveImage(req.GetImage().GetImage())
+	if image.IsHashImgNotExists(err) {
+		return &runtimeapi.ImageStatusResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeapi.ImageStatusResponse{Image: s.criImage(img)}, nil
+}
+
+// PullImage pulls an image unless it is local already. Registry auth isn't
+// supported.
+func (s *Server) PullImage(ctx context.Context, req *runtimeapi.PullImageRequest) (*runtimeapi.PullImageResponse, error) {
+	ref := req.GetImage().GetImage()
+	if ref == "" {
+		return nil, invalidArgument("image must not be empty")
+	}
+	img, err := image.NewImage(ref)
+	if err != nil {
+		return nil, invalidArgument("%v", err)
+	}
+	if img, err = s.imgSrv.GetOrPull(ctx, img); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.PullImageResponse{ImageRef: imageRef(img)}, nil
+}
+
+// RemoveImage removes an image unless a container uses it. Removing an
+// image that is gone succeeds.
+func (s *Server) RemoveImage(ctx context.Context, req *runtimeapi.RemoveImageRequest) (*runtimeapi.RemoveImageResponse, error) {
+	img, err := s.resolveImage(req.GetImage().GetImage())
+	if image.IsHashImgNotExists(err) {
+		return &runtimeapi.RemoveImageResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = s.imgSrv.Remove(img, s.containerSrv.IsImageInUse)
+	if err != nil && !image.IsHashImgNotExists(err) {
+		return nil, err
+	}
+	return &runtimeapi.RemoveImageResponse{}, nil
+}
+
+// ImageFsInfo reports the space and inodes the images directory uses.
+func (s *Server) ImageFsInfo(ctx context.Context, req *runtimeapi.ImageFsInfoRequest) (*runtimeapi.ImageFsInfoResponse, error) {
+	dir := s.configHome.ImagesPath()
+	bytes, inodes, err := diskUsage(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeapi.ImageFsInfoResponse{
+		ImageFilesystems: []*runtimeapi.FilesystemUsage{{
+			Timestamp:  time.Now().UnixNano(),
+			FsId:       &runtimeapi.FilesystemIdentifier{Mountpoint: dir},
+			UsedBytes:  &runtimeapi.UInt64Value{Value: bytes},
+			InodesUsed: &runtimeapi.UInt64Value{Value: inodes},
+		}},
+	}, nil
+}
+
+// resolveImage returns the local image ref refers to, by name or by ID.
+func (s *Server) resolveImage(ref string) (*image.Image, error) {
+	if ref == "" {
+		return nil, invalidArgument("image must not be empty")
+	}
+	if strings.HasPrefix(ref, imageIDPrefix) {
+		images, err := s.imgSrv.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range images {
+			if imageRef(img) == ref {
+				return img, nil
+			}
+		}
+		return nil, errors.Wrapf(image.ErrNotExists, "%s", ref)
+	}
+	img, err := image.NewImage(ref)
+	if err != nil {
+		return nil, invalidArgument("%v", err)
+	}
+	return s.imgSrv.Get(img)
+}
+
+// criImage describes img, with the user it runs as for kubelet to enforce
+// runAsNonRoot.
+func (s *Server) criImage(img *image.Image) *runtimeapi.Image {
+	ret := &runtimeapi.Image{
+		Id:          imageRef(img),
+		RepoTags:    []string{img.ID()},
+		RepoDigests: []string{},
+	}
+	if md, err := s.imgSrv.GetImageMetadata(img); err == nil {
+		user := strings.SplitN(md.Config.User, ":", 2)[0]
+		if uid, err := strconv.ParseInt(user, 10, 64); err == nil {
+			ret.Uid = &runtimeapi.Int64Value{Value: uid}
+		} else {
+			ret.Username = user
+		}
+	}
+	if size, _, err := diskUsage(image.NewImageConfig(s.configHome).GetBasePathForImage(img.ShaHex)); err == nil {
+		ret.Size_ = size
+	}
+	return ret
+}
+
+func imageRef(img *image.Image) string {
+	return imageIDPrefix + img.ShaHex
+}
+
+// diskUsage sums the sizes of the files under dir and counts them.
+func diskUsage(dir string) (bytes, inodes uint64, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		bytes += uint64(info.Size())
+		inodes++
+		return nil
+	})
+	return bytes, inodes, errors.Wrapf(err, "walk %s", dir)
+}
@@ -0,0 +1,70 @@
+package cri
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The CRI metadata of sandboxes and containers is kept in labels under
+// labelPrefix, next to the user labels. Annotations are kept as labels
+// under annotationPrefix.
+const (
+	labelPrefix      = "io.kubernetes.cri."
+	annotationPrefix = labelPrefix + "annotation."
+
+	labelSandboxName      = labelPrefix + "sandbox-name"
+	labelSandboxUID       = labelPrefix + "sandbox-uid"
+	labelSandboxNamespace = labelPrefix + "sandbox-namespace"
+	labelSandboxLogDir    = labelPrefix + "sandbox-log-directory"
+	labelHostNetwork      = labelPrefix + "host-network"
+	labelHostPID          = labelPrefix + "host-pid"
+	labelHostIPC          = labelPrefix + "host-ipc"
+	labelContainerName    = labelPrefix + "container-name"
+	labelAttempt          = labelPrefix + "attempt"
+	labelLogPath          = labelPrefix + "log-path"
+)
+
+// encodeLabels merges the user labels and annotations with the CRI ones.
+func encodeLabels(labels, annotations, cri map[string]string) map[string]string {
+	ret := map[string]string{}
+	for k, v := range labels {
+		ret[k] = v
+	}
+	for k, v := range annotations {
+		ret[annotationPrefix+k] = v
+	}
+	for k, v := range cri {
+		ret[k] = v
+	}
+	return ret
+}
+
+// splitLabels splits what encodeLabels merged back into the user labels and
+// annotations.
+func splitLabels(all map[string]string) (labels, annotations map[string]string) {
+	labels, annotations = map[string]string{}, map[string]string{}
+	for k, v := range all {
+		switch {
+		case strings.HasPrefix(k, annotationPrefix):
+			annotations[strings.TrimPrefix(k, annotationPrefix)] = v
+		case !strings.HasPrefix(k, labelPrefix):
+			labels[k] = v
+		}
+	}
+	return labels, annotations
+}
+
+// matchLabels reports whether labels has all of selector.
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+func attempt(labels map[string]string) uint32 {
+	n, _ := strconv.ParseUint(labels[labelAttempt], 10, 32)
+	return uint32(n)
+}
@@ -0,0 +1,124 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exfly/container/container"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// containerLog is the CRI log file of a container, which kubelet reads and
+// rotates: kubelet renames it and has us reopen it.
+type containerLog struct {
+	mu     sync.Mutex
+	path   string
+	f      *os.File
+	cancel context.CancelFunc
+}
+
+func openContainerLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+}
+
+func (l *containerLog) write(entry container.LogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := io.WriteString(l.f, formatLogLine(entry))
+	return err
+}
+
+func (l *containerLog) reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := openContainerLog(l.path)
+	if err != nil {
+		return err
+	}
+	l.f.Close()
+	l.f = f
+	return nil
+}
+
+// formatLogLine formats entry the way kubelet parses CRI logs:
+// <RFC3339Nano time> <stream> <F for a full line> <line>.
+func formatLogLine(entry container.LogEntry) string {
+	return fmt.Sprintf("%s %s F %s\n", entry.Time.Format(time.RFC3339Nano), entry.Stream, strings.TrimSuffix(entry.Log, "\n"))
+}
+
+// copyLogs copies the output of container id to its CRI log file at path
+// until it exits.
+func (s *Server) copyLogs(id, path string) error {
+	f, err := openContainerLog(path)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	l := &containerLog{path: path, f: f, cancel: cancel}
+	s.logsMu.Lock()
+	if prev := s.logs[id]; prev != nil {
+		prev.cancel()
+	}
+	s.logs[id] = l
+	s.logsMu.Unlock()
+	go func() {
+		err := s.containerSrv.Logs(ctx, id, true, l.write)
+		if err != nil && ctx.Err() == nil && !container.IsContainerNotExists(err) {
+			log.WithError(err).WithField("container", id).Warn("copy container log")
+		}
+		s.logsMu.Lock()
+		if s.logs[id] == l {
+			delete(s.logs, id)
+		}
+		s.logsMu.Unlock()
+		cancel()
+		l.mu.Lock()
+		l.f.Close()
+		l.mu.Unlock()
+	}()
+	return nil
+}
+
+// closeLog stops copying the output of container id.
+func (s *Server) closeLog(id string) {
+	s.logsMu.Lock()
+	defer s.logsMu.Unlock()
+	if l := s.logs[id]; l != nil {
+		l.cancel()
+		delete(s.logs, id)
+	}
+}
+
+// ReopenContainerLog reopens the CRI log file of a running container, after
+// kubelet rotated it.
+func (s *Server) ReopenContainerLog(ctx context.Context, req *runtimeapi.ReopenContainerLogRequest) (*runtimeapi.ReopenContainerLogResponse, error) {
+	c, err := s.lookupContainer(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	if !c.State.IsRunning() {
+		return nil, errors.Wrapf(container.ErrNotRunning, "%s", *c.ContainerID)
+	}
+	s.logsMu.Lock()
+	l := s.logs[*c.ContainerID]
+	s.logsMu.Unlock()
+	if l == nil {
+		return nil, errors.Errorf("container %s has no log file", *c.ContainerID)
+	}
+	if err := l.reopen(); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.ReopenContainerLogResponse{}, nil
+}
@@ -0,0 +1,229 @@
+package cri
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/exfly/container/config"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/pod"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// RunPodSandbox creates and starts a pod named after a new ID. Sandboxes
+// sharing the node network, PID or IPC namespace record it for their
+// containers to join the host ones instead.
+func (s *Server) RunPodSandbox(ctx context.Context, req *runtimeapi.RunPodSandboxRequest) (*runtimeapi.RunPodSandboxResponse, error) {
+	cfg := req.GetConfig()
+	if cfg.GetMetadata() == nil {
+		return nil, invalidArgument("sandbox config must include metadata")
+	}
+	if req.RuntimeHandler != "" {
+		return nil, invalidArgument("unsupported runtime handler %q", req.RuntimeHandler)
+	}
+	if config.IsRootless() {
+		// Members couldn't join the namespaces of the sandbox.
+		return nil, status.Error(codes.FailedPrecondition, "pod sandboxes are not supported in rootless mode")
+	}
+	md := cfg.Metadata
+	cri := map[string]string{
+		labelSandboxName:      md.Name,
+		labelSandboxUID:       md.Uid,
+		labelSandboxNamespace: md.Namespace,
+		labelAttempt:          strconv.FormatUint(uint64(md.Attempt), 10),
+		labelSandboxLogDir:    cfg.LogDirectory,
+	}
+	nsOpts := cfg.GetLinux().GetSecurityContext().GetNamespaceOptions()
+	if nsOpts.GetNetwork() == runtimeapi.NamespaceMode_NODE {
+		cri[labelHostNetwork] = "true"
+	}
+	if nsOpts.GetPid() == runtimeapi.NamespaceMode_NODE {
+		cri[labelHostPID] = "true"
+	}
+	if nsOpts.GetIpc() == runtimeapi.NamespaceMode_NODE {
+		cri[labelHostIPC] = "true"
+	}
+	id := container.CreateContainerID()
+	if _, err := s.podSrv.Create(id, encodeLabels(cfg.Labels, cfg.Annotations, cri)); err != nil {
+		return nil, err
+	}
+	if _, err := s.podSrv.Start(s.ctx, id); err != nil {
+		if err := s.podSrv.Remove(s.ctx, id, true); err != nil {
+			log.WithError(err).WithField("sandbox", id).Warn("remove sandbox")
+		}
+		return nil, err
+	}
+	return &runtimeapi.RunPodSandboxResponse{PodSandboxId: id}, nil
+}
+
+// StopPodSandbox stops the containers of a sandbox and its infra process.
+// Stopping a sandbox that is gone succeeds.
+func (s *Server) StopPodSandbox(ctx context.Context, req *runtimeapi.StopPodSandboxRequest) (*runtimeapi.StopPodSandboxResponse, error) {
+	p, err := s.lookupSandbox(req.PodSandboxId)
+	if pod.IsPodNotExists(err) {
+		return &runtimeapi.StopPodSandboxResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.podSrv.Stop(p.Name, container.DefaultStopTimeout); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.StopPodSandboxResponse{}, nil
+}
+
+// RemovePodSandbox removes a sandbox with its containers, running or not.
+// Removing a sandbox that is gone succeeds.
+func (s *Server) RemovePodSandbox(ctx context.Context, req *runtimeapi.RemovePodSandboxRequest) (*runtimeapi.RemovePodSandboxResponse, error) {
+	p, err := s.lookupSandbox(req.PodSandboxId)
+	if pod.IsPodNotExists(err) {
+		return &runtimeapi.RemovePodSandboxResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	containers, err := s.containerSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if c.Pod != p.Name {
+			continue
+		}
+		if err := s.removeContainer(*c.ContainerID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.podSrv.Remove(s.ctx, p.Name, true); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.RemovePodSandboxResponse{}, nil
+}
+
+func (s *Server) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	p, err := s.lookupSandbox(req.PodSandboxId)
+	if err != nil {
+		return nil, err
+	}
+	sb := s.criSandbox(p)
+	labels, annotations := splitLabels(p.Labels)
+	nsMode := func(label string) runtimeapi.NamespaceMode {
+		if p.Labels[label] == "true" {
+			return runtimeapi.NamespaceMode_NODE
+		}
+		return runtimeapi.NamespaceMode_POD
+	}
+	return &runtimeapi.PodSandboxStatusResponse{
+		Status: &runtimeapi.PodSandboxStatus{
+			Id:        sb.Id,
+			Metadata:  sb.Metadata,
+			State:     sb.State,
+			CreatedAt: sb.CreatedAt,
+			Network:   &runtimeapi.PodSandboxNetworkStatus{},
+			Linux: &runtimeapi.LinuxPodSandboxStatus{
+				Namespaces: &runtimeapi.Namespace{
+					Options: &runtimeapi.NamespaceOption{
+						Network: nsMode(labelHostNetwork),
+						Pid:     nsMode(labelHostPID),
+						Ipc:     nsMode(labelHostIPC),
+					},
+				},
+			},
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}, nil
+}
+
+func (s *Server) ListPodSandbox(ctx context.Context, req *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	pods, err := s.podSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	filter := req.GetFilter()
+	var ret []*runtimeapi.PodSandbox
+	for _, p := range pods {
+		if !isSandbox(p) {
+			continue
+		}
+		sb := s.criSandbox(p)
+		if filter != nil {
+			if filter.Id != "" && !strings.HasPrefix(sb.Id, filter.Id) {
+				continue
+			}
+			if filter.State != nil && filter.State.State != sb.State {
+				continue
+			}
+			if !matchLabels(sb.Labels, filter.LabelSelector) {
+				continue
+			}
+		}
+		ret = append(ret, sb)
+	}
+	return &runtimeapi.ListPodSandboxResponse{Items: ret}, nil
+}
+
+func isSandbox(p *pod.Pod) bool {
+	_, ok := p.Labels[labelSandboxName]
+	return ok
+}
+
+// lookupSandbox returns the sandbox id refers to, which may be an unambiguous
+// prefix of its ID. Pods not created through the CRI aren't sandboxes.
+func (s *Server) lookupSandbox(id string) (*pod.Pod, error) {
+	if id == "" {
+		return nil, invalidArgument("sandbox ID must not be empty")
+	}
+	p, err := s.podSrv.Inspect(id)
+	if err == nil && isSandbox(p) {
+		return p, nil
+	}
+	if err != nil && !pod.IsPodNotExists(err) {
+		return nil, err
+	}
+	pods, err := s.podSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	var match *pod.Pod
+	for _, p := range pods {
+		if !isSandbox(p) || !strings.HasPrefix(p.Name, id) {
+			continue
+		}
+		if match != nil {
+			return nil, invalidArgument("sandbox ID %q is ambiguous", id)
+		}
+		match = p
+	}
+	if match == nil {
+		return nil, errors.Wrapf(pod.ErrNotExists, "%s", id)
+	}
+	return match, nil
+}
+
+func (s *Server) criSandbox(p *pod.Pod) *runtimeapi.PodSandbox {
+	state := runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+	if s.podSrv.Status(p) == pod.StatusRunning {
+		state = runtimeapi.PodSandboxState_SANDBOX_READY
+	}
+	labels, annotations := splitLabels(p.Labels)
+	return &runtimeapi.PodSandbox{
+		Id: p.Name,
+		Metadata: &runtimeapi.PodSandboxMetadata{
+			Name:      p.Labels[labelSandboxName],
+			Uid:       p.Labels[labelSandboxUID],
+			Namespace: p.Labels[labelSandboxNamespace],
+			Attempt:   attempt(p.Labels),
+		},
+		State:       state,
+		CreatedAt:   p.CreatedAt.UnixNano(),
+		Labels:      labels,
+		Annotations: annotations,
+	}
+}
@@ -0,0 +1,135 @@
+// Package cri serves the Kubernetes Container Runtime Interface, v1 and
+// v1alpha2, over gRPC. Pod sandboxes are pods, CRI containers are containers joining
+// them, and the CRI metadata is kept in their labels.
+//
+// Streaming (exec, attach and port forwarding) and stats aren't served;
+// ExecSync is.
+package cri
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/config"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/image"
+	"github.com/exfly/container/pod"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// kubeAPIVersion is the version of the kubelet runtime API.
+	kubeAPIVersion    = "0.1.0"
+	runtimeName       = "container"
+	runtimeAPIVersion = "v1alpha2"
+)
+
+func NewServer(ctx context.Context, configHome *config.Home, imgSrv *image.ImageService, containerSrv *container.ContainerService, podSrv *pod.PodService) *Server {
+	return &Server{
+		ctx:          ctx,
+		configHome:   configHome,
+		imgSrv:       imgSrv,
+		containerSrv: containerSrv,
+		podSrv:       podSrv,
+		logs:         map[string]*containerLog{},
+	}
+}
+
+type Server struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+	runtimeapi.UnimplementedImageServiceServer
+
+	// ctx outlives requests, containers started by the server use it.
+	ctx          context.Context
+	configHome   *config.Home
+	imgSrv       *image.ImageService
+	containerSrv *container.ContainerService
+	podSrv       *pod.PodService
+
+	logsMu sync.Mutex
+	// logs are the CRI log files of the running containers.
+	logs map[string]*containerLog
+}
+
+// Serve serves the CRI on ln until ctx is done.
+func (s *Server) Serve(ln net.Listener) error {
+	srv := grpc.NewServer(grpc.UnaryInterceptor(unaryInterceptor))
+	runtimeapi.RegisterRuntimeServiceServer(srv, s)
+	runtimeapi.RegisterImageServiceServer(srv, s)
+	registerV1(srv, s)
+	go func() {
+		<-s.ctx.Done()
+		srv.Stop()
+	}()
+	return srv.Serve(ln)
+}
+
+// unaryInterceptor logs requests and turns our errors into gRPC ones.
+func unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	log.WithField("method", info.FullMethod).Debug("cri request")
+	resp, err := handler(ctx, req)
+	if err != nil {
+		err = grpcError(err)
+		if status.Code(err) == codes.Unknown {
+			log.WithError(err).WithField("method", info.FullMethod).Error("cri request failed")
+		}
+	}
+	return resp, err
+}
+
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Unknown
+	switch cause := errors.Cause(err); {
+	case container.IsContainerNotExists(err), pod.IsPodNotExists(err), image.IsHashImgNotExists(err):
+		code = codes.NotFound
+	case cause == container.ErrRunning, cause == container.ErrNotRunning, cause == image.ErrInUse,
+		cause == container.ErrPaused, cause == container.ErrNotPaused:
+		code = codes.FailedPrecondition
+	case cause == context.DeadlineExceeded:
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return status.Errorf(codes.InvalidArgument, format, args...)
+}
+
+func (s *Server) Version(ctx context.Context, req *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	return &runtimeapi.VersionResponse{
+		Version:           kubeAPIVersion,
+		RuntimeName:       runtimeName,
+		RuntimeVersion:    api.Version,
+		RuntimeApiVersion: apiVersion(ctx),
+	}, nil
+}
+
+// Status reports the network ready: sandboxes get a network namespace of
+// their own, with only a loopback interface.
+func (s *Server) Status(ctx context.Context, req *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	return &runtimeapi.StatusResponse{
+		Status: &runtimeapi.RuntimeStatus{
+			Conditions: []*runtimeapi.RuntimeCondition{
+				{Type: runtimeapi.RuntimeReady, Status: true},
+				{Type: runtimeapi.NetworkReady, Status: true},
+			},
+		},
+	}, nil
+}
+
+// UpdateRuntimeConfig ignores the pod CIDR, sandboxes aren't given
+// addresses.
+func (s *Server) UpdateRuntimeConfig(ctx context.Context, req *runtimeapi.UpdateRuntimeConfigRequest) (*runtimeapi.UpdateRuntimeConfigResponse, error) {
+	return &runtimeapi.UpdateRuntimeConfigResponse{}, nil
+}
@@ -0,0 +1,63 @@
+package cri
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// runtime.v1 is a copy of v1alpha2 under another package name: the messages
+// are the same on the wire, so the v1alpha2 server serves it as well.
+const v1Package = "runtime.v1"
+
+// registerV1 registers s for the runtime.v1 services.
+func registerV1(srv *grpc.Server, s *Server) {
+	srv.RegisterService(aliasService(v1Package+".RuntimeService", (*runtimeapi.RuntimeServiceServer)(nil)), s)
+	srv.RegisterService(aliasService(v1Package+".ImageService", (*runtimeapi.ImageServiceServer)(nil)), s)
+}
+
+// aliasService describes the unary service name with the methods of the
+// server interface iface points to.
+func aliasService(name string, iface interface{}) *grpc.ServiceDesc {
+	typ := reflect.TypeOf(iface).Elem()
+	desc := &grpc.ServiceDesc{ServiceName: name, HandlerType: iface}
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: m.Name,
+			Handler:    unaryHandler("/"+name+"/"+m.Name, m.Name, m.Type.In(1).Elem()),
+		})
+	}
+	return desc
+}
+
+// unaryHandler calls the method of the server with a request of reqType, the
+// way generated handlers do.
+func unaryHandler(fullMethod, method string, reqType reflect.Type) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := reflect.New(reqType).Interface()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			out := reflect.ValueOf(srv).MethodByName(method).Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(req)})
+			err, _ := out[1].Interface().(error)
+			return out[0].Interface(), err
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handler)
+	}
+}
+
+// apiVersion returns the CRI version the request in ctx was made with.
+func apiVersion(ctx context.Context) string {
+	if method, ok := grpc.Method(ctx); ok && strings.HasPrefix(method, "/"+v1Package+".") {
+		return "v1"
+	}
+	return runtimeAPIVersion
+}
@@ -0,0 +1,328 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/pod"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+func (s *Server) listContainers(rt *route) {
+	containers, err := s.containerSrv.List()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	all := boolQuery(rt.r, "all")
+	ret := []*container.Container{}
+	for _, c := range containers {
+		if all || c.State.IsRunning() {
+			ret = append(ret, c)
+		}
+	}
+	writeJSON(rt.w, http.StatusOK, ret)
+}
+
+func (s *Server) createContainer(rt *route) {
+	var c container.Container
+	if err := readJSON(rt.r, &c); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	id, err := s.create(&c)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusCreated, api.CreateResponse{ID: id})
+}
+
+// create creates c from a local image under an ID of our own, which it
+// returns.
+func (s *Server) create(c *container.Container) (string, error) {
+	if c.Image == nil {
+		return "", badRequest(errors.New("no image given"))
+	}
+	img, err := s.localImage(c.Image.ID())
+	if err != nil {
+		return "", err
+	}
+	id := container.CreateContainerID()
+	c.ContainerID = &id
+	c.Image = img
+	if c.Pod != "" {
+		if err := s.podSrv.Join(c, c.Pod); err != nil {
+			if pod.IsPodNotExists(err) {
+				return "", err
+			}
+			return "", badRequest(err)
+		}
+	}
+	if err := s.containerSrv.Create(c); err != nil {
+		return "", badRequest(err)
+	}
+	return id, nil
+}
+
+func (s *Server) inspectContainer(rt *route) {
+	c, err := s.containerSrv.Inspect(rt.path[1])
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusOK, c)
+}
+
+func (s *Server) removeContainer(rt *route) {
+	if err := s.containerSrv.Remove(rt.r.Context(), rt.path[1], boolQuery(rt.r, "force")); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+// startContainer starts a container, or for one created from a bundle lets
+// its waiting process run.
+func (s *Server) startContainer(rt *route) {
+	c, err := s.containerSrv.Inspect(rt.path[1])
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if c.Bundle != "" {
+		err = s.containerSrv.StartCreated(rt.path[1])
+	} else {
+		err = s.containerSrv.Start(s.ctx, rt.path[1])
+	}
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) stopContainer(rt *route) {
+	timeout := container.DefaultStopTimeout
+	if t := rt.r.URL.Query().Get("t"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			writeError(rt.w, badRequest(err))
+			return
+		}
+	}
+	if err := s.containerSrv.Stop(rt.path[1], timeout); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) killContainer(rt *route) {
+	sig := unix.SIGKILL
+	if name := rt.r.URL.Query().Get("signal"); name != "" {
+		var err error
+		if sig, err = container.ParseSignal(name); err != nil {
+			writeError(rt.w, badRequest(err))
+			return
+		}
+	}
+	if err := s.containerSrv.Kill(rt.path[1], sig); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) pauseContainer(rt *route) {
+	if err := s.containerSrv.Pause(rt.path[1]); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) unpauseContainer(rt *route) {
+	if err := s.containerSrv.Unpause(rt.path[1]); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) waitContainer(rt *route) {
+	code, err := s.containerSrv.Wait(rt.r.Context(), rt.path[1])
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusOK, api.WaitResponse{ExitCode: code})
+}
+
+// containerLogs streams the logs as a multiplexed stream.
+func (s *Server) containerLogs(rt *route) {
+	id := rt.path[1]
+	if _, err := s.containerSrv.Inspect(id); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	query := rt.r.URL.Query()
+	stdout := query.Get("stdout") == "" || boolQuery(rt.r, "stdout")
+	stderr := query.Get("stderr") == "" || boolQuery(rt.r, "stderr")
+	rt.w.Header().Set("Content-Type", "application/vnd.containerd.multiplexed-stream")
+	rt.w.WriteHeader(http.StatusOK)
+	mux := api.NewMuxer(rt.w)
+	if f, ok := rt.w.(http.Flusher); ok {
+		mux.Flush = f.Flush
+		f.Flush()
+	}
+	err := s.containerSrv.Logs(rt.r.Context(), id, boolQuery(rt.r, "follow"), func(entry container.LogEntry) error {
+		switch {
+		case entry.Stream == container.StreamStdout && stdout:
+			return mux.WriteFrame(api.Stdout, []byte(entry.Log))
+		case entry.Stream == container.StreamStderr && stderr:
+			return mux.WriteFrame(api.Stderr, []byte(entry.Log))
+		}
+		return nil
+	})
+	if err != nil && rt.r.Context().Err() == nil {
+		mux.WriteFrame(api.Systemerr, []byte(err.Error()))
+	}
+}
+
+// execContainer runs a process in a container over the hijacked
+// connection: the client sends stdin raw, closing its write side at EOF, and
+// gets a multiplexed stream of the output ending with the exit status.
+func (s *Server) execContainer(rt *route) {
+	var req api.ExecRequest
+	if err := readJSON(rt.r, &req); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if len(req.Args) == 0 {
+		writeError(rt.w, badRequest(errors.New("exec: no command")))
+		return
+	}
+	id := rt.path[1]
+	c, err := s.containerSrv.Inspect(id)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if !c.State.IsRunning() {
+		writeError(rt.w, errors.Wrapf(container.ErrNotRunning, "%s", id))
+		return
+	}
+	if c.State.Paused {
+		writeError(rt.w, errors.Wrapf(container.ErrPaused, "%s", id))
+		return
+	}
+	conn, buf, err := hijack(rt, "application/vnd.containerd.raw-stream")
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	defer conn.Close()
+
+	// The process gets a pipe: it sees EOF when the client is done, and
+	// Exec doesn't wait for a client that never sends anything.
+	mux := api.NewMuxer(conn)
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		mux.WriteFrame(api.Systemerr, []byte(err.Error()))
+		return
+	}
+	defer stdinR.Close()
+	go func() {
+		buf.Reader.WriteTo(stdinW)
+		stdinW.Close()
+	}()
+	code, err := s.containerSrv.Exec(s.ctx, id, container.ExecConfig{
+		Args:    req.Args,
+		Env:     req.Env,
+		CapAdd:  req.CapAdd,
+		CapDrop: req.CapDrop,
+		Stdin:   stdinR,
+		Stdout:  mux.Stream(api.Stdout),
+		Stderr:  mux.Stream(api.Stderr),
+	})
+	if err != nil {
+		mux.WriteFrame(api.Systemerr, []byte(err.Error()))
+		return
+	}
+	status, _ := json.Marshal(api.WaitResponse{ExitCode: code})
+	if err := mux.WriteFrame(api.Exit, status); err != nil {
+		log.WithError(err).Debug("write exec status")
+	}
+}
+
+// attachContainer starts a container over the hijacked connection, the same
+// way execContainer runs a process, and ends the stream with its exit status.
+func (s *Server) attachContainer(rt *route) {
+	id := rt.path[1]
+	c, err := s.containerSrv.Inspect(id)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if c.State.IsRunning() {
+		writeError(rt.w, errors.Wrapf(container.ErrRunning, "%s", id))
+		return
+	}
+	conn, buf, err := hijack(rt, "application/vnd.containerd.raw-stream")
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	defer conn.Close()
+
+	mux := api.NewMuxer(conn)
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		mux.WriteFrame(api.Systemerr, []byte(err.Error()))
+		return
+	}
+	defer stdinR.Close()
+	go func() {
+		buf.Reader.WriteTo(stdinW)
+		stdinW.Close()
+	}()
+	if err := s.containerSrv.StartAttached(s.ctx, id, stdinR, mux.Stream(api.Stdout), mux.Stream(api.Stderr)); err != nil {
+		mux.WriteFrame(api.Systemerr, []byte(err.Error()))
+		return
+	}
+	code, err := s.containerSrv.Wait(s.ctx, id)
+	if err != nil {
+		mux.WriteFrame(api.Systemerr, []byte(err.Error()))
+		return
+	}
+	status, _ := json.Marshal(api.WaitResponse{ExitCode: code})
+	if err := mux.WriteFrame(api.Exit, status); err != nil {
+		log.WithError(err).Debug("write attach status")
+	}
+}
+
+// hijack takes the connection of rt over for a raw stream of contentType.
+func hijack(rt *route, contentType string) (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rt.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.Write([]byte("HTTP/1.1 101 UPGRADED\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: tcp\r\n\r\n"))
+	return conn, buf, nil
+}
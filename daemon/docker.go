@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/api/docker"
+
+	"golang.org/x/sys/unix"
+)
+
+// dockerVersionPrefix matches the version docker clients start paths with.
+var dockerVersionPrefix = regexp.MustCompile(`^v1\.[0-9]+$`)
+
+// serveDocker serves the subset of the Docker Engine API the docker CLI
+// needs to run containers.
+func (s *Server) serveDocker(rt *route) {
+	switch {
+	case rt.match(http.MethodGet, "_ping"), rt.match(http.MethodHead, "_ping"):
+		dockerPing(rt)
+	case rt.match(http.MethodGet, "version"):
+		dockerVersion(rt)
+	case rt.match(http.MethodGet, "images", "json"):
+		s.dockerListImages(rt)
+	case rt.match(http.MethodPost, "images", "create"):
+		s.dockerPullImage(rt)
+	case rt.match(http.MethodGet, "containers", "json"):
+		s.dockerListContainers(rt)
+	case rt.match(http.MethodPost, "containers", "create"):
+		s.dockerCreateContainer(rt)
+	case rt.match(http.MethodGet, "containers", "{id}", "json"):
+		s.dockerInspectContainer(rt)
+	case rt.match(http.MethodDelete, "containers", "{id}"):
+		s.removeContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "start"):
+		s.dockerStartContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "stop"):
+		s.dockerStopContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "kill"):
+		s.killContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "wait"):
+		s.dockerWaitContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "pause"):
+		s.pauseContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "unpause"):
+		s.unpauseContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "attach"):
+		s.dockerAttachContainer(rt)
+	case rt.match(http.MethodGet, "containers", "{id}", "logs"):
+		s.dockerContainerLogs(rt)
+	default:
+		writeError(rt.w, errNotFound)
+	}
+}
+
+// dockerPing answers the request clients negotiate their API version with.
+func dockerPing(rt *route) {
+	h := rt.w.Header()
+	h.Set("API-Version", docker.APIVersion)
+	h.Set("OSType", runtime.GOOS)
+	h.Set("Docker-Experimental", "false")
+	h.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	rt.w.WriteHeader(http.StatusOK)
+	if rt.method == http.MethodGet {
+		rt.w.Write([]byte("OK"))
+	}
+}
+
+func dockerVersion(rt *route) {
+	ret := docker.VersionResponse{
+		Version:       api.Version,
+		APIVersion:    docker.APIVersion,
+		MinAPIVersion: docker.MinAPIVersion,
+		GoVersion:     runtime.Version(),
+		Os:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+	}
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err == nil {
+		ret.KernelVersion = string(bytes.TrimRight(uts.Release[:], "\x00"))
+	}
+	writeJSON(rt.w, http.StatusOK, ret)
+}
+
+// unixTimeQuery parses the query parameter key, a unix time in seconds with
+// an optional fraction, as docker clients send them. Unset is the zero time.
+func unixTimeQuery(r *http.Request, key string) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Time{}, badRequest(err)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), nil
+}
@@ -0,0 +1,603 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/api/docker"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/image"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) dockerListContainers(rt *route) {
+	containers, err := s.containerSrv.List()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	all := boolQuery(rt.r, "all")
+	ret := []docker.ContainerSummary{}
+	for _, c := range containers {
+		if all || c.State.IsRunning() {
+			ret = append(ret, dockerContainerSummary(c))
+		}
+	}
+	writeJSON(rt.w, http.StatusOK, ret)
+}
+
+func (s *Server) dockerCreateContainer(rt *route) {
+	if rt.r.URL.Query().Get("name") != "" {
+		writeError(rt.w, badRequest(errors.New("container names are not supported")))
+		return
+	}
+	var req docker.ContainerCreateRequest
+	if err := readJSON(rt.r, &req); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	c, warnings, err := containerFromDocker(&req)
+	if err != nil {
+		writeError(rt.w, badRequest(err))
+		return
+	}
+	// A missing image is a 404, on which clients pull it and try again.
+	id, err := s.create(c)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusCreated, docker.ContainerCreateResponse{ID: id, Warnings: warnings})
+}
+
+func (s *Server) dockerInspectContainer(rt *route) {
+	c, err := s.containerSrv.Inspect(rt.path[1])
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusOK, dockerContainerJSON(c))
+}
+
+func (s *Server) dockerStartContainer(rt *route) {
+	err := s.containerSrv.Start(s.ctx, rt.path[1])
+	if errors.Cause(err) == container.ErrRunning {
+		rt.w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) dockerStopContainer(rt *route) {
+	id := rt.path[1]
+	timeout := container.DefaultStopTimeout
+	if t := rt.r.URL.Query().Get("t"); t != "" {
+		secs, err := strconv.Atoi(t)
+		if err != nil {
+			writeError(rt.w, badRequest(err))
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+	}
+	c, err := s.containerSrv.Inspect(id)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if !c.State.IsRunning() {
+		rt.w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err := s.containerSrv.Stop(id, timeout); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+// dockerWaitContainer sends the response header as soon as the wait is set
+// up: clients start the container once they have it.
+func (s *Server) dockerWaitContainer(rt *route) {
+	id := rt.path[1]
+	var wait func() (int, error)
+	switch condition := rt.r.URL.Query().Get("condition"); condition {
+	case "", "not-running":
+		if _, err := s.containerSrv.Inspect(id); err != nil {
+			writeError(rt.w, err)
+			return
+		}
+		wait = func() (int, error) {
+			return s.containerSrv.Wait(rt.r.Context(), id)
+		}
+	case "next-exit", "removed":
+		// Containers to be removed are once they exit.
+		exit, err := s.containerSrv.NextExit(rt.r.Context(), id)
+		if err != nil {
+			writeError(rt.w, err)
+			return
+		}
+		wait = func() (int, error) {
+			select {
+			case code, ok := <-exit:
+				if !ok {
+					return -1, errors.Errorf("container %s was removed", id)
+				}
+				return code, nil
+			case <-rt.r.Context().Done():
+				return -1, rt.r.Context().Err()
+			}
+		}
+	default:
+		writeError(rt.w, badRequest(errors.Errorf("invalid condition %q", condition)))
+		return
+	}
+	rt.w.Header().Set("Content-Type", "application/json")
+	rt.w.WriteHeader(http.StatusOK)
+	if f, ok := rt.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	var ret docker.WaitResponse
+	code, err := wait()
+	if err != nil {
+		ret.StatusCode = -1
+		ret.Error = &docker.WaitError{Message: err.Error()}
+	} else {
+		ret.StatusCode = code
+	}
+	if err := json.NewEncoder(rt.w).Encode(ret); err != nil {
+		log.WithError(err).Debug("write wait response")
+	}
+}
+
+// dockerAttachContainer streams the output of a container over the
+// hijacked connection until it exits. It is the container log from the time
+// of the attach on: clients attach before they start a container. Stdin
+// isn't attached.
+func (s *Server) dockerAttachContainer(rt *route) {
+	id := rt.path[1]
+	if _, err := s.containerSrv.Inspect(id); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	since := time.Now()
+	if boolQuery(rt.r, "logs") {
+		since = time.Time{}
+	}
+	follow := boolQuery(rt.r, "stream")
+	stdout, stderr := boolQuery(rt.r, "stdout"), boolQuery(rt.r, "stderr")
+	conn, _, err := hijack(rt, "application/vnd.docker.multiplexed-stream")
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	defer conn.Close()
+	mux := api.NewMuxer(conn)
+	err = s.containerSrv.Logs(rt.r.Context(), id, follow, func(entry container.LogEntry) error {
+		if entry.Time.Before(since) {
+			return nil
+		}
+		return writeLogEntry(mux, entry, stdout, stderr, false)
+	})
+	if err != nil {
+		log.WithError(err).WithField("container", id).Debug("attach")
+	}
+}
+
+func (s *Server) dockerContainerLogs(rt *route) {
+	id := rt.path[1]
+	if _, err := s.containerSrv.Inspect(id); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	stdout, stderr := boolQuery(rt.r, "stdout"), boolQuery(rt.r, "stderr")
+	if !stdout && !stderr {
+		writeError(rt.w, badRequest(errors.New("you must choose at least one stream")))
+		return
+	}
+	since, err := unixTimeQuery(rt.r, "since")
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	until, err := unixTimeQuery(rt.r, "until")
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	tail := -1
+	if t := rt.r.URL.Query().Get("tail"); t != "" && t != "all" {
+		if tail, err = strconv.Atoi(t); err != nil || tail < 0 {
+			writeError(rt.w, badRequest(errors.Errorf("invalid tail %q", t)))
+			return
+		}
+	}
+	timestamps, follow := boolQuery(rt.r, "timestamps"), boolQuery(rt.r, "follow")
+	selected := func(entry container.LogEntry) bool {
+		if entry.Stream == container.StreamStdout && !stdout || entry.Stream == container.StreamStderr && !stderr {
+			return false
+		}
+		return !entry.Time.Before(since) && (until.IsZero() || entry.Time.Before(until))
+	}
+
+	rt.w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+	rt.w.WriteHeader(http.StatusOK)
+	mux := api.NewMuxer(rt.w)
+	if f, ok := rt.w.(http.Flusher); ok {
+		mux.Flush = f.Flush
+		f.Flush()
+	}
+	ctx := rt.r.Context()
+	// With a tail, a first pass finds the last entries and the second
+	// follows from after those it read.
+	skip := 0
+	if tail >= 0 {
+		var last []container.LogEntry
+		err = s.containerSrv.Logs(ctx, id, false, func(entry container.LogEntry) error {
+			skip++
+			if selected(entry) {
+				last = append(last, entry)
+				if len(last) > tail {
+					last = last[1:]
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).WithField("container", id).Debug("logs")
+			return
+		}
+		for _, entry := range last {
+			if err := writeLogEntry(mux, entry, stdout, stderr, timestamps); err != nil {
+				return
+			}
+		}
+		if !follow {
+			return
+		}
+	}
+	err = s.containerSrv.Logs(ctx, id, follow, func(entry container.LogEntry) error {
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		if !selected(entry) {
+			return nil
+		}
+		return writeLogEntry(mux, entry, stdout, stderr, timestamps)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.WithError(err).WithField("container", id).Debug("logs")
+	}
+}
+
+// writeLogEntry writes entry as a frame of its stream if it is selected.
+func writeLogEntry(mux *api.Muxer, entry container.LogEntry, stdout, stderr, timestamps bool) error {
+	line := entry.Log
+	if timestamps {
+		line = entry.Time.UTC().Format(time.RFC3339Nano) + " " + line
+	}
+	switch {
+	case entry.Stream == container.StreamStdout && stdout:
+		return mux.WriteFrame(api.Stdout, []byte(line))
+	case entry.Stream == container.StreamStderr && stderr:
+		return mux.WriteFrame(api.Stderr, []byte(line))
+	}
+	return nil
+}
+
+// containerFromDocker converts a docker create request, along with warnings
+// about what of it is ignored.
+func containerFromDocker(req *docker.ContainerCreateRequest) (*container.Container, []string, error) {
+	if req.Tty {
+		return nil, nil, errors.New("tty is not supported")
+	}
+	img, err := image.NewImage(req.Image)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := container.NewContainer(img, nil)
+	c.Cmd = req.Cmd
+	c.Entrypoint = req.Entrypoint
+	if len(c.Entrypoint) == 1 && c.Entrypoint[0] == "" {
+		// An explicit empty entrypoint clears the image one.
+		c.Entrypoint = []string{}
+	}
+	c.Env = req.Env
+	c.WorkingDir = req.WorkingDir
+	c.User = req.User
+	c.Labels = req.Labels
+	c.StopSignal = req.StopSignal
+	c.Healthcheck = req.Healthcheck
+	c.ExposedPorts = sortedSet(req.ExposedPorts)
+	for _, dest := range sortedSet(req.Volumes) {
+		m, err := container.ParseVolumeSpec(dest)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+	warnings := []string{}
+	if req.Hostname != "" {
+		warnings = append(warnings, "Hostname is not supported, the container ID is used")
+	}
+	if req.OpenStdin {
+		warnings = append(warnings, "Stdin is not supported, the container reads EOF")
+	}
+	hc := req.HostConfig
+	if hc == nil {
+		return c, warnings, nil
+	}
+	if hc.Privileged {
+		return nil, nil, errors.New("privileged containers are not supported")
+	}
+	switch hc.NetworkMode {
+	case "", "default":
+		// Our default, the host network.
+	case "bridge":
+		return nil, nil, errors.New("bridge networking is not supported, use host or none")
+	case container.NetworkHost, container.NetworkNone:
+		c.Network = hc.NetworkMode
+	default:
+		return nil, nil, errors.Errorf("network mode %q is not supported", hc.NetworkMode)
+	}
+	c.AutoRemove = hc.AutoRemove
+	c.CapAdd = hc.CapAdd
+	c.CapDrop = hc.CapDrop
+	c.SecurityOpt = hc.SecurityOpt
+	c.ReadonlyRootfs = hc.ReadonlyRootfs
+	c.Sysctls = hc.Sysctls
+	c.PidMode = hc.PidMode
+	c.IpcMode = hc.IpcMode
+	c.UtsMode = hc.UTSMode
+	for _, spec := range hc.ExtraHosts {
+		h, err := container.ParseExtraHost(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.ExtraHosts = append(c.ExtraHosts, h)
+	}
+	for _, spec := range hc.Binds {
+		m, err := container.ParseVolumeSpec(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+	for _, dm := range hc.Mounts {
+		m, err := container.ParseMountSpec(fmt.Sprintf("type=%s,source=%s,target=%s,readonly=%t",
+			dm.Type, dm.Source, dm.Target, dm.ReadOnly))
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+	for _, ul := range hc.Ulimits {
+		u, err := container.ParseUlimit(fmt.Sprintf("%s=%d:%d", ul.Name, ul.Soft, ul.Hard))
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Ulimits = append(c.Ulimits, u)
+	}
+	for _, dm := range hc.Devices {
+		spec := dm.PathOnHost
+		if dm.PathInContainer != "" {
+			spec += ":" + dm.PathInContainer
+		}
+		if dm.CgroupPermissions != "" {
+			spec += ":" + dm.CgroupPermissions
+		}
+		d, err := container.ParseDeviceSpec(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Devices = append(c.Devices, d)
+	}
+	return c, warnings, nil
+}
+
+func sortedSet(set map[string]struct{}) []string {
+	var ret []string
+	for k := range set {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func dockerConfig(c *container.Container) *docker.Config {
+	cfg := &docker.Config{
+		Hostname:   *c.ContainerID,
+		User:       c.User,
+		Env:        c.Env,
+		Cmd:        c.Cmd,
+		Entrypoint: c.Entrypoint,
+		WorkingDir: c.WorkingDir,
+		Labels:     c.Labels,
+		StopSignal: c.StopSignal,
+		Volumes:    map[string]struct{}{},
+	}
+	if c.Image != nil {
+		cfg.Image = c.Image.ID()
+	}
+	if len(c.ExposedPorts) != 0 {
+		cfg.ExposedPorts = map[string]struct{}{}
+		for _, port := range c.ExposedPorts {
+			cfg.ExposedPorts[port] = struct{}{}
+		}
+	}
+	for _, m := range c.Mounts {
+		if m.Type == container.MountTypeVolume && m.Source == "" {
+			cfg.Volumes[m.Destination] = struct{}{}
+		}
+	}
+	return cfg
+}
+
+func dockerHostConfig(c *container.Container) *docker.HostConfig {
+	hc := &docker.HostConfig{
+		NetworkMode:    c.Network,
+		AutoRemove:     c.AutoRemove,
+		CapAdd:         c.CapAdd,
+		CapDrop:        c.CapDrop,
+		SecurityOpt:    c.SecurityOpt,
+		ReadonlyRootfs: c.ReadonlyRootfs,
+		ExtraHosts:     c.ExtraHosts,
+		Sysctls:        c.Sysctls,
+		PidMode:        c.PidMode,
+		IpcMode:        c.IpcMode,
+		UTSMode:        c.UtsMode,
+	}
+	for _, u := range c.Ulimits {
+		hc.Ulimits = append(hc.Ulimits, docker.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+	for _, d := range c.Devices {
+		hc.Devices = append(hc.Devices, docker.DeviceMapping{
+			PathOnHost:        d.PathOnHost,
+			PathInContainer:   d.PathInContainer,
+			CgroupPermissions: d.Permissions,
+		})
+	}
+	for _, m := range c.Mounts {
+		hc.Mounts = append(hc.Mounts, docker.Mount{Type: m.Type, Source: m.Source, Target: m.Destination, ReadOnly: m.ReadOnly})
+	}
+	return hc
+}
+
+func dockerMountPoints(c *container.Container) []docker.MountPoint {
+	ret := []docker.MountPoint{}
+	for _, m := range c.Mounts {
+		mp := docker.MountPoint{Type: m.Type, Source: m.Source, Destination: m.Destination, RW: !m.ReadOnly}
+		if m.Type == container.MountTypeVolume {
+			mp.Name, mp.Source = m.Source, ""
+		}
+		ret = append(ret, mp)
+	}
+	return ret
+}
+
+// dockerCommand is the command of a container, entrypoint first.
+func dockerCommand(c *container.Container) []string {
+	return append(append([]string{}, c.Entrypoint...), c.Cmd...)
+}
+
+func dockerImageID(c *container.Container) string {
+	if c.Image == nil {
+		return ""
+	}
+	return "sha256:" + c.Image.ShaHex
+}
+
+func dockerContainerJSON(c *container.Container) *docker.ContainerJSON {
+	ret := &docker.ContainerJSON{
+		ID:              *c.ContainerID,
+		Created:         c.Created,
+		Image:           dockerImageID(c),
+		Name:            "/" + *c.ContainerID,
+		Driver:          "overlay",
+		Platform:        "linux",
+		HostConfig:      dockerHostConfig(c),
+		Config:          dockerConfig(c),
+		Mounts:          dockerMountPoints(c),
+		NetworkSettings: &docker.NetworkSettings{Networks: map[string]struct{}{}},
+		State:           &docker.ContainerState{Status: container.StatusCreated},
+	}
+	if cmd := dockerCommand(c); len(cmd) != 0 {
+		ret.Path, ret.Args = cmd[0], cmd[1:]
+	}
+	if st := c.State; st != nil {
+		ret.State = &docker.ContainerState{
+			Status:     st.DisplayStatus(),
+			Running:    st.IsRunning(),
+			Paused:     st.IsRunning() && st.Paused,
+			Pid:        st.Pid,
+			ExitCode:   st.ExitCode,
+			StartedAt:  st.StartedAt,
+			FinishedAt: st.FinishedAt,
+		}
+		if h := st.Health; h != nil {
+			ret.State.Health = &docker.Health{Status: h.Status, FailingStreak: h.FailingStreak, Log: []docker.HealthLog{}}
+			for _, l := range h.Log {
+				ret.State.Health.Log = append(ret.State.Health.Log, docker.HealthLog{
+					Start: l.Start, End: l.End, ExitCode: l.ExitCode, Output: l.Output,
+				})
+			}
+		}
+	}
+	return ret
+}
+
+func dockerContainerSummary(c *container.Container) docker.ContainerSummary {
+	ret := docker.ContainerSummary{
+		ID:      *c.ContainerID,
+		Names:   []string{"/" + *c.ContainerID},
+		ImageID: dockerImageID(c),
+		Command: strings.Join(dockerCommand(c), " "),
+		Created: c.Created.Unix(),
+		State:   container.StatusCreated,
+		Status:  "Created",
+		Ports:   []struct{}{},
+		Labels:  c.Labels,
+		Mounts:  dockerMountPoints(c),
+	}
+	if c.Image != nil {
+		ret.Image = c.Image.ID()
+	}
+	ret.HostConfig.NetworkMode = c.Network
+	if st := c.State; st != nil {
+		ret.State = st.DisplayStatus()
+		switch st.Status {
+		case container.StatusRunning:
+			ret.Status = "Up " + humanDuration(time.Since(st.StartedAt))
+			switch {
+			case st.Paused:
+				ret.Status += " (Paused)"
+			case st.Health == nil:
+			case st.Health.Status == container.HealthStarting:
+				ret.Status += " (health: starting)"
+			default:
+				ret.Status += " (" + st.Health.Status + ")"
+			}
+		case container.StatusExited:
+			ret.Status = fmt.Sprintf("Exited (%d) %s ago", st.ExitCode, humanDuration(time.Since(st.FinishedAt)))
+		}
+	}
+	return ret
+}
+
+// humanDuration formats d the way docker ps does.
+func humanDuration(d time.Duration) string {
+	switch seconds := int(d.Seconds()); {
+	case seconds < 1:
+		return "Less than a second"
+	case seconds == 1:
+		return "1 second"
+	case seconds < 60:
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	switch minutes := int(d.Minutes()); {
+	case minutes == 1:
+		return "About a minute"
+	case minutes < 60:
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	switch hours := int(d.Hours() + 0.5); {
+	case hours == 1:
+		return "About an hour"
+	case hours < 48:
+		return fmt.Sprintf("%d hours", hours)
+	default:
+		return fmt.Sprintf("%d days", hours/24)
+	}
+}
@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/exfly/container/api/docker"
+	"github.com/exfly/container/image"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) dockerListImages(rt *route) {
+	images, err := s.imgSrv.List()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	ret := []docker.ImageSummary{}
+	for _, img := range images {
+		ret = append(ret, docker.ImageSummary{
+			ID:          "sha256:" + img.ShaHex,
+			RepoTags:    []string{img.ID()},
+			RepoDigests: []string{},
+			SharedSize:  -1,
+			Containers:  -1,
+		})
+	}
+	writeJSON(rt.w, http.StatusOK, ret)
+}
+
+// dockerPullImage pulls fromImage, reporting progress as a stream of JSON
+// messages.
+func (s *Server) dockerPullImage(rt *route) {
+	query := rt.r.URL.Query()
+	if query.Get("fromSrc") != "" {
+		writeError(rt.w, badRequest(errors.New("importing images is not supported")))
+		return
+	}
+	name := query.Get("fromImage")
+	if name == "" {
+		writeError(rt.w, badRequest(errors.New("no image given")))
+		return
+	}
+	if tag := query.Get("tag"); tag != "" {
+		sep := ":"
+		if strings.Contains(tag, ":") {
+			// A digest.
+			sep = "@"
+		}
+		name += sep + tag
+	}
+	img, err := image.NewImage(name)
+	if err != nil {
+		writeError(rt.w, badRequest(err))
+		return
+	}
+	_, err = s.imgSrv.Get(img)
+	present := err == nil
+
+	rt.w.Header().Set("Content-Type", "application/json")
+	rt.w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(rt.w)
+	flush := func() {}
+	if f, ok := rt.w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+	write := func(msg docker.JSONMessage) {
+		if err := enc.Encode(msg); err != nil {
+			log.WithError(err).Debug("write pull progress")
+		}
+		flush()
+	}
+	write(docker.JSONMessage{Status: "Pulling from " + img.Path(), ID: img.Tag})
+	pulled, err := s.imgSrv.GetOrPull(rt.r.Context(), img)
+	if err != nil {
+		err = errors.Wrapf(err, "pull %s", name)
+		write(docker.JSONMessage{Error: &docker.JSONError{Message: err.Error()}, ErrorMessage: err.Error()})
+		return
+	}
+	write(docker.JSONMessage{Status: "Digest: sha256:" + pulled.ShaHex})
+	if present {
+		write(docker.JSONMessage{Status: "Status: Image is up to date for " + pulled.ID()})
+	} else {
+		write(docker.JSONMessage{Status: "Status: Downloaded newer image for " + pulled.ID()})
+	}
+}
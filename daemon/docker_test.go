@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/exfly/container/api/docker"
+	"github.com/exfly/container/container"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerFromDocker(t *testing.T) {
+	req := &docker.ContainerCreateRequest{
+		Config: docker.Config{
+			Image:      "busybox",
+			Cmd:        []string{"sh"},
+			Entrypoint: []string{""},
+			Volumes:    map[string]struct{}{"/data": {}},
+			OpenStdin:  true,
+		},
+		HostConfig: &docker.HostConfig{
+			Binds:       []string{"/src:/dst:ro"},
+			NetworkMode: "default",
+			AutoRemove:  true,
+			Ulimits:     []docker.Ulimit{{Name: "nofile", Soft: 100, Hard: 200}},
+		},
+	}
+	c, warnings, err := containerFromDocker(req)
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io/library/busybox:latest", c.Image.ID())
+	assert.Equal(t, []string{}, c.Entrypoint)
+	assert.Equal(t, []string{"sh"}, c.Cmd)
+	assert.Equal(t, "", c.Network)
+	assert.True(t, c.AutoRemove)
+	assert.Equal(t, []container.Mount{
+		{Type: container.MountTypeVolume, Destination: "/data"},
+		{Type: container.MountTypeBind, Source: "/src", Destination: "/dst", ReadOnly: true},
+	}, c.Mounts)
+	assert.Equal(t, []container.Ulimit{{Name: "nofile", Soft: 100, Hard: 200}}, c.Ulimits)
+	assert.Len(t, warnings, 1)
+
+	req.HostConfig.NetworkMode = "bridge"
+	_, _, err = containerFromDocker(req)
+	assert.EqualError(t, err, "bridge networking is not supported, use host or none")
+	req.HostConfig.NetworkMode = "mynet"
+	_, _, err = containerFromDocker(req)
+	assert.Error(t, err)
+	req.HostConfig.NetworkMode = ""
+	req.Tty = true
+	_, _, err = containerFromDocker(req)
+	assert.Error(t, err)
+}
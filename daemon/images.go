@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/image"
+
+	"github.com/pkg/errors"
+)
+
+func (s *Server) listImages(rt *route) {
+	images, err := s.imgSrv.List()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if images == nil {
+		images = []*image.Image{}
+	}
+	writeJSON(rt.w, http.StatusOK, images)
+}
+
+func (s *Server) pullImage(rt *route) {
+	var req api.PullRequest
+	if err := readJSON(rt.r, &req); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if req.Image == "" {
+		writeError(rt.w, badRequest(errors.New("no image given")))
+		return
+	}
+	img, err := image.NewImage(req.Image)
+	if err != nil {
+		writeError(rt.w, badRequest(err))
+		return
+	}
+	pulled, err := s.imgSrv.GetOrPull(rt.r.Context(), img)
+	if err != nil {
+		writeError(rt.w, errors.Wrapf(err, "pull %s", req.Image))
+		return
+	}
+	writeJSON(rt.w, http.StatusOK, pulled)
+}
+
+func (s *Server) inspectImage(rt *route) {
+	img, err := s.localImage(rt.path[1])
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	metadata, err := s.imgSrv.GetImageMetadata(img)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusOK, api.ImageInspect{Image: img, Config: metadata.Config})
+}
+
+func (s *Server) removeImage(rt *route) {
+	img, err := image.NewImage(rt.path[1])
+	if err != nil {
+		writeError(rt.w, badRequest(err))
+		return
+	}
+	err = s.imgSrv.Remove(img, s.containerSrv.IsImageInUse)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) localImage(name string) (*image.Image, error) {
+	img, err := image.NewImage(name)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	local, err := s.imgSrv.Get(img)
+	return local, errors.Wrapf(err, "no such image %s", name)
+}
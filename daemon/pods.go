@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/container"
+)
+
+func (s *Server) listPods(rt *route) {
+	pods, err := s.podSrv.List()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	ret := []*api.PodSummary{}
+	for _, p := range pods {
+		members, err := s.podSrv.Members(p.Name)
+		if err != nil {
+			writeError(rt.w, err)
+			return
+		}
+		ret = append(ret, &api.PodSummary{Pod: p, Status: s.podSrv.Status(p), Containers: len(members)})
+	}
+	writeJSON(rt.w, http.StatusOK, ret)
+}
+
+func (s *Server) createPod(rt *route) {
+	var req api.PodCreateRequest
+	if err := readJSON(rt.r, &req); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	p, err := s.podSrv.Create(req.Name, req.Labels)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusCreated, p)
+}
+
+func (s *Server) startPod(rt *route) {
+	if _, err := s.podSrv.Start(s.ctx, rt.path[1]); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) stopPod(rt *route) {
+	timeout := container.DefaultStopTimeout
+	if t := rt.r.URL.Query().Get("t"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			writeError(rt.w, badRequest(err))
+			return
+		}
+	}
+	if err := s.podSrv.Stop(rt.path[1], timeout); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removePod(rt *route) {
+	if err := s.podSrv.Remove(s.ctx, rt.path[1], boolQuery(rt.r, "force")); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,241 @@
+// Package daemon serves the API of package api over a unix socket, along
+// with a subset of the Docker Engine API. The daemon runs the containers and
+// owns their state.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/container"
+	"github.com/exfly/container/image"
+	"github.com/exfly/container/pod"
+	"github.com/exfly/container/volume"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func NewServer(ctx context.Context, imgSrv *image.ImageService, containerSrv *container.ContainerService, podSrv *pod.PodService, volSrv *volume.VolumeService) *Server {
+	return &Server{
+		ctx:          ctx,
+		imgSrv:       imgSrv,
+		containerSrv: containerSrv,
+		podSrv:       podSrv,
+		volSrv:       volSrv,
+	}
+}
+
+type Server struct {
+	// ctx outlives requests, containers started by the daemon use it.
+	ctx          context.Context
+	imgSrv       *image.ImageService
+	containerSrv *container.ContainerService
+	podSrv       *pod.PodService
+	volSrv       *volume.VolumeService
+}
+
+// Listen listens on the unix socket at path, replacing a stale one.
+func Listen(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve serves the API on ln until ctx is done.
+func (s *Server) Serve(ln net.Listener) error {
+	srv := &http.Server{Handler: s}
+	go func() {
+		<-s.ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// route is a request split into its path segments after the version.
+type route struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	method string
+	path   []string
+}
+
+// match reports whether the route is method followed by pattern, where
+// segments in braces match anything.
+func (rt *route) match(method string, pattern ...string) bool {
+	if rt.method != method || len(rt.path) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if !strings.HasPrefix(p, "{") && rt.path[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.WithField("method", r.Method).WithField("path", r.URL.Path).Debug("api request")
+	var path []string
+	for _, segment := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			writeError(w, badRequest(err))
+			return
+		}
+		path = append(path, unescaped)
+	}
+	if len(path) > 0 && path[0] == api.Version {
+		s.serveAPI(&route{w: w, r: r, method: r.Method, path: path[1:]})
+		return
+	}
+	// Anything else is the docker API, whose paths may start with a
+	// version.
+	if len(path) > 0 && dockerVersionPrefix.MatchString(path[0]) {
+		path = path[1:]
+	}
+	s.serveDocker(&route{w: w, r: r, method: r.Method, path: path})
+}
+
+func (s *Server) serveAPI(rt *route) {
+	switch {
+	case rt.match(http.MethodGet, "_ping"):
+		rt.w.Write([]byte("OK"))
+	case rt.match(http.MethodGet, "version"):
+		writeJSON(rt.w, http.StatusOK, api.VersionResponse{APIVersion: api.Version})
+	case rt.match(http.MethodGet, "images"):
+		s.listImages(rt)
+	case rt.match(http.MethodPost, "images"):
+		s.pullImage(rt)
+	case rt.match(http.MethodGet, "images", "{name}"):
+		s.inspectImage(rt)
+	case rt.match(http.MethodDelete, "images", "{name}"):
+		s.removeImage(rt)
+	case rt.match(http.MethodGet, "containers"):
+		s.listContainers(rt)
+	case rt.match(http.MethodPost, "containers"):
+		s.createContainer(rt)
+	case rt.match(http.MethodGet, "containers", "{id}"):
+		s.inspectContainer(rt)
+	case rt.match(http.MethodDelete, "containers", "{id}"):
+		s.removeContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "start"):
+		s.startContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "stop"):
+		s.stopContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "kill"):
+		s.killContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "wait"):
+		s.waitContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "pause"):
+		s.pauseContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "unpause"):
+		s.unpauseContainer(rt)
+	case rt.match(http.MethodGet, "containers", "{id}", "logs"):
+		s.containerLogs(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "exec"):
+		s.execContainer(rt)
+	case rt.match(http.MethodPost, "containers", "{id}", "attach"):
+		s.attachContainer(rt)
+	case rt.match(http.MethodGet, "pods"):
+		s.listPods(rt)
+	case rt.match(http.MethodPost, "pods"):
+		s.createPod(rt)
+	case rt.match(http.MethodPost, "pods", "{name}", "start"):
+		s.startPod(rt)
+	case rt.match(http.MethodPost, "pods", "{name}", "stop"):
+		s.stopPod(rt)
+	case rt.match(http.MethodDelete, "pods", "{name}"):
+		s.removePod(rt)
+	case rt.match(http.MethodGet, "volumes"):
+		s.listVolumes(rt)
+	case rt.match(http.MethodPost, "volumes"):
+		s.createVolume(rt)
+	case rt.match(http.MethodPost, "volumes", "prune"):
+		s.pruneVolumes(rt)
+	case rt.match(http.MethodGet, "volumes", "{name}"):
+		s.inspectVolume(rt)
+	case rt.match(http.MethodDelete, "volumes", "{name}"):
+		s.removeVolume(rt)
+	default:
+		writeError(rt.w, errNotFound)
+	}
+}
+
+var errNotFound = errors.New("page not found")
+
+// badRequestError is an error in the request itself.
+type badRequestError struct{ error }
+
+func badRequest(err error) error {
+	return badRequestError{err}
+}
+
+func statusCode(err error) int {
+	cause := errors.Cause(err)
+	switch {
+	case cause == errNotFound, container.IsContainerNotExists(err), image.IsHashImgNotExists(err),
+		pod.IsPodNotExists(err), volume.IsVolumeNotExists(err):
+		return http.StatusNotFound
+	case cause == container.ErrRunning, cause == container.ErrNotRunning, cause == image.ErrInUse,
+		cause == container.ErrPaused, cause == container.ErrNotPaused, cause == pod.ErrExists,
+		cause == volume.ErrInUse:
+		return http.StatusConflict
+	case cause == pod.ErrInvalidName, cause == volume.ErrInvalidName:
+		return http.StatusBadRequest
+	}
+	if _, ok := cause.(badRequestError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := statusCode(err)
+	if code == http.StatusInternalServerError {
+		log.WithError(err).Error("api request failed")
+	}
+	writeJSON(w, code, api.ErrorResponse{Message: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Debug("write response")
+	}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest(errors.Wrap(err, "decode request"))
+	}
+	return nil
+}
+
+// boolQuery reports whether the query parameter key is set to a true value.
+func boolQuery(r *http.Request, key string) bool {
+	switch r.URL.Query().Get(key) {
+	case "1", "true", "True":
+		return true
+	}
+	return false
+}
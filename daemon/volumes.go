@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/exfly/container/api"
+	"github.com/exfly/container/volume"
+)
+
+func (s *Server) listVolumes(rt *route) {
+	vols, err := s.volSrv.List()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if vols == nil {
+		vols = []*volume.Volume{}
+	}
+	writeJSON(rt.w, http.StatusOK, vols)
+}
+
+func (s *Server) createVolume(rt *route) {
+	var req api.VolumeCreateRequest
+	if err := readJSON(rt.r, &req); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	vol, err := s.volSrv.Create(req.Name, req.Labels)
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusCreated, vol)
+}
+
+func (s *Server) inspectVolume(rt *route) {
+	vol, err := s.volSrv.Inspect(rt.path[1])
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	writeJSON(rt.w, http.StatusOK, vol)
+}
+
+func (s *Server) removeVolume(rt *route) {
+	if err := s.containerSrv.RemoveVolume(rt.path[1]); err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	rt.w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) pruneVolumes(rt *route) {
+	removed, err := s.containerSrv.PruneVolumes()
+	if err != nil {
+		writeError(rt.w, err)
+		return
+	}
+	if removed == nil {
+		removed = []string{}
+	}
+	writeJSON(rt.w, http.StatusOK, api.VolumePruneResponse{VolumesDeleted: removed})
+}
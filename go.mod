@@ -5,8 +5,13 @@ go 1.14
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/google/go-containerregistry v0.1.1
+	github.com/opencontainers/runtime-spec v1.1.0
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/sys v0.0.0-20200523222454-059865788121
+	google.golang.org/grpc v1.29.1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
+	k8s.io/cri-api v0.18.6
 )
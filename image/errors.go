@@ -7,8 +7,9 @@ import (
 var (
 	ErrNotExists error = errors.New("hash img not exists")
 	ErrImgNotInit error = errors.New("img not init")
+	ErrInUse      error = errors.New("image is in use by a container")
 )
 
 func IsHashImgNotExists(err error) bool {
-	return err == ErrNotExists
+	return errors.Cause(err) == ErrNotExists
 }
@@ -2,17 +2,25 @@ package image
 
 import "strings"
 
+// NewImage parses an image reference, see parseReference.
 func NewImage(s string) (*Image, error) {
-	img, tag := ImageNameAndTag(s)
+	img, tag, digest, err := parseReference(s)
+	if err != nil {
+		return nil, err
+	}
 	return &Image{
-		Img: img,
-		Tag: tag,
+		Img:    img,
+		Tag:    tag,
+		Digest: digest,
 	}, nil
 }
 
+// Image is a reference to an image: Img is its fully qualified repository
+// name, with a tag, a digest or both.
 type Image struct {
 	Img    string `json:"img,omitempty"`
 	Tag    string `json:"tag,omitempty"`
+	Digest string `json:"digest,omitempty"`
 	ShaHex string `json:"sha_hex,omitempty"`
 }
 
@@ -20,10 +28,32 @@ func (i Image) IsInit() bool {
 	return i.ShaHex != ""
 }
 
+// ID is the canonical reference of the image, repository:tag@digest
+// without what it doesn't have.
 func (i Image) ID() string {
-	return strings.Join([]string{i.Img, i.Tag}, ":")
+	id := i.Img
+	if i.Tag != "" {
+		id += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		id += "@" + i.Digest
+	}
+	return id
+}
+
+// Domain is the registry of the image, with its port.
+func (i Image) Domain() string {
+	if n := strings.Index(i.Img, "/"); n >= 0 {
+		return i.Img[:n]
+	}
+	return defaultDomain
+}
+
+// Path is the repository name of the image within its registry.
+func (i Image) Path() string {
+	return strings.TrimPrefix(i.Img, i.Domain()+"/")
 }
 
 func (i Image) String() string {
-	return strings.Join([]string{i.Img, i.Tag, i.ShaHex}, ":")
+	return strings.Join([]string{i.ID(), i.ShaHex}, ":")
 }
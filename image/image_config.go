@@ -1,13 +1,36 @@
 package image
 
-import "github.com/exfly/container/config"
-
-type imageMetadataDetails struct {
-	Env []string `json:"Env"`
-	Cmd []string `json:"Cmd"`
-}
-type imageMetadata struct {
-	Config imageMetadataDetails `json:"config"`
+import (
+	"time"
+
+	"github.com/exfly/container/config"
+)
+
+// HealthConfig is the Healthcheck section of an image config. Zero values
+// mean "inherit", as in docker.
+type HealthConfig struct {
+	Test        []string      `json:"Test,omitempty"`
+	Interval    time.Duration `json:"Interval,omitempty"`
+	Timeout     time.Duration `json:"Timeout,omitempty"`
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+	Retries     int           `json:"Retries,omitempty"`
+}
+
+// ImageMetadataDetails is the config section of an OCI image config.
+type ImageMetadataDetails struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd"`
+	Healthcheck  *HealthConfig       `json:"Healthcheck,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+type ImageMetadata struct {
+	Config ImageMetadataDetails `json:"config"`
 }
 
 func NewImageConfig(ch *config.Home) *ImageConfig {
@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"sync"
 
 	"github.com/exfly/container/config"
 	"github.com/exfly/container/pkg/compress"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -27,6 +32,9 @@ func NewImageService(configHome *config.Home) (*ImageService, error) {
 }
 
 type ImageService struct {
+	// mu serializes changes to the image store.
+	mu sync.Mutex
+
 	configHome *config.Home
 	imgConfig  *ImageConfig
 	imageStore *ImageStore
@@ -91,11 +99,8 @@ func (s *ImageService) processLayerTarballs(imageShaHex string, fullImageHex str
 
 	mani := manifest{}
 	parseManifest(pathManifest, &mani)
-	if len(mani) == 0 || len(mani[0].Layers) == 0 {
-		log.Fatal("Could not find any layers.")
-	}
-	if len(mani) > 1 {
-		log.Fatal("I don't know how to handle more than one manifest.")
+	if err := mani.IsValid(); err != nil {
+		return err
 	}
 
 	imagesDir := s.configHome.ImagesPath() + "/" + imageShaHex
@@ -111,7 +116,7 @@ func (s *ImageService) processLayerTarballs(imageShaHex string, fullImageHex str
 		}
 		srcLayer := tmpPathDir + "/" + layer
 		if err := compress.Untar(srcLayer, imageLayerDir); err != nil {
-			log.Fatalf("Unable to untar layer file: %s: %v\n", srcLayer, err)
+			return errors.Wrapf(err, "Unable to untar layer file: %s", srcLayer)
 		}
 	}
 	/* Copy the manifest file for reference later */
@@ -131,7 +136,7 @@ func (s *ImageService) deleteTempImageFiles(imageShaHash string) error {
 	return errors.Wrapf(os.RemoveAll(tmpPath), "Unable to remove temporary image files: %v", tmpPath)
 }
 
-func (s *ImageService) GetImageMetadata(img *Image) (ret imageMetadata, err error) {
+func (s *ImageService) GetImageMetadata(img *Image) (ret ImageMetadata, err error) {
 	content, err := ioutil.ReadFile(s.imgConfig.GetConfigPathForImage(img.ShaHex))
 	if err != nil {
 		return
@@ -140,10 +145,31 @@ func (s *ImageService) GetImageMetadata(img *Image) (ret imageMetadata, err erro
 	return
 }
 
+// pull fetches img from its registry, with the digest the registry has for
+// what img refers to: for a multi-arch image that of its index, not that of
+// the manifest of our platform.
+func pull(img *Image) (v1.Image, string, error) {
+	ref, err := name.ParseReference(img.ID())
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "parse reference %s", img.ID())
+	}
+	desc, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, "", err
+	}
+	rawImg, err := desc.Image()
+	if err != nil {
+		return nil, "", err
+	}
+	return rawImg, desc.Digest.String(), nil
+}
+
 func (s *ImageService) GetOrPull(ctx context.Context, img *Image) (*Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if !s.imageStore.IsExistByTag(img) {
 		// pull
-		rawImg, err := crane.Pull(img.ID())
+		rawImg, digest, err := pull(img)
 		if err != nil {
 			return nil, err
 		}
@@ -162,7 +188,7 @@ func (s *ImageService) GetOrPull(ctx context.Context, img *Image) (*Image, error
 		retImg.ShaHex = imageShaHex
 		if isExists {
 			log.Infof("The image you requested %v is the same as %v\n", img, sameHashImg)
-			err = s.imageStore.StoreImgMetadata(&retImg)
+			err = s.imageStore.StoreImgMetadata(&retImg, digest)
 			if err != nil {
 				return nil, err
 			}
@@ -179,7 +205,9 @@ func (s *ImageService) GetOrPull(ctx context.Context, img *Image) (*Image, error
 				log.WithError(err).Error("processLayerTarballs error")
 				return nil, err
 			}
-			err = s.imageStore.StoreImgMetadata(&retImg)
+			if err = s.imageStore.StoreImgMetadata(&retImg, digest); err != nil {
+				return nil, err
+			}
 			if err = s.deleteTempImageFiles(imageShaHex); err != nil {
 				return nil, err
 			}
@@ -194,3 +222,43 @@ func (s *ImageService) GetOrPull(ctx context.Context, img *Image) (*Image, error
 	}
 	return retImg, nil
 }
+
+// Get returns the local image img refers to.
+func (s *ImageService) Get(img *Image) (*Image, error) {
+	return s.imageStore.GetImage(img)
+}
+
+// List returns the local images, sorted by name.
+func (s *ImageService) List() ([]*Image, error) {
+	db, err := s.imageStore.ParseImagesMetadata()
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Image
+	for key, entry := range *db {
+		ret = append(ret, entry.image(keyName(key)))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID() < ret[j].ID() })
+	return ret, nil
+}
+
+// Remove removes a local image, and its layers unless another name refers
+// to them. Images inUse are kept.
+func (s *ImageService) Remove(img *Image, inUse func(*Image) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	local, err := s.imageStore.GetImage(img)
+	if err != nil {
+		return errors.Wrapf(err, "%s", img.ID())
+	}
+	if inUse(local) {
+		return errors.Wrapf(ErrInUse, "%s", img.ID())
+	}
+	if err := s.imageStore.RemoveImage(local); err != nil {
+		return err
+	}
+	if _, shared, err := s.imageStore.GetImageByHash(local.ShaHex); err != nil || shared {
+		return err
+	}
+	return errors.Wrapf(os.RemoveAll(s.imgConfig.GetBasePathForImage(local.ShaHex)), "remove image %s", img.ID())
+}
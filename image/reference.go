@@ -0,0 +1,90 @@
+package image
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultDomain = "docker.io"
+	// legacyDefaultDomain is what docker.io images used to be referred to
+	// with.
+	legacyDefaultDomain = "index.docker.io"
+	officialRepoPrefix  = "library/"
+	defaultTag          = "latest"
+)
+
+// The grammar of github.com/docker/distribution/reference, which docker
+// and registries follow.
+var (
+	domainRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])` +
+		`(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// parseReference splits an image reference,
+// [registry[:port]/]repository[:tag][@digest], into its fully qualified
+// repository name, tag and digest. Images on docker.io are normalized the
+// way docker does, busybox is docker.io/library/busybox. The tag is latest
+// if there is neither a tag nor a digest.
+func parseReference(ref string) (name, tag, digest string, err error) {
+	name = ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+		if !digestRegexp.MatchString(digest) {
+			return "", "", "", errors.Errorf("invalid reference %q: invalid digest %q", ref, digest)
+		}
+	}
+	// A colon after the last slash starts the tag, before it is a port.
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+		if !tagRegexp.MatchString(tag) {
+			return "", "", "", errors.Errorf("invalid reference %q: invalid tag %q", ref, tag)
+		}
+	}
+	if name, err = normalizeName(name); err != nil {
+		return "", "", "", errors.Wrapf(err, "invalid reference %q", ref)
+	}
+	if tag == "" && digest == "" {
+		tag = defaultTag
+	}
+	return name, tag, digest, nil
+}
+
+// normalizeName qualifies a repository name with its registry.
+func normalizeName(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty repository name")
+	}
+	domain, path := defaultDomain, name
+	// The first component is a registry if it can't be part of a
+	// repository name.
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first {
+			domain, path = first, name[i+1:]
+		}
+	}
+	if !domainRegexp.MatchString(domain) {
+		return "", errors.Errorf("invalid registry %q", domain)
+	}
+	if domain == legacyDefaultDomain {
+		domain = defaultDomain
+	}
+	if domain == defaultDomain && !strings.Contains(path, "/") {
+		path = officialRepoPrefix + path
+	}
+	for _, component := range strings.Split(path, "/") {
+		if strings.ToLower(component) != component {
+			return "", errors.New("repository name must be lowercase")
+		}
+		if !pathComponentRegexp.MatchString(component) {
+			return "", errors.Errorf("invalid repository name %q", path)
+		}
+	}
+	return domain + "/" + path, nil
+}
@@ -0,0 +1,43 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewImage(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for ref, want := range map[string]Image{
+		"busybox":                          {Img: "docker.io/library/busybox", Tag: "latest"},
+		"busybox:1.32":                     {Img: "docker.io/library/busybox", Tag: "1.32"},
+		"exfly/app":                        {Img: "docker.io/exfly/app", Tag: "latest"},
+		"index.docker.io/busybox":          {Img: "docker.io/library/busybox", Tag: "latest"},
+		"localhost:5000/app:1.0":           {Img: "localhost:5000/app", Tag: "1.0"},
+		"localhost/app":                    {Img: "localhost/app", Tag: "latest"},
+		"registry.corp:8443/team/app":      {Img: "registry.corp:8443/team/app", Tag: "latest"},
+		"gcr.io/distroless/static:nonroot": {Img: "gcr.io/distroless/static", Tag: "nonroot"},
+		"app@" + digest:                    {Img: "docker.io/library/app", Digest: digest},
+		"localhost:5000/app:1.0@" + digest: {Img: "localhost:5000/app", Tag: "1.0", Digest: digest},
+	} {
+		img, err := NewImage(ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, want, *img, ref)
+		// The canonical form parses back to itself.
+		again, err := NewImage(img.ID())
+		require.NoError(t, err, ref)
+		assert.Equal(t, img, again, ref)
+	}
+
+	img, err := NewImage("localhost:5000/team/app:1.0@" + digest)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5000/team/app:1.0@"+digest, img.ID())
+	assert.Equal(t, "localhost:5000", img.Domain())
+	assert.Equal(t, "team/app", img.Path())
+
+	for _, ref := range []string{"", "Busybox", "busybox:", "busybox:-x", "app@sha256:short", "-app", "exfly/App:1"} {
+		_, err := NewImage(ref)
+		assert.Error(t, err, ref)
+	}
+}
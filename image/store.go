@@ -5,18 +5,78 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/exfly/container/config"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// rawImageEntries is an image by the reference it was pulled with: a tag,
+// with the digest the registry had for it, or a digest alone.
 type rawImageEntries struct {
-	Tag  string
-	Hash string
+	Tag    string
+	Digest string `json:",omitempty"`
+	Hash   string
 }
+
+// image is the local image of the entry of repository name.
+func (e rawImageEntries) image(name string) *Image {
+	ret := &Image{Img: name, Tag: e.Tag, ShaHex: e.Hash}
+	if e.Tag == "" {
+		ret.Digest = e.Digest
+	}
+	return ret
+}
+
+// imagesDB maps the keys of images, see storeKey, to their entries.
 type imagesDB map[string]rawImageEntries
 
+// storeKey is the key of img in the images DB: name@digest if it has a
+// digest, name:tag otherwise.
+func storeKey(img *Image) string {
+	if img.Digest != "" {
+		return img.Img + "@" + img.Digest
+	}
+	return img.Img + ":" + img.Tag
+}
+
+// keyName is the repository name of key, "" if key has neither a tag nor a
+// digest, as entries used to be keyed by name alone.
+func keyName(key string) string {
+	if i := strings.Index(key, "@"); i >= 0 {
+		return key[:i]
+	}
+	if i := strings.LastIndex(key, ":"); i > strings.LastIndex(key, "/") {
+		return key[:i]
+	}
+	return ""
+}
+
+// lookup returns the key and entry img refers to. An image referred to by
+// digest is also found under a tag it was pulled with.
+func (idb imagesDB) lookup(img *Image) (string, rawImageEntries, bool) {
+	key := storeKey(img)
+	if entry, exists := idb[key]; exists {
+		return key, entry, true
+	}
+	if img.Digest == "" {
+		return "", rawImageEntries{}, false
+	}
+	keys := make([]string, 0, len(idb))
+	for k := range idb {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if keyName(k) == img.Img && idb[k].Digest == img.Digest {
+			return k, idb[k], true
+		}
+	}
+	return "", rawImageEntries{}, false
+}
+
 func NewImageStore(configHome *config.Home) (*ImageStore, error) {
 	ret := &ImageStore{
 		configHome: configHome,
@@ -40,12 +100,8 @@ func (i *ImageStore) IsExistByTag(img *Image) bool {
 	if err != nil {
 		return false
 	}
-	for imgM, tagEntry := range *db {
-		if imgM == img.Img && tagEntry.Tag == img.Tag {
-			return true
-		}
-	}
-	return false
+	_, _, exists := db.lookup(img)
+	return exists
 }
 
 func (i *ImageStore) GetImage(img *Image) (*Image, error) {
@@ -53,17 +109,17 @@ func (i *ImageStore) GetImage(img *Image) (*Image, error) {
 	if err != nil {
 		return nil, err
 	}
-	for imgM, tagEntry := range *db {
-		if imgM == img.Img && img.Tag == tagEntry.Tag {
-			retImg := Image{
-				Img:    img.Img,
-				Tag:    img.Tag,
-				ShaHex: tagEntry.Hash,
-			}
-			return &retImg, nil
-		}
+	_, entry, exists := db.lookup(img)
+	if !exists {
+		return nil, ErrNotExists
 	}
-	return nil, ErrNotExists
+	retImg := Image{
+		Img:    img.Img,
+		Tag:    img.Tag,
+		Digest: img.Digest,
+		ShaHex: entry.Hash,
+	}
+	return &retImg, nil
 }
 
 func (i *ImageStore) GetImageByHash(shaHex string) (*Image, bool, error) {
@@ -72,14 +128,10 @@ func (i *ImageStore) GetImageByHash(shaHex string) (*Image, bool, error) {
 	if err != nil {
 		return nil, isExists, err
 	}
-	for imgN, entries := range *db {
+	for key, entries := range *db {
 		if entries.Hash == shaHex {
 			isExists = true
-			return &Image{
-				Img:    imgN,
-				Tag:    entries.Tag,
-				ShaHex: entries.Hash,
-			}, isExists, nil
+			return entries.image(keyName(key)), isExists, nil
 		}
 	}
 	return nil, isExists, nil
@@ -90,8 +142,8 @@ func (i *ImageStore) IsExistByHash(img *Image, shaHex string) bool {
 	if err != nil {
 		return false
 	}
-	for imgM, tagEntry := range *db {
-		if imgM == img.Img && shaHex == tagEntry.Hash {
+	for key, tagEntry := range *db {
+		if keyName(key) == img.Img && shaHex == tagEntry.Hash {
 			return true
 		}
 	}
@@ -109,7 +161,7 @@ func (i *ImageStore) MetadataReader() (*os.File, error) {
 }
 
 func (i *ImageStore) MetadataWriter() (*os.File, error) {
-	meta, err := os.OpenFile(i.MetadataPath(), os.O_WRONLY, os.ModeAppend)
+	meta, err := os.OpenFile(i.MetadataPath(), os.O_WRONLY|os.O_TRUNC, os.ModeAppend)
 	return meta, err
 }
 
@@ -132,29 +184,70 @@ func (i *ImageStore) parseImagesMetadata(r io.Reader) (*imagesDB, error) {
 		log.Errorf("Unable to parse images DB: %v\n", err)
 		return nil, err
 	}
+	// Entries used to be keyed by the repository name as given, busybox
+	// rather than docker.io/library/busybox, with one entry per name.
+	for key, entry := range idb {
+		if keyName(key) != "" {
+			continue
+		}
+		delete(idb, key)
+		name, err := normalizeName(key)
+		if err != nil {
+			continue
+		}
+		newKey := storeKey(&Image{Img: name, Tag: entry.Tag})
+		if entry.Tag == "" {
+			newKey = storeKey(&Image{Img: name, Digest: entry.Digest})
+		}
+		if _, exists := idb[newKey]; !exists {
+			idb[newKey] = entry
+		}
+	}
 	return &idb, nil
 }
 
-func (i *ImageStore) StoreImgMetadata(img *Image) error {
+// StoreImgMetadata records img under the reference it was pulled with,
+// digest is the digest of its manifest, or index, in the registry. Pulling
+// by digest leaves the entry of a tag alone.
+func (i *ImageStore) StoreImgMetadata(img *Image, digest string) error {
 	db, err := i.ParseImagesMetadata()
 	if err != nil {
 		return err
 	}
-	rawDB := *db
-	entry := rawImageEntries{}
-	if oldEntry, exists := rawDB[img.Img]; exists {
-		entry = oldEntry
-	}
-	entry.Tag = img.Tag
 	if !img.IsInit() {
 		panic("img not init")
 	}
-	entry.Hash = img.ShaHex
-	rawDB[img.Img] = entry
+	rawDB := *db
+	entry := rawImageEntries{Digest: digest, Hash: img.ShaHex}
+	if img.Digest == "" {
+		entry.Tag = img.Tag
+	}
+	rawDB[storeKey(img)] = entry
+	metaWriter, err := i.MetadataWriter()
+	if err != nil {
+		return err
+	}
+	defer metaWriter.Close()
+	return i.marshalImageMetadata(&rawDB, metaWriter)
+}
+
+// RemoveImage removes the entry of img.
+func (i *ImageStore) RemoveImage(img *Image) error {
+	db, err := i.ParseImagesMetadata()
+	if err != nil {
+		return err
+	}
+	rawDB := *db
+	key, _, exists := rawDB.lookup(img)
+	if !exists {
+		return ErrNotExists
+	}
+	delete(rawDB, key)
 	metaWriter, err := i.MetadataWriter()
 	if err != nil {
 		return err
 	}
+	defer metaWriter.Close()
 	return i.marshalImageMetadata(&rawDB, metaWriter)
 }
 
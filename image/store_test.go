@@ -0,0 +1,52 @@
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/exfly/container/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	home := config.NewHome(dir)
+	require.NoError(t, home.InitDirs())
+	store, err := NewImageStore(home)
+	require.NoError(t, err)
+
+	index := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	other := "sha256:" + "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	require.NoError(t, store.StoreImgMetadata(&Image{Img: "docker.io/library/busybox", Tag: "latest", ShaHex: "aaaaaaaaaaaa"}, index))
+	require.NoError(t, store.StoreImgMetadata(&Image{Img: "docker.io/library/busybox", Digest: other, ShaHex: "bbbbbbbbbbbb"}, other))
+
+	got, err := store.GetImage(&Image{Img: "docker.io/library/busybox", Tag: "latest"})
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaaaaaaaa", got.ShaHex, "a digest pull leaves the tag alone")
+	got, err = store.GetImage(&Image{Img: "docker.io/library/busybox", Digest: other})
+	require.NoError(t, err)
+	assert.Equal(t, "bbbbbbbbbbbb", got.ShaHex)
+	got, err = store.GetImage(&Image{Img: "docker.io/library/busybox", Digest: index})
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaaaaaaaa", got.ShaHex, "the digest the tag was pulled with")
+	_, err = store.GetImage(&Image{Img: "docker.io/library/busybox", Tag: "1.32"})
+	assert.Equal(t, ErrNotExists, err)
+
+	require.NoError(t, store.RemoveImage(&Image{Img: "docker.io/library/busybox", Digest: other}))
+	assert.True(t, store.IsExistByTag(&Image{Img: "docker.io/library/busybox", Tag: "latest"}))
+	assert.False(t, store.IsExistByTag(&Image{Img: "docker.io/library/busybox", Digest: other}))
+}
+
+func TestImageStoreLegacy(t *testing.T) {
+	store := &ImageStore{}
+	db, err := store.parseImagesMetadata(strings.NewReader(`{"busybox":{"Tag":"latest","Hash":"aaaaaaaaaaaa"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, imagesDB{
+		"docker.io/library/busybox:latest": {Tag: "latest", Hash: "aaaaaaaaaaaa"},
+	}, *db)
+}
@@ -5,21 +5,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"strings"
 )
 
-func ImageNameAndTag(src string) (string, string) {
-	s := strings.Split(src, ":")
-	var img, tag string
-	if len(s) > 1 {
-		img, tag = s[0], s[1]
-	} else {
-		img = s[0]
-		tag = "latest"
-	}
-	return img, tag
-}
-
 func parseManifest(manifestPath string, mani *manifest) error {
 	data, err := ioutil.ReadFile(manifestPath)
 	if err != nil {
@@ -0,0 +1,184 @@
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const Root = "/sys/fs/cgroup"
+
+// v1Subsystems are the cgroup v1 hierarchies a container gets a cgroup in,
+// those the host has mounted.
+var v1Subsystems = []string{"devices", "memory", "pids", "cpu", "freezer"}
+
+// IsUnified reports whether the host uses the cgroup v2 unified hierarchy.
+func IsUnified() bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(Root, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+func NewManager(name string) *Manager {
+	return &Manager{
+		name:    name,
+		unified: IsUnified(),
+	}
+}
+
+// Manager owns the cgroup of one container, at <root>/<name> on cgroup v2 and
+// <root>/<subsystem>/<name> on v1.
+type Manager struct {
+	name    string
+	unified bool
+}
+
+func (m *Manager) IsUnified() bool {
+	return m.unified
+}
+
+// Path returns the cgroup directory for subsystem. subsystem is ignored on
+// cgroup v2.
+func (m *Manager) Path(subsystem string) string {
+	if m.unified {
+		return filepath.Join(Root, m.name)
+	}
+	return filepath.Join(Root, subsystem, m.name)
+}
+
+// Subsystems returns the v1 hierarchies the cgroup has a directory in, none
+// on cgroup v2.
+func (m *Manager) Subsystems() []string {
+	if m.unified {
+		return nil
+	}
+	var ret []string
+	for _, sub := range v1Subsystems {
+		if _, err := os.Stat(filepath.Join(Root, sub, "cgroup.procs")); err == nil {
+			ret = append(ret, sub)
+		}
+	}
+	return ret
+}
+
+func (m *Manager) paths() []string {
+	if m.unified {
+		return []string{m.Path("")}
+	}
+	var ret []string
+	for _, sub := range m.Subsystems() {
+		ret = append(ret, m.Path(sub))
+	}
+	return ret
+}
+
+func (m *Manager) Create() error {
+	for _, p := range m.paths() {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return errors.Wrapf(err, "create cgroup %s", p)
+		}
+	}
+	return nil
+}
+
+// Exists reports whether the cgroup was created.
+func (m *Manager) Exists() bool {
+	paths := m.paths()
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return false
+		}
+	}
+	return len(paths) != 0
+}
+
+// Apply moves pid into the cgroup.
+func (m *Manager) Apply(pid int) error {
+	for _, p := range m.paths() {
+		if err := writeFile(p, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyThread moves the thread tid alone into the cgroup, the processes it
+// forks then start in there. Only cgroup v1 has threads in other cgroups
+// than their process. restore moves the thread back where it was.
+func (m *Manager) ApplyThread(tid int) (restore func() error, err error) {
+	if m.unified {
+		return nil, errors.New("threads can't join a cgroup of their own on cgroup v2")
+	}
+	current, err := threadCgroups(tid)
+	if err != nil {
+		return nil, err
+	}
+	var prev []string
+	restore = func() error {
+		for _, p := range prev {
+			if err := writeFile(p, "tasks", strconv.Itoa(tid)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, sub := range m.Subsystems() {
+		path, ok := current[sub]
+		if !ok {
+			continue
+		}
+		if err := writeFile(m.Path(sub), "tasks", strconv.Itoa(tid)); err != nil {
+			restore()
+			return nil, err
+		}
+		prev = append(prev, filepath.Join(Root, sub, path))
+	}
+	return restore, nil
+}
+
+// threadCgroups returns the v1 cgroups of thread tid by subsystem.
+func threadCgroups(tid int) (map[string]string, error) {
+	path := fmt.Sprintf("/proc/self/task/%d/cgroup", tid)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	ret := map[string]string{}
+	// hierarchy-ID:controller-list:cgroup-path
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, sub := range strings.Split(fields[1], ",") {
+			ret[sub] = fields[2]
+		}
+	}
+	return ret, nil
+}
+
+// Destroy removes the cgroup. It fails while processes are still in it.
+func (m *Manager) Destroy() error {
+	for _, p := range m.paths() {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "remove cgroup %s", p)
+		}
+	}
+	return nil
+}
+
+func writeFile(dir, file, data string) error {
+	path := filepath.Join(dir, file)
+	if err := ioutil.WriteFile(path, []byte(data), 0); err != nil {
+		return errors.Wrapf(err, "write %q to %s", data, path)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package cgroups
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const Wildcard = -1
+
+// DeviceRule allows access to a device, or a class of devices, in the form
+// the v1 devices controller understands: "c 1:3 rwm".
+type DeviceRule struct {
+	// Type is 'a' (all), 'c' (char) or 'b' (block).
+	Type  rune
+	Major int64
+	Minor int64
+	// Access is a combination of r(ead), w(rite) and m(knod).
+	Access string
+}
+
+func (r DeviceRule) String() string {
+	if r.Type == 'a' {
+		return "a"
+	}
+	return fmt.Sprintf("%c %s:%s %s", r.Type, devNum(r.Major), devNum(r.Minor), r.Access)
+}
+
+func devNum(n int64) string {
+	if n == Wildcard {
+		return "*"
+	}
+	return fmt.Sprint(n)
+}
+
+func (r DeviceRule) validate() error {
+	switch r.Type {
+	case 'a', 'b', 'c':
+	default:
+		return errors.Errorf("invalid device type %q", r.Type)
+	}
+	if r.Access == "" || strings.Trim(r.Access, "rwm") != "" {
+		return errors.Errorf("invalid device access %q", r.Access)
+	}
+	return nil
+}
+
+// SetDevices denies access to every device except those allowed by rules.
+func (m *Manager) SetDevices(rules []DeviceRule) error {
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	if m.unified {
+		return setDevicesBPF(m.Path(""), rules)
+	}
+	dir := m.Path("devices")
+	if err := writeFile(dir, "devices.deny", "a"); err != nil {
+		return err
+	}
+	for _, r := range rules {
+		if err := writeFile(dir, "devices.allow", r.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package cgroups
+
+import (
+	"encoding/binary"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// cgroup v2 has no devices controller, device access is decided by an eBPF
+// program of type BPF_PROG_TYPE_CGROUP_DEVICE attached to the cgroup. The
+// program sees a struct bpf_cgroup_dev_ctx { u32 access_type; u32 major;
+// u32 minor; } where access_type is (access << 16) | type.
+
+const (
+	bpfDevcgDevBlock = 1
+	bpfDevcgDevChar  = 2
+
+	bpfDevcgAccMknod = 1
+	bpfDevcgAccRead  = 2
+	bpfDevcgAccWrite = 4
+
+	// instruction classes and fields, see include/uapi/linux/bpf.h
+	bpfLdxMemW   = 0x61
+	bpfAlu64And  = 0x57
+	bpfAlu64Rsh  = 0x77
+	bpfAlu64Mov  = 0xb7
+	bpfAlu64MovX = 0xbf
+	bpfJneK      = 0x55
+	bpfJneX      = 0x5d
+	bpfExit      = 0x95
+)
+
+type bpfInsn struct {
+	code byte
+	dst  byte
+	src  byte
+	off  int16
+	imm  int32
+}
+
+func (i bpfInsn) encode(b []byte) {
+	b[0] = i.code
+	b[1] = i.dst | i.src<<4
+	binary.LittleEndian.PutUint16(b[2:], uint16(i.off))
+	binary.LittleEndian.PutUint32(b[4:], uint32(i.imm))
+}
+
+// deviceFilterProgram compiles an allow list into eBPF. Anything not matched
+// by a rule is denied.
+func deviceFilterProgram(rules []DeviceRule) []bpfInsn {
+	prog := []bpfInsn{
+		// r2 = type, r3 = access, r4 = major, r5 = minor
+		{code: bpfLdxMemW, dst: 2, src: 1, off: 0},
+		{code: bpfAlu64And, dst: 2, imm: 0xffff},
+		{code: bpfLdxMemW, dst: 3, src: 1, off: 0},
+		{code: bpfAlu64Rsh, dst: 3, imm: 16},
+		{code: bpfLdxMemW, dst: 4, src: 1, off: 4},
+		{code: bpfLdxMemW, dst: 5, src: 1, off: 8},
+	}
+	for _, r := range rules {
+		var block []bpfInsn
+		// Each check jumps to the end of the block on mismatch; offsets are
+		// patched once the block length is known.
+		var jumps []int
+		if r.Type != 'a' {
+			typ := int32(bpfDevcgDevChar)
+			if r.Type == 'b' {
+				typ = bpfDevcgDevBlock
+			}
+			jumps = append(jumps, len(block))
+			block = append(block, bpfInsn{code: bpfJneK, dst: 2, imm: typ})
+		}
+		if access := bpfAccess(r.Access); access != bpfDevcgAccMknod|bpfDevcgAccRead|bpfDevcgAccWrite {
+			// The requested access must be a subset of the allowed one.
+			block = append(block,
+				bpfInsn{code: bpfAlu64MovX, dst: 1, src: 3},
+				bpfInsn{code: bpfAlu64And, dst: 1, imm: access},
+			)
+			jumps = append(jumps, len(block))
+			block = append(block, bpfInsn{code: bpfJneX, dst: 1, src: 3})
+		}
+		if r.Type != 'a' && r.Major != Wildcard {
+			jumps = append(jumps, len(block))
+			block = append(block, bpfInsn{code: bpfJneK, dst: 4, imm: int32(r.Major)})
+		}
+		if r.Type != 'a' && r.Minor != Wildcard {
+			jumps = append(jumps, len(block))
+			block = append(block, bpfInsn{code: bpfJneK, dst: 5, imm: int32(r.Minor)})
+		}
+		block = append(block,
+			bpfInsn{code: bpfAlu64Mov, dst: 0, imm: 1},
+			bpfInsn{code: bpfExit},
+		)
+		for _, j := range jumps {
+			block[j].off = int16(len(block) - j - 1)
+		}
+		prog = append(prog, block...)
+	}
+	return append(prog,
+		bpfInsn{code: bpfAlu64Mov, dst: 0, imm: 0},
+		bpfInsn{code: bpfExit},
+	)
+}
+
+func bpfAccess(access string) int32 {
+	var ret int32
+	if strings.ContainsRune(access, 'm') {
+		ret |= bpfDevcgAccMknod
+	}
+	if strings.ContainsRune(access, 'r') {
+		ret |= bpfDevcgAccRead
+	}
+	if strings.ContainsRune(access, 'w') {
+		ret |= bpfDevcgAccWrite
+	}
+	return ret
+}
+
+// setDevicesBPF loads the device filter for rules and attaches it to the
+// cgroup directory dir.
+func setDevicesBPF(dir string, rules []DeviceRule) error {
+	insns := deviceFilterProgram(rules)
+	code := make([]byte, 8*len(insns))
+	for i, insn := range insns {
+		insn.encode(code[8*i:])
+	}
+	license := []byte("Apache\x00")
+	logBuf := make([]byte, 4096)
+
+	loadAttr := struct {
+		progType    uint32
+		insnCnt     uint32
+		insns       uint64
+		license     uint64
+		logLevel    uint32
+		logSize     uint32
+		logBuf      uint64
+		kernVersion uint32
+		progFlags   uint32
+	}{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel: 1,
+		logSize:  uint32(len(logBuf)),
+		logBuf:   uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+	}
+	progFd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&loadAttr)), unsafe.Sizeof(loadAttr))
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(license)
+	runtime.KeepAlive(logBuf)
+	if errno != 0 {
+		return errors.Wrapf(errno, "load device filter: %s", strings.TrimRight(string(logBuf), "\x00"))
+	}
+	defer unix.Close(int(progFd))
+
+	cgroupFd, err := unix.Open(dir, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "open cgroup %s", dir)
+	}
+	defer unix.Close(cgroupFd)
+
+	attachAttr := struct {
+		targetFd    uint32
+		attachBpfFd uint32
+		attachType  uint32
+		attachFlags uint32
+	}{
+		targetFd:    uint32(cgroupFd),
+		attachBpfFd: uint32(progFd),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+		attachFlags: unix.BPF_F_ALLOW_MULTI,
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_ATTACH, uintptr(unsafe.Pointer(&attachAttr)), unsafe.Sizeof(attachAttr)); errno != 0 {
+		return errors.Wrapf(errno, "attach device filter to %s", dir)
+	}
+	return nil
+}
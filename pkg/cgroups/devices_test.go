@@ -0,0 +1,36 @@
+package cgroups
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceRuleString(t *testing.T) {
+	assert.Equal(t, "c 1:3 rwm", DeviceRule{Type: 'c', Major: 1, Minor: 3, Access: "rwm"}.String())
+	assert.Equal(t, "b *:* m", DeviceRule{Type: 'b', Major: Wildcard, Minor: Wildcard, Access: "m"}.String())
+	assert.Equal(t, "a", DeviceRule{Type: 'a', Access: "rwm"}.String())
+}
+
+func TestDeviceFilterProgram(t *testing.T) {
+	prog := deviceFilterProgram([]DeviceRule{
+		{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},
+		{Type: 'c', Major: 136, Minor: Wildcard, Access: "rw"},
+	})
+	// header, rule 1: type, major, minor, return; rule 2: type, access
+	// (3 insns), major, return; deny.
+	assert.Len(t, prog, 6+5+7+2)
+	// Mismatches in rule 1 skip to rule 2, mismatches in rule 2 to the deny.
+	for i, insn := range prog {
+		if insn.code != bpfJneK && insn.code != bpfJneX {
+			continue
+		}
+		target := i + 1 + int(insn.off)
+		if i < 11 {
+			assert.Equal(t, 11, target, "jump at %d", i)
+		} else {
+			assert.Equal(t, 18, target, "jump at %d", i)
+		}
+	}
+	assert.Equal(t, byte(bpfExit), prog[len(prog)-1].code)
+}
@@ -0,0 +1,82 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// freezeTimeout is how long Freeze waits for the processes of the cgroup to
+// stop: a process in uninterruptible sleep only freezes once it wakes up.
+const freezeTimeout = 10 * time.Second
+
+// Freeze stops all the processes of the cgroup until Thaw, with the
+// freezer controller on v1 and cgroup.freeze on v2. It returns once they
+// are all frozen.
+func (m *Manager) Freeze() error {
+	if err := m.setFrozen(true); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		frozen, err := m.IsFrozen()
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			m.setFrozen(false)
+			return errors.Errorf("cgroup %s did not freeze in %s", m.name, freezeTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Thaw resumes the processes of a frozen cgroup.
+func (m *Manager) Thaw() error {
+	return m.setFrozen(false)
+}
+
+// IsFrozen reports whether all the processes of the cgroup are frozen.
+func (m *Manager) IsFrozen() (bool, error) {
+	if m.unified {
+		content, err := ioutil.ReadFile(filepath.Join(m.Path(""), "cgroup.events"))
+		if err != nil {
+			return false, errors.Wrap(err, "read cgroup events")
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line == "frozen 1" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	content, err := ioutil.ReadFile(filepath.Join(m.Path("freezer"), "freezer.state"))
+	if err != nil {
+		return false, errors.Wrap(err, "read freezer state")
+	}
+	return strings.TrimSpace(string(content)) == "FROZEN", nil
+}
+
+func (m *Manager) setFrozen(frozen bool) error {
+	dir, file, value := m.Path("freezer"), "freezer.state", "THAWED"
+	if frozen {
+		value = "FROZEN"
+	}
+	if m.unified {
+		file, value = "cgroup.freeze", "0"
+		if frozen {
+			value = "1"
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+		return errors.Wrapf(err, "no freezer for cgroup %s", m.name)
+	}
+	return writeFile(dir, file, value)
+}
@@ -0,0 +1,36 @@
+package cgroups
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeze(t *testing.T) {
+	m := NewManager("container-test-freeze")
+	if os.Geteuid() != 0 || m.Create() != nil {
+		t.Skip("needs root and cgroups")
+	}
+	defer m.Destroy()
+	if _, err := m.IsFrozen(); err != nil {
+		t.Skip("no freezer")
+	}
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	require.NoError(t, m.Apply(cmd.Process.Pid))
+
+	require.NoError(t, m.Freeze())
+	frozen, err := m.IsFrozen()
+	require.NoError(t, err)
+	assert.True(t, frozen)
+
+	require.NoError(t, m.Thaw())
+	frozen, err = m.IsFrozen()
+	require.NoError(t, err)
+	assert.False(t, frozen)
+}
@@ -0,0 +1,165 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultCPUPeriod is the CFS period quotas are expressed against, 100ms.
+const defaultCPUPeriod = 100000
+
+// Resources limit what the processes of a cgroup use. Zero leaves a limit
+// unset.
+type Resources struct {
+	// Memory is in bytes. MemorySwap limits memory plus swap, -1 lifts the
+	// swap limit.
+	Memory     int64
+	MemorySwap int64
+	// PidsLimit caps the number of processes, -1 is unlimited.
+	PidsLimit int64
+	// CPUQuota is the CPU time in microseconds the cgroup may use per
+	// CPUPeriod, 100ms unless set. CPUShares is its weight relative to
+	// other cgroups, 1024 by default.
+	CPUQuota  int64
+	CPUPeriod uint64
+	CPUShares uint64
+}
+
+func (r Resources) isZero() bool {
+	return r == Resources{}
+}
+
+// SetResources applies the limits of r to the cgroup.
+func (m *Manager) SetResources(r Resources) error {
+	if r.isZero() {
+		return nil
+	}
+	if r.CPUQuota != 0 && r.CPUPeriod == 0 {
+		r.CPUPeriod = defaultCPUPeriod
+	}
+	if m.unified {
+		return m.setResourcesV2(r)
+	}
+	return m.setResourcesV1(r)
+}
+
+func (m *Manager) setResourcesV1(r Resources) error {
+	var files [][3]string
+	if r.Memory != 0 {
+		files = append(files, [3]string{"memory", "memory.limit_in_bytes", strconv.FormatInt(r.Memory, 10)})
+	}
+	if r.MemorySwap != 0 {
+		files = append(files, [3]string{"memory", "memory.memsw.limit_in_bytes", strconv.FormatInt(r.MemorySwap, 10)})
+	}
+	if r.PidsLimit != 0 {
+		files = append(files, [3]string{"pids", "pids.max", limitValue(r.PidsLimit)})
+	}
+	if r.CPUPeriod != 0 {
+		files = append(files, [3]string{"cpu", "cpu.cfs_period_us", strconv.FormatUint(r.CPUPeriod, 10)})
+	}
+	if r.CPUQuota != 0 {
+		files = append(files, [3]string{"cpu", "cpu.cfs_quota_us", strconv.FormatInt(r.CPUQuota, 10)})
+	}
+	if r.CPUShares != 0 {
+		files = append(files, [3]string{"cpu", "cpu.shares", strconv.FormatUint(r.CPUShares, 10)})
+	}
+	for _, f := range files {
+		if err := writeFile(m.Path(f[0]), f[1], f[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) setResourcesV2(r Resources) error {
+	if err := m.enableControllers("memory", "pids", "cpu"); err != nil {
+		return err
+	}
+	dir := m.Path("")
+	if r.Memory != 0 {
+		if err := writeFile(dir, "memory.max", strconv.FormatInt(r.Memory, 10)); err != nil {
+			return err
+		}
+	}
+	if r.MemorySwap != 0 {
+		// v2 limits swap alone.
+		swap := "max"
+		if r.MemorySwap > 0 {
+			swap = strconv.FormatInt(r.MemorySwap-r.Memory, 10)
+		}
+		if err := writeFile(dir, "memory.swap.max", swap); err != nil {
+			return err
+		}
+	}
+	if r.PidsLimit != 0 {
+		if err := writeFile(dir, "pids.max", limitValue(r.PidsLimit)); err != nil {
+			return err
+		}
+	}
+	if r.CPUQuota != 0 {
+		max := limitValue(r.CPUQuota) + " " + strconv.FormatUint(r.CPUPeriod, 10)
+		if err := writeFile(dir, "cpu.max", max); err != nil {
+			return err
+		}
+	}
+	if r.CPUShares != 0 {
+		if err := writeFile(dir, "cpu.weight", strconv.FormatUint(sharesToWeight(r.CPUShares), 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enableControllers makes the controllers available to the cgroup, enabling
+// them in the subtree of each of its ancestors.
+func (m *Manager) enableControllers(controllers ...string) error {
+	var enable []string
+	for _, c := range controllers {
+		enable = append(enable, "+"+c)
+	}
+	dir := Root
+	for _, name := range strings.Split(m.name, "/") {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+		if err != nil {
+			return err
+		}
+		if !containsAll(strings.Fields(string(content)), controllers) {
+			if err := writeFile(dir, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+				return err
+			}
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return nil
+}
+
+func containsAll(have, want []string) bool {
+	set := map[string]bool{}
+	for _, h := range have {
+		set[h] = true
+	}
+	for _, w := range want {
+		if !set[w] {
+			return false
+		}
+	}
+	return true
+}
+
+func limitValue(n int64) string {
+	if n < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// sharesToWeight converts v1 CPU shares, 2 to 262144, to a v2 weight, 1 to
+// 10000.
+func sharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
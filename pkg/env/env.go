@@ -0,0 +1,91 @@
+package env
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseEnvFile reads a docker style env file: one KEY=VAL or KEY per line,
+// blank lines and lines starting with # are skipped.
+func ParseEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ret []string
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv, err := Normalize(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", path, lineNo)
+		}
+		if kv != "" {
+			ret = append(ret, kv)
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// Normalize turns KEY=VAL into itself and a bare KEY into KEY=<host value>.
+// A bare KEY that isn't set on the host yields "".
+func Normalize(s string) (string, error) {
+	if strings.HasPrefix(s, "=") {
+		return "", errors.Errorf("invalid environment variable: %q", s)
+	}
+	if strings.Contains(s, "=") {
+		return s, nil
+	}
+	if v, ok := os.LookupEnv(s); ok {
+		return s + "=" + v, nil
+	}
+	return "", nil
+}
+
+// Merge overlays overrides on top of base. Later values win, and the order
+// of first appearance is kept.
+func Merge(base []string, overrides ...[]string) []string {
+	var ret []string
+	index := map[string]int{}
+	add := func(kv string) {
+		key := Key(kv)
+		if i, ok := index[key]; ok {
+			ret[i] = kv
+			return
+		}
+		index[key] = len(ret)
+		ret = append(ret, kv)
+	}
+	for _, kv := range base {
+		add(kv)
+	}
+	for _, o := range overrides {
+		for _, kv := range o {
+			add(kv)
+		}
+	}
+	return ret
+}
+
+// Key returns the variable name of a KEY=VAL pair.
+func Key(kv string) string {
+	return strings.SplitN(kv, "=", 2)[0]
+}
+
+// Lookup returns the value of key in env.
+func Lookup(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if Key(env[i]) == key {
+			return strings.TrimPrefix(env[i], key+"="), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,30 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	merged := Merge([]string{"PATH=/bin", "A=1"}, []string{"A=2", "B=3"})
+	assert.Equal(t, []string{"PATH=/bin", "A=2", "B=3"}, merged)
+}
+
+func TestParseEnvFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "envfile")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	os.Setenv("ENV_TEST_INHERITED", "host")
+	defer os.Unsetenv("ENV_TEST_INHERITED")
+
+	_, err = f.WriteString("# comment\n\nA=1\nENV_TEST_INHERITED\nENV_TEST_UNSET\nB=x=y\n")
+	assert.NoError(t, err)
+	f.Close()
+
+	vars, err := ParseEnvFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A=1", "ENV_TEST_INHERITED=host", "B=x=y"}, vars)
+}
@@ -3,6 +3,8 @@ package file
 import (
 	"io"
 	"os"
+	"path/filepath"
+	"syscall"
 )
 
 func CopyFile(src, dst string) error {
@@ -22,3 +24,83 @@ func CopyFile(src, dst string) error {
 	}
 	return nil
 }
+
+// CopyTree copies the contents of the directory src into dst, preserving
+// modes, ownership, timestamps and symlinks. dst itself takes the mode and
+// ownership of src. Files already in dst are replaced, so trees can be
+// copied on top of each other.
+func CopyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		mode := info.Mode()
+		if !mode.IsDir() {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := CopyFile(path, target); err != nil {
+				return err
+			}
+		default:
+			st, ok := info.Sys().(*syscall.Stat_t)
+			if !ok {
+				return nil
+			}
+			if err := syscall.Mknod(target, st.Mode, int(st.Rdev)); err != nil {
+				return err
+			}
+		}
+		return copyMetadata(target, info)
+	})
+}
+
+func copyMetadata(target string, info os.FileInfo) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Lchown(target, int(st.Uid), int(st.Gid)); err != nil {
+			return err
+		}
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	// chmod after chown, which clears setuid bits.
+	if err := os.Chmod(target, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
+
+// IsEmptyDir reports whether dir has no entries.
+func IsEmptyDir(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
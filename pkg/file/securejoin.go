@@ -0,0 +1,61 @@
+package file
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks is how many symlinks SecureJoin follows before giving up, as
+// the kernel does with ELOOP.
+const maxSymlinks = 255
+
+// SecureJoin joins unsafePath onto root the way the kernel would resolve it
+// if root were the root directory: symlinks in it, absolute or not, and ..
+// components never lead out of root. Components that don't exist are taken
+// as they are. The result only stays scoped while nobody else changes the
+// tree under root.
+func SecureJoin(root, unsafePath string) (string, error) {
+	var path bytes.Buffer
+	links := 0
+	for unsafePath != "" {
+		if links > maxSymlinks {
+			return "", &os.PathError{Op: "securejoin", Path: root + "/" + unsafePath, Err: syscall.ELOOP}
+		}
+		var p string
+		if i := strings.IndexRune(unsafePath, filepath.Separator); i < 0 {
+			p, unsafePath = unsafePath, ""
+		} else {
+			p, unsafePath = unsafePath[:i], unsafePath[i+1:]
+		}
+		// path has no symlinks left, so .. can be taken lexically.
+		cleanP := filepath.Clean(string(filepath.Separator) + path.String() + p)
+		if cleanP == string(filepath.Separator) {
+			path.Reset()
+			continue
+		}
+		fullP := filepath.Clean(root + cleanP)
+		info, err := os.Lstat(fullP)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			path.WriteString(p)
+			path.WriteRune(filepath.Separator)
+			continue
+		}
+		links++
+		dest, err := os.Readlink(fullP)
+		if err != nil {
+			return "", err
+		}
+		// An absolute target starts over from root.
+		if filepath.IsAbs(dest) {
+			path.Reset()
+		}
+		unsafePath = dest + string(filepath.Separator) + unsafePath
+	}
+	return filepath.Clean(root + filepath.Clean(string(filepath.Separator)+path.String())), nil
+}
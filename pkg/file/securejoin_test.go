@@ -0,0 +1,42 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root, err := ioutil.TempDir("", "root")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/lib"), 0755))
+	for link, target := range map[string]string{
+		"etc/passwd": "/etc/shadow",
+		"etc/up":     "../../../..",
+		"lib":        "usr/lib",
+		"loop":       "loop",
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(root, link)))
+	}
+
+	for unsafe, want := range map[string]string{
+		"/etc/passwd":      "/etc/shadow",
+		"etc/up/etc/hosts": "/etc/hosts",
+		"../../etc":        "/etc",
+		"/lib/x/../y":      "/usr/lib/y",
+		"/new/dir":         "/new/dir",
+		"/":                "/",
+	} {
+		got, err := SecureJoin(root, unsafe)
+		require.NoError(t, err, unsafe)
+		assert.Equal(t, filepath.Join(root, want), got, unsafe)
+	}
+	_, err = SecureJoin(root, "/loop/x")
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package seccomp
+
+const (
+	nativeArch = ArchX86_64
+	// auditArchNative is AUDIT_ARCH_X86_64.
+	auditArchNative = 0xc000003e
+	// auditArchX86 is AUDIT_ARCH_I386.
+	auditArchX86 = 0x40000003
+	// x32 syscalls share the x86_64 audit arch and set this bit in nr.
+	syscallBitX32 = 0x40000000
+)
+
+// arches are the architectures binaries of this host can make syscalls with,
+// the native one first.
+var arches = []arch{
+	{name: ArchX86_64, filterArch: "amd64", audit: auditArchNative, syscalls: syscallNumbers},
+	{name: ArchX86, filterArch: "x86", audit: auditArchX86, syscalls: syscallNumbersX86},
+	{name: ArchX32, filterArch: "x32", audit: auditArchNative, syscalls: x32Syscalls()},
+}
+
+// x32Syscalls returns the syscall numbers of x32 binaries: the x86_64 ones
+// with the x32 bit, but for the syscalls that take different structures
+// there.
+func x32Syscalls() map[string]uint32 {
+	m := make(map[string]uint32, len(syscallNumbers))
+	for name, nr := range syscallNumbers {
+		m[name] = nr | syscallBitX32
+	}
+	for i, name := range []string{
+		"rt_sigaction", "rt_sigreturn", "ioctl", "readv", "writev", "recvfrom",
+		"sendmsg", "recvmsg", "execve", "ptrace", "rt_sigpending",
+		"rt_sigtimedwait", "rt_sigqueueinfo", "sigaltstack", "timer_create",
+		"mq_notify", "kexec_load", "waitid", "set_robust_list",
+		"get_robust_list", "vmsplice", "move_pages", "preadv", "pwritev",
+		"rt_tgsigqueueinfo", "recvmmsg", "sendmmsg", "process_vm_readv",
+		"process_vm_writev", "setsockopt", "getsockopt", "io_setup", "io_submit",
+		"execveat", "preadv2", "pwritev2",
+	} {
+		m[name] = uint32(512+i) | syscallBitX32
+	}
+	return m
+}
@@ -0,0 +1,30 @@
+package seccomp
+
+const (
+	nativeArch = ArchAARCH64
+	// auditArchNative is AUDIT_ARCH_AARCH64.
+	auditArchNative = 0xc00000b7
+	// auditArchARM is AUDIT_ARCH_ARM.
+	auditArchARM  = 0x40000028
+	syscallBitX32 = 0
+)
+
+// arches are the architectures binaries of this host can make syscalls with,
+// the native one first.
+var arches = []arch{
+	{name: ArchAARCH64, filterArch: "arm64", audit: auditArchNative, syscalls: syscallNumbers},
+	{name: ArchARM, filterArch: "arm", audit: auditArchARM, syscalls: armSyscalls()},
+}
+
+// armSyscalls returns the syscall numbers of arm binaries, with the ARM
+// private syscalls from __ARM_NR_BASE.
+func armSyscalls() map[string]uint32 {
+	m := make(map[string]uint32, len(syscallNumbersARM)+6)
+	for name, nr := range syscallNumbersARM {
+		m[name] = nr
+	}
+	for i, name := range []string{"breakpoint", "cacheflush", "usr26", "usr32", "set_tls", "get_tls"} {
+		m[name] = uint32(0x0f0001 + i)
+	}
+	return m
+}
@@ -0,0 +1,13 @@
+//go:build (!amd64 && !arm64) || !linux
+// +build !amd64,!arm64 !linux
+
+package seccomp
+
+// Filters are only compiled for the architectures we have syscall tables for.
+const (
+	nativeArch      Arch = ""
+	auditArchNative      = 0
+	syscallBitX32        = 0
+)
+
+var arches []arch
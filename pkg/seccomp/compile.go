@@ -0,0 +1,467 @@
+package seccomp
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Filter return values, see include/uapi/linux/seccomp.h.
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+	retDataMask    = 0x0000ffff
+)
+
+// maxInstructions is the longest filter the kernel loads, BPF_MAXINSNS.
+const maxInstructions = 4096
+
+// Offsets into struct seccomp_data { int nr; u32 arch; u64 ip; u64 args[6]; }.
+const (
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+	maxArgs    = 6
+)
+
+// arch is an architecture a filter has a section for.
+type arch struct {
+	name Arch
+	// filterArch is how Filter.Arches names it.
+	filterArch string
+	audit      uint32
+	syscalls   map[string]uint32
+}
+
+// Compile turns p into a classic BPF program with a section for every
+// architecture of this host p lists, the native one when it lists none.
+// caps are the capabilities of the container, for the rules that depend on
+// them. Syscalls made through other architectures kill the process.
+func Compile(p *Profile, caps []string) ([]unix.SockFilter, error) {
+	if nativeArch == "" {
+		return nil, errors.Errorf("seccomp is not supported on %s", runtime.GOARCH)
+	}
+	listed := p.listedArches()
+	if !listed[nativeArch] {
+		return nil, errors.Errorf("seccomp profile does not support %s", nativeArch)
+	}
+	defaultRet, err := actionValue(p.DefaultAction, p.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+	kernel, err := kernelVersion()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range p.Syscalls {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	sections := map[Arch][]unix.SockFilter{}
+	for _, a := range arches {
+		if !listed[a.name] {
+			continue
+		}
+		if sections[a.name], err = compileArch(p, a, caps, kernel, defaultRet); err != nil {
+			return nil, errors.Wrapf(err, "%s", a.name)
+		}
+	}
+
+	var prog []unix.SockFilter
+	for _, a := range arches {
+		body, ok := sections[a.name]
+		if a.name == ArchX32 || !ok {
+			continue
+		}
+		if a.name == nativeArch && syscallBitX32 != 0 {
+			// x32 shares the audit arch of x86_64, its syscalls are told
+			// apart by nr.
+			x32, ok := sections[ArchX32]
+			if !ok {
+				x32 = []unix.SockFilter{stmt(unix.BPF_RET|unix.BPF_K, retKillProcess)}
+			}
+			body = append(append([]unix.SockFilter{
+				jump(unix.BPF_JGE, syscallBitX32, 0, 1),
+				stmt(unix.BPF_JMP|unix.BPF_JA, uint32(len(body))),
+			}, body...), x32...)
+		}
+		prog = append(prog,
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+			jump(unix.BPF_JEQ, a.audit, 1, 0),
+			stmt(unix.BPF_JMP|unix.BPF_JA, uint32(len(body)+1)),
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+		)
+		prog = append(prog, body...)
+	}
+	prog = append(prog, stmt(unix.BPF_RET|unix.BPF_K, retKillProcess))
+	if len(prog) > maxInstructions {
+		return nil, errors.Errorf("seccomp profile is too large: it compiles to %d instructions, the kernel takes at most %d", len(prog), maxInstructions)
+	}
+	return prog, nil
+}
+
+// compileArch emits the rules of p for the syscalls of a, the syscall
+// number loaded.
+func compileArch(p *Profile, a arch, caps []string, kernel [2]int, defaultRet uint32) ([]unix.SockFilter, error) {
+	rules := map[uint32][]rule{}
+	var order []uint32
+	for _, s := range p.Syscalls {
+		if !s.Includes.includes(caps, a.filterArch, kernel) || s.Excludes.excludes(caps, a.filterArch, kernel) {
+			continue
+		}
+		ret, err := actionValue(s.Action, s.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		names := s.Names
+		if s.Name != "" {
+			names = append([]string{s.Name}, names...)
+		}
+		for _, name := range names {
+			// Like libseccomp, ignore syscalls this architecture lacks.
+			nr, ok := a.syscalls[name]
+			if !ok {
+				continue
+			}
+			if _, ok := rules[nr]; !ok {
+				order = append(order, nr)
+			}
+			rules[nr] = append(rules[nr], rule{args: s.Args, ret: ret})
+		}
+	}
+
+	var prog []unix.SockFilter
+	for _, nr := range order {
+		body, err := compileSyscall(rules[nr], defaultRet)
+		if err != nil {
+			return nil, errors.Wrapf(err, "syscall %d", nr)
+		}
+		if len(body) > 0xff {
+			return nil, errors.Errorf("syscall %d: too many rules", nr)
+		}
+		prog = append(prog, jump(unix.BPF_JEQ, nr, 0, uint8(len(body))))
+		prog = append(prog, body...)
+	}
+	return append(prog, stmt(unix.BPF_RET|unix.BPF_K, defaultRet)), nil
+}
+
+// Resolve returns the rules of p that apply to a container with caps on this
+// host, without conditions, as OCI runtime specs have them.
+func Resolve(p *Profile, caps []string) (*Profile, error) {
+	kernel, err := kernelVersion()
+	if err != nil {
+		return nil, err
+	}
+	ret := *p
+	ret.Architectures = append([]Arch{}, p.Architectures...)
+	for _, m := range p.ArchMap {
+		ret.Architectures = append(append(ret.Architectures, m.Arch), m.SubArches...)
+	}
+	ret.ArchMap = nil
+	ret.Syscalls = nil
+	for _, s := range p.Syscalls {
+		if !s.Includes.includes(caps, runtime.GOARCH, kernel) || s.Excludes.excludes(caps, runtime.GOARCH, kernel) {
+			continue
+		}
+		resolved := *s
+		if resolved.Name != "" {
+			resolved.Names = append([]string{resolved.Name}, resolved.Names...)
+			resolved.Name = ""
+		}
+		resolved.Includes, resolved.Excludes = Filter{}, Filter{}
+		ret.Syscalls = append(ret.Syscalls, &resolved)
+	}
+	return &ret, nil
+}
+
+// listedArches returns the architectures p lists, with their
+// sub-architectures, or the native one if it lists none.
+func (p *Profile) listedArches() map[Arch]bool {
+	ret := map[Arch]bool{}
+	for _, a := range p.Architectures {
+		ret[a] = true
+	}
+	for _, m := range p.ArchMap {
+		ret[m.Arch] = true
+		for _, a := range m.SubArches {
+			ret[a] = true
+		}
+	}
+	if len(ret) == 0 {
+		ret[nativeArch] = true
+	}
+	return ret
+}
+
+// includes reports whether every condition of f holds for syscalls of the
+// architecture named archName.
+func (f Filter) includes(caps []string, archName string, kernel [2]int) bool {
+	for _, c := range f.Caps {
+		if !contains(caps, c) {
+			return false
+		}
+	}
+	if len(f.Arches) > 0 && !contains(f.Arches, archName) {
+		return false
+	}
+	return f.MinKernel == "" || kernelAtLeast(kernel, f.MinKernel)
+}
+
+// excludes reports whether any condition of f holds for syscalls of the
+// architecture named archName.
+func (f Filter) excludes(caps []string, archName string, kernel [2]int) bool {
+	for _, c := range f.Caps {
+		if contains(caps, c) {
+			return true
+		}
+	}
+	if contains(f.Arches, archName) {
+		return true
+	}
+	return f.MinKernel != "" && kernelAtLeast(kernel, f.MinKernel)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func actionValue(a Action, errnoRet *uint) (uint32, error) {
+	data := uint32(unix.EPERM)
+	if errnoRet != nil {
+		data = uint32(*errnoRet) & retDataMask
+	}
+	switch a {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		return retErrno | data, nil
+	case ActTrace:
+		return retTrace | data, nil
+	case ActAllow:
+		return retAllow, nil
+	case ActLog:
+		return retLog, nil
+	}
+	return 0, errors.Errorf("unsupported seccomp action %q", a)
+}
+
+func (s *Syscall) validate() error {
+	for _, v := range []string{s.Includes.MinKernel, s.Excludes.MinKernel} {
+		if v == "" {
+			continue
+		}
+		if _, err := parseKernelVersion(v); err != nil {
+			return err
+		}
+	}
+	for _, a := range s.Args {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Arg) validate() error {
+	if a.Index >= maxArgs {
+		return errors.Errorf("invalid seccomp argument index %d", a.Index)
+	}
+	switch a.Op {
+	case OpNotEqual, OpLessThan, OpLessEqual, OpEqualTo, OpGreaterEqual, OpGreaterThan, OpMaskedEqual:
+		return nil
+	}
+	return errors.Errorf("unsupported seccomp operator %q", a.Op)
+}
+
+type rule struct {
+	args []*Arg
+	ret  uint32
+}
+
+// compileSyscall emits the rules of one syscall, evaluated in order with
+// conditional rules first. The first match returns; if none does the
+// default action applies.
+func compileSyscall(rules []rule, defaultRet uint32) ([]unix.SockFilter, error) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].args) > 0 && len(rules[j].args) == 0
+	})
+	var body []unix.SockFilter
+	for _, r := range rules {
+		block, err := compileRule(r)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, block...)
+		if len(r.args) == 0 {
+			return body, nil
+		}
+	}
+	return append(body, stmt(unix.BPF_RET|unix.BPF_K, defaultRet)), nil
+}
+
+// target is a jump destination inside an argument check: an index into the
+// check, where len(check) continues with the next check, or fail.
+type target int
+
+const fail target = -1
+
+type insn struct {
+	code   uint16
+	k      uint32
+	jt, jf target
+}
+
+// compileRule emits the checks of r followed by its return. A failing check
+// jumps past the return, to the next rule.
+func compileRule(r rule) ([]unix.SockFilter, error) {
+	var checks [][]insn
+	for _, a := range r.args {
+		checks = append(checks, compileArg(a))
+	}
+	n := 1
+	for _, c := range checks {
+		n += len(c)
+	}
+	var block []unix.SockFilter
+	for _, c := range checks {
+		start := len(block)
+		for i, in := range c {
+			pos := start + i
+			if in.code&0x07 != unix.BPF_JMP {
+				block = append(block, stmt(in.code, in.k))
+				continue
+			}
+			jt, err := relative(in.jt, start, pos, n)
+			if err != nil {
+				return nil, err
+			}
+			jf, err := relative(in.jf, start, pos, n)
+			if err != nil {
+				return nil, err
+			}
+			block = append(block, unix.SockFilter{Code: in.code, K: in.k, Jt: jt, Jf: jf})
+		}
+	}
+	return append(block, stmt(unix.BPF_RET|unix.BPF_K, r.ret)), nil
+}
+
+func relative(t target, start, pos, ruleLen int) (uint8, error) {
+	dest := start + int(t)
+	if t == fail {
+		dest = ruleLen
+	}
+	off := dest - pos - 1
+	if off < 0 || off > 0xff {
+		return 0, errors.Errorf("seccomp jump out of range")
+	}
+	return uint8(off), nil
+}
+
+// compileArg emits a 64-bit comparison of an argument as two 32-bit ones.
+// Arguments are little endian on the architectures we support.
+func compileArg(a *Arg) []insn {
+	lo := uint32(offsetArgs + 8*a.Index)
+	hi := lo + 4
+	load := func(off uint32) insn { return insn{code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, k: off} }
+	cmp := func(op uint16, k uint32, jt, jf target) insn {
+		return insn{code: unix.BPF_JMP | op | unix.BPF_K, k: k, jt: jt, jf: jf}
+	}
+	vhi, vlo := uint32(a.Value>>32), uint32(a.Value)
+
+	switch a.Op {
+	case OpEqualTo:
+		return []insn{load(hi), cmp(unix.BPF_JEQ, vhi, 2, fail), load(lo), cmp(unix.BPF_JEQ, vlo, 4, fail)}
+	case OpNotEqual:
+		return []insn{load(hi), cmp(unix.BPF_JEQ, vhi, 2, 4), load(lo), cmp(unix.BPF_JEQ, vlo, fail, 4)}
+	case OpMaskedEqual:
+		and := func(k uint32) insn { return insn{code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, k: k} }
+		whi, wlo := uint32(a.ValueTwo>>32), uint32(a.ValueTwo)
+		return []insn{
+			load(hi), and(vhi), cmp(unix.BPF_JEQ, whi, 3, fail),
+			load(lo), and(vlo), cmp(unix.BPF_JEQ, wlo, 6, fail),
+		}
+	case OpGreaterThan, OpGreaterEqual:
+		op := uint16(unix.BPF_JGT)
+		if a.Op == OpGreaterEqual {
+			op = unix.BPF_JGE
+		}
+		return []insn{
+			load(hi), cmp(unix.BPF_JGT, vhi, 5, 2), cmp(unix.BPF_JEQ, vhi, 3, fail),
+			load(lo), cmp(op, vlo, 5, fail),
+		}
+	default: // OpLessThan, OpLessEqual
+		op := uint16(unix.BPF_JGE)
+		if a.Op == OpLessEqual {
+			op = unix.BPF_JGT
+		}
+		return []insn{
+			load(hi), cmp(unix.BPF_JGT, vhi, fail, 2), cmp(unix.BPF_JEQ, vhi, 3, 5),
+			load(lo), cmp(op, vlo, fail, 5),
+		}
+	}
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(op uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, K: k, Jt: jt, Jf: jf}
+}
+
+func kernelVersion() ([2]int, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return [2]int{}, errors.Wrap(err, "uname")
+	}
+	release := string(uts.Release[:])
+	if i := strings.IndexByte(release, 0); i >= 0 {
+		release = release[:i]
+	}
+	return parseKernelVersion(release)
+}
+
+// parseKernelVersion parses the major and minor of a release like 5.4.0-42.
+func parseKernelVersion(release string) ([2]int, error) {
+	var v [2]int
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return v, errors.Errorf("invalid kernel version %q", release)
+	}
+	for i := range v {
+		digits := strings.TrimRightFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			return v, errors.Errorf("invalid kernel version %q", release)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// kernelAtLeast reports whether kernel is min or newer. min has been
+// validated already.
+func kernelAtLeast(kernel [2]int, min string) bool {
+	v, _ := parseKernelVersion(min)
+	return kernel[0] > v[0] || kernel[0] == v[0] && kernel[1] >= v[1]
+}
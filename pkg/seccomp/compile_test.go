@@ -0,0 +1,185 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// run interprets filter for a syscall like the kernel would.
+func run(t *testing.T, filter []unix.SockFilter, arch uint32, nr uint32, args ...uint64) uint32 {
+	data := make([]byte, offsetArgs+8*maxArgs)
+	binary.LittleEndian.PutUint32(data[offsetNr:], nr)
+	binary.LittleEndian.PutUint32(data[offsetArch:], arch)
+	for i, a := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+8*i:], a)
+	}
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		in := filter[pc]
+		switch in.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[in.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= in.K
+		case unix.BPF_RET | unix.BPF_K:
+			return in.K
+		case unix.BPF_JMP | unix.BPF_JA:
+			pc += int(in.K)
+		default:
+			var ok bool
+			switch in.Code &^ (unix.BPF_JMP | unix.BPF_K) {
+			case unix.BPF_JEQ:
+				ok = acc == in.K
+			case unix.BPF_JGT:
+				ok = acc > in.K
+			case unix.BPF_JGE:
+				ok = acc >= in.K
+			default:
+				t.Fatalf("unexpected instruction %#x", in.Code)
+			}
+			if ok {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		}
+	}
+	t.Fatal("filter fell off the end")
+	return 0
+}
+
+func TestCompile(t *testing.T) {
+	if nativeArch == "" {
+		t.Skip("no syscall table for this architecture")
+	}
+	p, err := ParseProfile([]byte(`{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"archMap": [{"architecture": "SCMP_ARCH_X86_64", "subArchitectures": ["SCMP_ARCH_X86"]},
+			{"architecture": "SCMP_ARCH_AARCH64", "subArchitectures": ["SCMP_ARCH_ARM"]}],
+		"syscalls": [
+			{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"},
+			{"names": ["getpid"], "action": "SCMP_ACT_ERRNO", "errnoRet": 38},
+			{"names": ["personality"], "action": "SCMP_ACT_ALLOW",
+				"args": [{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}]},
+			{"names": ["kill"], "action": "SCMP_ACT_ALLOW",
+				"args": [{"index": 1, "value": 9, "op": "SCMP_CMP_NE"}]},
+			{"names": ["dup3"], "action": "SCMP_ACT_ALLOW",
+				"args": [{"index": 2, "value": 240, "valueTwo": 16, "op": "SCMP_CMP_MASKED_EQ"}]},
+			{"names": ["lseek"], "action": "SCMP_ACT_ALLOW",
+				"args": [{"index": 2, "value": 4294967296, "op": "SCMP_CMP_LT"}]},
+			{"names": ["setns"], "action": "SCMP_ACT_ALLOW", "includes": {"caps": ["CAP_SYS_ADMIN"]}},
+			{"names": ["no_such_syscall"], "action": "SCMP_ACT_ALLOW"}
+		]
+	}`))
+	require.NoError(t, err)
+	filter, err := Compile(p, nil)
+	require.NoError(t, err)
+
+	eperm := uint32(retErrno | unix.EPERM)
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_READ))
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_WRITE))
+	assert.Equal(t, eperm, run(t, filter, auditArchNative, unix.SYS_CLOSE))
+	assert.Equal(t, uint32(retErrno|38), run(t, filter, auditArchNative, unix.SYS_GETPID))
+	assert.Equal(t, uint32(retKillProcess), run(t, filter, 0x4000002a, unix.SYS_READ))
+
+	// The 32-bit architecture has its own syscall numbers.
+	compat := arches[1]
+	assert.Equal(t, uint32(retAllow), run(t, filter, compat.audit, compat.syscalls["read"]))
+	assert.Equal(t, uint32(retErrno|38), run(t, filter, compat.audit, compat.syscalls["getpid"]))
+	assert.Equal(t, eperm, run(t, filter, compat.audit, compat.syscalls["close"]))
+	assert.Equal(t, uint32(retAllow), run(t, filter, compat.audit, compat.syscalls["personality"], 8))
+	if syscallBitX32 != 0 {
+		// x32 is not listed.
+		assert.Equal(t, uint32(retKillProcess), run(t, filter, auditArchNative, unix.SYS_READ|syscallBitX32))
+	}
+
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_PERSONALITY, 8))
+	assert.Equal(t, eperm, run(t, filter, auditArchNative, unix.SYS_PERSONALITY, 8|1<<32))
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_KILL, 1, 15))
+	assert.Equal(t, eperm, run(t, filter, auditArchNative, unix.SYS_KILL, 1, 9))
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_DUP3, 0, 1, 0x1f))
+	assert.Equal(t, eperm, run(t, filter, auditArchNative, unix.SYS_DUP3, 0, 1, 0x2f))
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_LSEEK, 0, 0, 1<<32-1))
+	assert.Equal(t, eperm, run(t, filter, auditArchNative, unix.SYS_LSEEK, 0, 0, 1<<32))
+	assert.Equal(t, eperm, run(t, filter, auditArchNative, unix.SYS_SETNS))
+
+	filter, err = Compile(p, []string{"CAP_SYS_ADMIN"})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_SETNS))
+
+	// Without architectures only native syscalls are allowed.
+	p.ArchMap = nil
+	filter, err = Compile(p, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_READ))
+	assert.Equal(t, uint32(retKillProcess), run(t, filter, compat.audit, compat.syscalls["read"]))
+}
+
+func TestCompileDefaultProfile(t *testing.T) {
+	if nativeArch == "" {
+		t.Skip("no syscall table for this architecture")
+	}
+	filter, err := Compile(DefaultProfile(), []string{"CAP_CHOWN"})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(retAllow), run(t, filter, auditArchNative, unix.SYS_CLONE, uint64(unix.SIGCHLD)))
+	assert.Equal(t, uint32(retErrno|unix.EPERM), run(t, filter, auditArchNative, unix.SYS_CLONE, unix.CLONE_NEWNS))
+	assert.Equal(t, uint32(retErrno|unix.EPERM), run(t, filter, auditArchNative, unix.SYS_MOUNT))
+	for _, a := range arches[1:] {
+		assert.Equal(t, uint32(retAllow), run(t, filter, a.audit, a.syscalls["read"]), a.name)
+		assert.Equal(t, uint32(retErrno|unix.EPERM), run(t, filter, a.audit, a.syscalls["mount"]), a.name)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	p, err := ParseProfile([]byte(`{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"archMap": [{"architecture": "SCMP_ARCH_X86_64", "subArchitectures": ["SCMP_ARCH_X86"]}],
+		"syscalls": [
+			{"name": "read", "names": ["write"], "action": "SCMP_ACT_ALLOW"},
+			{"names": ["mount"], "action": "SCMP_ACT_ALLOW", "includes": {"caps": ["CAP_SYS_ADMIN"]}},
+			{"names": ["ptrace"], "action": "SCMP_ACT_ALLOW", "excludes": {"caps": ["CAP_SYS_ADMIN"]}}
+		]}`))
+	require.NoError(t, err)
+	r, err := Resolve(p, []string{"CAP_SYS_ADMIN"})
+	require.NoError(t, err)
+	assert.Equal(t, []Arch{ArchX86_64, ArchX86}, r.Architectures)
+	assert.Empty(t, r.ArchMap)
+	require.Len(t, r.Syscalls, 2)
+	assert.Equal(t, []string{"read", "write"}, r.Syscalls[0].Names)
+	assert.Equal(t, []string{"mount"}, r.Syscalls[1].Names)
+	assert.Equal(t, Filter{}, r.Syscalls[1].Includes)
+}
+
+func TestCompileTooLarge(t *testing.T) {
+	if nativeArch == "" {
+		t.Skip("no syscall table for this architecture")
+	}
+	p := &Profile{
+		DefaultAction: ActAllow,
+		ArchMap:       []Architecture{{Arch: ArchX86_64, SubArches: []Arch{ArchX86, ArchX32}}, {Arch: ArchAARCH64, SubArches: []Arch{ArchARM}}},
+	}
+	// Within the limit for each syscall, not for all of them.
+	for _, name := range []string{"read", "write", "close", "ioctl", "fcntl", "openat", "lseek", "dup", "fstat", "fsync"} {
+		for fd := uint64(0); fd < 40; fd++ {
+			p.Syscalls = append(p.Syscalls, &Syscall{Names: []string{name}, Action: ActErrno, Args: []*Arg{{Index: 0, Value: fd, Op: OpEqualTo}}})
+		}
+	}
+	_, err := Compile(p, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "seccomp profile is too large")
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	_, err := ParseProfile([]byte(`{"syscalls": []}`))
+	assert.Error(t, err)
+
+	p, err := ParseProfile([]byte(`{"defaultAction": "SCMP_ACT_ALLOW",
+		"syscalls": [{"names": ["read"], "action": "SCMP_ACT_NOTIFY"}]}`))
+	require.NoError(t, err)
+	_, err = Compile(p, nil)
+	assert.Error(t, err)
+}
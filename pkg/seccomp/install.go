@@ -0,0 +1,26 @@
+package seccomp
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Install loads filter on the calling thread, which the caller must have
+// locked: filters are per thread and inherited by processes forked from it.
+// Every syscall the thread makes afterwards is filtered too. The thread needs
+// no_new_privs set or CAP_SYS_ADMIN.
+func Install(filter []unix.SockFilter) error {
+	if len(filter) == 0 {
+		return errors.New("empty seccomp filter")
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	_, _, errno := unix.RawSyscall(unix.SYS_PRCTL, unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)))
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		return errors.Wrap(errno, "load seccomp filter")
+	}
+	return nil
+}
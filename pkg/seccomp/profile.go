@@ -0,0 +1,111 @@
+package seccomp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Action is what the kernel does when a syscall matches a rule.
+type Action string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+	ActLog         Action = "SCMP_ACT_LOG"
+)
+
+// Arch is a libseccomp architecture name.
+type Arch string
+
+const (
+	ArchX86     Arch = "SCMP_ARCH_X86"
+	ArchX86_64  Arch = "SCMP_ARCH_X86_64"
+	ArchX32     Arch = "SCMP_ARCH_X32"
+	ArchARM     Arch = "SCMP_ARCH_ARM"
+	ArchAARCH64 Arch = "SCMP_ARCH_AARCH64"
+)
+
+// Operator compares a syscall argument.
+type Operator string
+
+const (
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	OpMaskedEqual  Operator = "SCMP_CMP_MASKED_EQ"
+)
+
+// Profile is a seccomp profile in the docker JSON format.
+type Profile struct {
+	DefaultAction   Action         `json:"defaultAction"`
+	DefaultErrnoRet *uint          `json:"defaultErrnoRet,omitempty"`
+	Architectures   []Arch         `json:"architectures,omitempty"`
+	ArchMap         []Architecture `json:"archMap,omitempty"`
+	Syscalls        []*Syscall     `json:"syscalls"`
+}
+
+// Architecture lists the sub-architectures a filter for Arch also covers.
+type Architecture struct {
+	Arch      Arch   `json:"architecture"`
+	SubArches []Arch `json:"subArchitectures"`
+}
+
+// Filter restricts a rule to some capabilities, architectures or kernels.
+type Filter struct {
+	Caps      []string `json:"caps,omitempty"`
+	Arches    []string `json:"arches,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+// Arg is a condition on a syscall argument. For SCMP_CMP_MASKED_EQ Value is
+// the mask and ValueTwo the expected value.
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo"`
+	Op       Operator `json:"op"`
+}
+
+// Syscall is a rule for one or more syscalls. All Args must match.
+type Syscall struct {
+	// Name is the single-syscall form of Names in older profiles.
+	Name     string   `json:"name,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []*Arg   `json:"args"`
+	Comment  string   `json:"comment"`
+	Includes Filter   `json:"includes"`
+	Excludes Filter   `json:"excludes"`
+}
+
+// ParseProfile parses a JSON profile.
+func ParseProfile(content []byte) (*Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(content, &p); err != nil {
+		return nil, errors.Wrap(err, "decode seccomp profile")
+	}
+	if p.DefaultAction == "" {
+		return nil, errors.New("seccomp profile has no defaultAction")
+	}
+	return &p, nil
+}
+
+// LoadProfile reads and parses the JSON profile at path.
+func LoadProfile(path string) (*Profile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read seccomp profile")
+	}
+	return ParseProfile(content)
+}
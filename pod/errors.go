@@ -0,0 +1,13 @@
+package pod
+
+import "github.com/pkg/errors"
+
+var (
+	ErrNotExists   error = errors.New("pod not exists")
+	ErrExists      error = errors.New("pod already exists")
+	ErrInvalidName error = errors.New("invalid pod name")
+)
+
+func IsPodNotExists(err error) bool {
+	return errors.Cause(err) == ErrNotExists
+}
@@ -0,0 +1,33 @@
+package pod
+
+import (
+	"regexp"
+	"time"
+)
+
+const (
+	StatusCreated = "created"
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// Pod is a group of containers sharing the network, IPC and UTS namespaces
+// of its infra process. Its members are the containers run with --pod.
+type Pod struct {
+	Name      string            `json:"name"`
+	CreatedAt time.Time         `json:"created_at"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Infra     *Infra            `json:"infra,omitempty"`
+}
+
+// Infra is the process holding the namespaces of a running pod.
+type Infra struct {
+	Pid       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func IsValidName(name string) bool {
+	return validName.MatchString(name)
+}
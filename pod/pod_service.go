@@ -0,0 +1,371 @@
+package pod
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/exfly/container/config"
+	"github.com/exfly/container/container"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// InfraCommand is the hidden subcommand the infra process runs.
+const InfraCommand = "pod-infra"
+
+// infraSyncFd is the fd on which the infra process reports it is ready.
+const infraSyncFd = 3
+
+func NewPodService(configHome *config.Home, containerSrv *container.ContainerService) *PodService {
+	return &PodService{
+		configHome:   configHome,
+		containerSrv: containerSrv,
+	}
+}
+
+type PodService struct {
+	configHome   *config.Home
+	containerSrv *container.ContainerService
+}
+
+func (s *PodService) GetPodHome(name string) string {
+	return s.configHome.PodsPath() + "/" + name
+}
+
+func (s *PodService) GetPodMetadataPath(name string) string {
+	return s.GetPodHome(name) + "/pod.json"
+}
+
+func (s *PodService) Create(name string, labels map[string]string) (*Pod, error) {
+	if !IsValidName(name) {
+		return nil, errors.Wrapf(ErrInvalidName, "%q", name)
+	}
+	if _, err := s.Inspect(name); err == nil {
+		return nil, errors.Wrapf(ErrExists, "%s", name)
+	} else if !IsPodNotExists(err) {
+		return nil, err
+	}
+	p := &Pod{
+		Name:      name,
+		CreatedAt: time.Now(),
+		Labels:    labels,
+	}
+	if err := os.MkdirAll(s.GetPodHome(name), 0755); err != nil {
+		return nil, errors.Wrapf(err, "create pod %s", name)
+	}
+	if err := s.marshalPod(p); err != nil {
+		return nil, err
+	}
+	log.WithField("pod", name).Debug("pod created")
+	return p, nil
+}
+
+func (s *PodService) Inspect(name string) (*Pod, error) {
+	content, err := ioutil.ReadFile(s.GetPodMetadataPath(name))
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotExists, "%s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Pod
+	if err := json.Unmarshal(content, &p); err != nil {
+		return nil, errors.Wrapf(err, "parse pod %s", name)
+	}
+	return &p, nil
+}
+
+// List returns all pods sorted by name.
+func (s *PodService) List() ([]*Pod, error) {
+	entries, err := ioutil.ReadDir(s.configHome.PodsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Pod
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		p, err := s.Inspect(entry.Name())
+		if err != nil {
+			log.WithError(err).WithField("pod", entry.Name()).Warn("skip broken pod")
+			continue
+		}
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+// Status is running while the infra process is, created until the pod is
+// first started and stopped afterwards.
+func (s *PodService) Status(p *Pod) string {
+	switch {
+	case p.Infra == nil:
+		return StatusCreated
+	case infraAlive(p):
+		return StatusRunning
+	default:
+		return StatusStopped
+	}
+}
+
+// Members returns the containers of the pod.
+func (s *PodService) Members(name string) ([]*container.Container, error) {
+	containers, err := s.containerSrv.List()
+	if err != nil {
+		return nil, err
+	}
+	var ret []*container.Container
+	for _, c := range containers {
+		if c.Pod == name {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// Start starts the infra process of the pod if it isn't running, then the
+// members that aren't, in the namespaces of the infra process. ctx is for
+// the health checks of the members.
+func (s *PodService) Start(ctx context.Context, name string) (*Pod, error) {
+	p, err := s.ensureInfra(name)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.Members(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range members {
+		// Bundle containers are started with the OCI start command.
+		if c.State.IsRunning() || c.Bundle != "" {
+			continue
+		}
+		id := *c.ContainerID
+		if err := s.containerSrv.Update(id, func(c *container.Container) { joinInfra(c, p) }); err != nil {
+			return nil, err
+		}
+		if err := s.containerSrv.Start(ctx, id); err != nil {
+			return nil, errors.Wrapf(err, "start pod %s member %s", name, id)
+		}
+	}
+	return p, nil
+}
+
+// ensureInfra starts the infra process of the pod if it isn't running.
+func (s *PodService) ensureInfra(name string) (*Pod, error) {
+	p, err := s.Inspect(name)
+	if err != nil {
+		return nil, err
+	}
+	if s.Status(p) == StatusRunning {
+		return p, nil
+	}
+	if config.IsRootless() {
+		// Members couldn't join namespaces owned by our user namespace.
+		return nil, errors.New("pods are not supported in rootless mode")
+	}
+	if p.Infra, err = startInfra(name); err != nil {
+		return nil, err
+	}
+	return p, s.marshalPod(p)
+}
+
+// Stop stops the members of the pod, then its infra process.
+func (s *PodService) Stop(name string, timeout time.Duration) error {
+	p, err := s.Inspect(name)
+	if err != nil {
+		return err
+	}
+	members, err := s.Members(name)
+	if err != nil {
+		return err
+	}
+	for _, c := range members {
+		if !c.State.IsRunning() {
+			continue
+		}
+		err := s.containerSrv.Stop(*c.ContainerID, timeout)
+		if err != nil && errors.Cause(err) != container.ErrNotRunning && !container.IsContainerNotExists(err) {
+			return err
+		}
+	}
+	if s.Status(p) != StatusRunning {
+		return nil
+	}
+	return stopInfra(p, timeout)
+}
+
+// Remove removes a pod and its members. A pod that is running or has
+// running members is only removed with force, which stops it first.
+func (s *PodService) Remove(ctx context.Context, name string, force bool) error {
+	p, err := s.Inspect(name)
+	if err != nil {
+		return err
+	}
+	members, err := s.Members(name)
+	if err != nil {
+		return err
+	}
+	running := s.Status(p) == StatusRunning
+	for _, c := range members {
+		running = running || c.State.IsRunning()
+	}
+	if running {
+		if !force {
+			return errors.Errorf("pod %s is running, stop it first or force removal", name)
+		}
+		if err := s.Stop(name, container.DefaultStopTimeout); err != nil {
+			return err
+		}
+	}
+	for _, c := range members {
+		err := s.containerSrv.Remove(ctx, *c.ContainerID, force)
+		if err != nil && !container.IsContainerNotExists(err) {
+			return errors.Wrapf(err, "remove pod %s member", name)
+		}
+	}
+	return errors.Wrapf(os.RemoveAll(s.GetPodHome(name)), "remove pod %s", name)
+}
+
+// Join makes c a member of the pod, starting the pod if needed: it joins
+// the network, IPC and UTS namespaces of the infra process.
+func (s *PodService) Join(c *container.Container, name string) error {
+	if c.Network != "" || c.IpcMode != "" || c.UtsMode != "" {
+		return errors.New("--pod conflicts with --network, --ipc and --uts")
+	}
+	if c.NetworkHelper != "" {
+		return errors.New("--pod conflicts with --network-helper")
+	}
+	p, err := s.ensureInfra(name)
+	if err != nil {
+		return err
+	}
+	c.Pod = name
+	joinInfra(c, p)
+	return nil
+}
+
+// joinInfra points the namespaces of c to those of the infra process of p,
+// which change every time the pod starts.
+func joinInfra(c *container.Container, p *Pod) {
+	nsPath := func(ns string) string {
+		return "ns:/proc/" + strconv.Itoa(p.Infra.Pid) + "/ns/" + ns
+	}
+	c.Network = nsPath("net")
+	c.IpcMode = nsPath("ipc")
+	c.UtsMode = nsPath("uts")
+}
+
+func (s *PodService) marshalPod(p *Pod) error {
+	content, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.GetPodMetadataPath(p.Name), content, 0644)
+}
+
+// startInfra starts the infra process of pod name in new namespaces and
+// waits until it has set them up. It is detached from us: pods outlive the
+// command that started them.
+func startInfra(name string) (*Infra, error) {
+	ready, childEnd, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+	cmd := exec.Command("/proc/self/exe", InfraCommand, name)
+	cmd.ExtraFiles = []*os.File{childEnd}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		Setsid:     true,
+	}
+	err = cmd.Start()
+	childEnd.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "start pod infra")
+	}
+	// Reap it should it exit while we are still around.
+	go cmd.Wait()
+	if n, _ := ready.Read(make([]byte, 1)); n != 1 {
+		return nil, errors.Errorf("pod %s infra failed to start", name)
+	}
+	log.WithFields(log.Fields{"pod": name, "pid": cmd.Process.Pid}).Info("pod infra started")
+	return &Infra{Pid: cmd.Process.Pid, StartedAt: time.Now()}, nil
+}
+
+// RunInfra is the infra process of pod name: it sets its namespaces up and
+// holds them until it is told to stop.
+func RunInfra(name string) error {
+	if err := syscall.Sethostname([]byte(name)); err != nil {
+		return errors.Wrap(err, "set hostname")
+	}
+	if err := container.SetupLoopback(); err != nil {
+		return err
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, unix.SIGTERM, unix.SIGINT)
+	f := os.NewFile(infraSyncFd, "sync")
+	if _, err := f.Write([]byte{0}); err != nil {
+		return errors.Wrap(err, "report ready")
+	}
+	f.Close()
+	<-stop
+	return nil
+}
+
+func stopInfra(p *Pod, timeout time.Duration) error {
+	pid := p.Infra.Pid
+	for _, sig := range []syscall.Signal{unix.SIGTERM, unix.SIGKILL} {
+		if err := unix.Kill(pid, sig); err != nil && err != unix.ESRCH {
+			return errors.Wrapf(err, "stop pod %s infra", p.Name)
+		}
+		deadline := time.Now().Add(timeout)
+		for infraAlive(p) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if !infraAlive(p) {
+			return nil
+		}
+	}
+	return errors.Errorf("pod %s infra did not exit", p.Name)
+}
+
+// infraAlive reports whether the infra process of p runs, and isn't a pid
+// that was reused since.
+func infraAlive(p *Pod) bool {
+	if p.Infra == nil {
+		return false
+	}
+	dir := "/proc/" + strconv.Itoa(p.Infra.Pid)
+	cmdline, err := ioutil.ReadFile(dir + "/cmdline")
+	if err != nil {
+		return false
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	if len(args) != 3 || args[1] != InfraCommand || args[2] != p.Name {
+		return false
+	}
+	// Zombies have an empty cmdline, but check anyway.
+	stat, err := ioutil.ReadFile(dir + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) != 0 && fields[0] != "Z"
+}
@@ -0,0 +1,13 @@
+package volume
+
+import "github.com/pkg/errors"
+
+var (
+	ErrNotExists   error = errors.New("volume not exists")
+	ErrInvalidName error = errors.New("invalid volume name")
+	ErrInUse       error = errors.New("volume is in use")
+)
+
+func IsVolumeNotExists(err error) bool {
+	return errors.Cause(err) == ErrNotExists
+}
@@ -0,0 +1,26 @@
+package volume
+
+import (
+	"regexp"
+	"time"
+)
+
+const LocalDriver = "local"
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// Volume is a named directory under config.Home that outlives containers.
+type Volume struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Mountpoint string            `json:"mountpoint"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Anonymous volumes are created for a single container and removed by
+	// prune like any other unused volume.
+	Anonymous bool `json:"anonymous,omitempty"`
+}
+
+func IsValidName(name string) bool {
+	return validName.MatchString(name)
+}
@@ -0,0 +1,150 @@
+package volume
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/exfly/container/config"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func NewVolumeService(configHome *config.Home) *VolumeService {
+	return &VolumeService{
+		configHome: configHome,
+	}
+}
+
+type VolumeService struct {
+	configHome *config.Home
+}
+
+func (s *VolumeService) GetVolumeHome(name string) string {
+	return s.configHome.VolumesPath() + "/" + name
+}
+
+func (s *VolumeService) GetVolumeMetadataPath(name string) string {
+	return s.GetVolumeHome(name) + "/volume.json"
+}
+
+// GetVolumeDataPath is the directory that gets mounted into containers.
+func (s *VolumeService) GetVolumeDataPath(name string) string {
+	return s.GetVolumeHome(name) + "/_data"
+}
+
+// Create creates a volume. An empty name creates an anonymous volume with a
+// random name. Creating an existing volume returns it unchanged.
+func (s *VolumeService) Create(name string, labels map[string]string) (*Volume, error) {
+	anonymous := name == ""
+	if anonymous {
+		name = randomName()
+	}
+	if !IsValidName(name) {
+		return nil, errors.Wrapf(ErrInvalidName, "%q", name)
+	}
+	if vol, err := s.Inspect(name); err == nil {
+		return vol, nil
+	} else if !IsVolumeNotExists(err) {
+		return nil, err
+	}
+	vol := &Volume{
+		Name:       name,
+		Driver:     LocalDriver,
+		Mountpoint: s.GetVolumeDataPath(name),
+		CreatedAt:  time.Now(),
+		Labels:     labels,
+		Anonymous:  anonymous,
+	}
+	if err := os.MkdirAll(vol.Mountpoint, 0755); err != nil {
+		return nil, errors.Wrapf(err, "create volume %s", name)
+	}
+	if err := s.marshalVolume(vol); err != nil {
+		return nil, err
+	}
+	log.WithField("volume", name).Debug("volume created")
+	return vol, nil
+}
+
+func (s *VolumeService) Inspect(name string) (*Volume, error) {
+	content, err := ioutil.ReadFile(s.GetVolumeMetadataPath(name))
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotExists, "%s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var vol Volume
+	if err := json.Unmarshal(content, &vol); err != nil {
+		return nil, errors.Wrapf(err, "parse volume %s", name)
+	}
+	return &vol, nil
+}
+
+// List returns all volumes sorted by name.
+func (s *VolumeService) List() ([]*Volume, error) {
+	entries, err := ioutil.ReadDir(s.configHome.VolumesPath())
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Volume
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		vol, err := s.Inspect(entry.Name())
+		if err != nil {
+			log.WithError(err).WithField("volume", entry.Name()).Warn("skip broken volume")
+			continue
+		}
+		ret = append(ret, vol)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+func (s *VolumeService) Remove(name string) error {
+	if _, err := s.Inspect(name); err != nil {
+		return err
+	}
+	return errors.Wrapf(os.RemoveAll(s.GetVolumeHome(name)), "remove volume %s", name)
+}
+
+// Prune removes every volume for which inUse returns false and returns the
+// names of the removed volumes.
+func (s *VolumeService) Prune(inUse func(name string) bool) ([]string, error) {
+	vols, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, vol := range vols {
+		if inUse(vol.Name) {
+			continue
+		}
+		if err := s.Remove(vol.Name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, vol.Name)
+	}
+	return removed, nil
+}
+
+func (s *VolumeService) marshalVolume(vol *Volume) error {
+	content, err := json.Marshal(vol)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.GetVolumeMetadataPath(vol.Name), content, 0644)
+}
+
+func randomName() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}